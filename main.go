@@ -1,278 +1,341 @@
 package main
 
 import (
-	"archive/zip"
-	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"io"
-	"log"
+	"log/slog"
 	"os"
+	"os/signal"
 	"path/filepath"
 	"strings"
 	"time"
-)
 
-var (
-	directory   string
-	listFile    string
-	outputPath  string
-	outputName  string
-	fileNames   []string
-	filePaths   []string
-	directories []string
-	verbose     bool
+	"pathfinder/pathfinder"
 )
 
-var zipWriter *zip.Writer
-var archiveFile *os.File
-
 func main() {
-	// Define flags at the global scope
-	var (
-		defaultListFile   = "pathfinder.txt"
-		defaultOutputPath = "."
-	)
+	os.Exit(run())
+}
+
+// run runs the command and returns its exit code. Returning rather than
+// calling os.Exit lets deferred calls, such as closing the log file, run
+// before the process exits.
+func run() int {
+	cfg := pathfinder.DefaultConfig()
+	var extensions, excludeExtensions stringList
+	var searchDirs, listFiles, excludeRegexes valueList
+	var password passwordFlag
+	var showVersion, skipVCS, skipBuild, logJSON, summaryJSON bool
+	var logFile, logLevel string
+	var skipDirs stringList
 
 	// Use Pathfinder directory as default search directory
 	cwd, _ := os.Getwd()
 	defaultDirectory := filepath.Join(cwd, "Pathfinder")
 
-	flag.StringVar(&directory, "d", defaultDirectory, "Directory to search for files")
-	flag.StringVar(&listFile, "l", filepath.Join(".", defaultListFile), "Text file with file lists")
-	flag.StringVar(&outputPath, "p", defaultOutputPath, "Optional: Output path for the zip archive")
-	flag.StringVar(&outputName, "n", "", "Optional: Output archive name")
-	flag.BoolVar(&verbose, "v", false, "Enable verbose mode")
+	flag.Var(&searchDirs, "d", "Directory, or zip or tar archive, to search for files (repeatable)")
+	flag.Var(&listFiles, "l", "Text, YAML or JSON file with file lists, a directory of .txt lists, or - to read from stdin (repeatable, merged in order; default "+filepath.Join(".", cfg.ListFile)+")")
+	flag.StringVar(&cfg.OutputPath, "p", cfg.OutputPath, "Optional: Output path for the zip archive")
+	flag.StringVar(&cfg.OutputName, "n", "", "Optional: Output archive name")
+	flag.StringVar(&cfg.TimeFormat, "time-format", "", "Optional: Go time layout of the timestamp in the generated archive name (default 2006-Jan-02-15-04)")
+	flag.StringVar(&cfg.OutputTemplate, "output-template", "", "Optional: Archive name template used when -n is empty, with {date}, {time}, {host}, {user} and {count}")
+	flag.BoolVar(&cfg.CreateOutputDir, "mkdir", false, "Optional: Create the output path if it does not exist")
+	flag.BoolVar(&cfg.Force, "force", false, "Optional: Overwrite the output archive if it already exists")
+	flag.BoolVar(&cfg.Append, "append", false, "Optional: Add matched files to the existing zip archive given by -p and -n")
+	flag.BoolVar(&cfg.FailOnExisting, "fail-on-existing", false, "Optional: With -append, fail instead of skipping files whose entry is already in the archive")
+	flag.StringVar(&cfg.Format, "format", cfg.Format, "Optional: Archive format (zip, tar or tgz)")
+	flag.Var(&password, "password", "Optional: Encrypt zip entries with AES-256; use -password=secret or -password alone to be prompted")
+	flag.IntVar(&cfg.Level, "level", cfg.Level, "Optional: Compression level from 0 (store) to 9 (best), -1 for default")
+	flag.IntVar(&cfg.MaxDepth, "depth", cfg.MaxDepth, "Optional: Maximum directory depth to descend below the search directory (-1 for unlimited)")
+	flag.IntVar(&cfg.MaxFiles, "max-files", 0, "Optional: Abort when more than this many files match (0 for no limit)")
+	flag.IntVar(&cfg.Workers, "workers", cfg.Workers, "Optional: Number of files read concurrently")
+	flag.IntVar(&cfg.OpenRetries, "open-retries", cfg.OpenRetries, "Optional: Times to retry opening a file after a transient error such as EINTR or EAGAIN")
+	flag.DurationVar(&cfg.RetryBackoff, "retry-backoff", cfg.RetryBackoff, "Optional: Wait before the first retry of an open, doubled for each further one")
+	flag.BoolVar(&cfg.Progress, "progress", false, "Optional: Report progress periodically on stderr")
+	flag.BoolVar(&cfg.Verbose, "v", false, "Enable verbose mode")
+	flag.BoolVar(&showVersion, "version", false, "Print the version and exit")
+	flag.StringVar(&logFile, "log", "", "Optional: Append structured log lines to this file")
+	flag.BoolVar(&logJSON, "log-json", false, "Optional: Write log records as JSON, to stderr unless -log is given")
+	flag.StringVar(&logLevel, "log-level", "info", "Optional: Lowest level written to the log: debug, info, warn or error")
+	flag.BoolVar(&cfg.Quiet, "quiet", false, "Optional: Suppress all output except errors and warnings")
+	flag.BoolVar(&summaryJSON, "summary-json", false, "Optional: Print the run summary as a JSON object instead of the summary line, moving other output to stderr")
+	flag.Var(&extensions, "ext", "Optional: Only archive files with this extension (repeatable)")
+	flag.Var(&excludeExtensions, "not-ext", "Optional: Skip files with this extension (repeatable)")
+	storeExtensionsSet := false
+	flag.Func("store-ext", "Optional: Store files with this extension uncompressed in zip archives, replacing the default list of compressed formats (repeatable or comma-separated, empty for none)", func(value string) error {
+		if !storeExtensionsSet {
+			cfg.StoreExtensions = nil
+			storeExtensionsSet = true
+		}
+		return (*stringList)(&cfg.StoreExtensions).Set(value)
+	})
+	flag.Var(&excludeRegexes, "exclude-regex", "Optional: Skip files whose path relative to the search directory matches this regular expression (repeatable)")
+	flag.Func("exclude-from", "Optional: Read [exclude] patterns from this file, one per line (repeatable)", func(value string) error {
+		cfg.ExcludeFrom = append(cfg.ExcludeFrom, value)
+		return nil
+	})
+	flag.Func("size-min", "Optional: Skip files smaller than this size (e.g. 10KB)", func(value string) error {
+		size, err := pathfinder.ParseSize(value)
+		cfg.MinSize = size
+		return err
+	})
+	flag.Func("size-max", "Optional: Skip files larger than this size (e.g. 5MB)", func(value string) error {
+		size, err := pathfinder.ParseSize(value)
+		cfg.MaxSize = size
+		return err
+	})
+	flag.Func("exclude-larger-than-on-disk", "Optional: Skip files taking more than this size on disk, rather than by their apparent size as -size-max does, e.g. for sparse files (e.g. 5MB)", func(value string) error {
+		size, err := pathfinder.ParseSize(value)
+		cfg.MaxDiskSize = size
+		return err
+	})
+	flag.Func("split", "Optional: Split the archive into volumes of at most this size (e.g. 2GB)", func(value string) error {
+		size, err := pathfinder.ParseSize(value)
+		cfg.SplitSize = size
+		return err
+	})
+	flag.Func("max-total-bytes", "Optional: Abort when the matched files add up to more than this size (e.g. 10GB)", func(value string) error {
+		size, err := pathfinder.ParseSize(value)
+		cfg.MaxTotalBytes = size
+		return err
+	})
+	flag.Func("modified-after", "Optional: Only archive files modified after this RFC 3339 time or duration ago (e.g. 24h)", func(value string) error {
+		t, err := pathfinder.ParseTime(value, time.Now())
+		cfg.ModifiedAfter = t
+		return err
+	})
+	flag.Func("modified-before", "Optional: Only archive files modified before this RFC 3339 time or duration ago (e.g. 24h)", func(value string) error {
+		t, err := pathfinder.ParseTime(value, time.Now())
+		cfg.ModifiedBefore = t
+		return err
+	})
+	flag.BoolVar(&cfg.CaseInsensitive, "case-insensitive", false, "Optional: Match names and paths ignoring case")
+	flag.BoolVar(&cfg.NoHidden, "no-hidden", false, "Optional: Skip files and directories whose name starts with a dot")
+	flag.BoolVar(&skipVCS, "skip-vcs", false, "Optional: Skip version control directories ("+strings.Join(pathfinder.VCSDirs, ", ")+")")
+	flag.BoolVar(&skipBuild, "skip-build", false, "Optional: Skip dependency and build directories ("+strings.Join(pathfinder.BuildDirs, ", ")+")")
+	flag.Var(&skipDirs, "skip-dir", "Optional: Skip directories with this name or glob wherever they occur (repeatable)")
+	flag.BoolVar(&cfg.FollowSymlinks, "follow-symlinks", false, "Optional: Descend into symlinked directories")
+	flag.BoolVar(&cfg.PreserveSymlinks, "preserve-symlinks", false, "Optional: Store symlinks as links instead of archiving their targets")
+	flag.BoolVar(&cfg.Reproducible, "reproducible", false, "Optional: Give all entries a fixed timestamp (SOURCE_DATE_EPOCH or 1980-01-01)")
+	flag.BoolVar(&cfg.RespectGitignore, "respect-gitignore", false, "Optional: Skip paths under [directories] entries that .gitignore files ignore")
+	flag.StringVar(&cfg.RelativeBase, "relative-base", "", "Optional: Directory entry names are relative to instead of the search directory")
+	flag.BoolVar(&cfg.Flatten, "flatten", false, "Optional: Name entries by their base name alone, numbering files whose names collide")
+	flag.BoolVar(&cfg.PreserveAbsPaths, "preserve-abs-paths", false, "Optional: Name entries by their full absolute path instead of the path below the search directory")
+	flag.StringVar(&cfg.StripPrefix, "strip-prefix", "", "Optional: Remove this leading path from entry names that start with it")
+	flag.StringVar(&cfg.Prefix, "prefix", "", "Optional: Directory to nest all entries under inside the archive")
+	flag.BoolVar(&cfg.DedupContent, "dedup-content", false, "Optional: Store identical files once, adding copies as links (symlinks in zip, hard links in tar)")
+	flag.BoolVar(&cfg.IncludeEmptyDirs, "include-empty-dirs", false, "Optional: Store empty directories found under [directories] entries")
+	flag.BoolVar(&cfg.Manifest, "manifest", false, "Optional: Write a JSON manifest of archived files next to the archive")
+	flag.BoolVar(&cfg.IncludeList, "include-list", false, "Optional: Store the effective file list in the archive as .pathfinder/list.txt")
+	flag.BoolVar(&cfg.Metadata, "metadata", false, "Optional: Store the flags, time, host, user, version and counts of the run in the archive as .pathfinder/metadata.json")
+	flag.BoolVar(&cfg.Verify, "verify", false, "Optional: Read the finished archive back and check that every [files] entry is in it")
+	flag.BoolVar(&cfg.ListSections, "list-sections", false, "Optional: Print the parsed list file entries by section and exit without searching")
+	flag.BoolVar(&cfg.DryRun, "dry-run", false, "Optional: List matched files without creating an archive")
+	flag.BoolVar(&cfg.RelToList, "rel-to-list", false, "Optional: Resolve relative [paths] and [directories] entries against the list file's directory")
+	flag.BoolVar(&cfg.NullList, "0", false, "Optional: Read NUL-separated paths from stdin (-l -), such as the output of find -print0, instead of a list file")
+	flag.BoolVar(&cfg.NullList, "null", false, "Optional: Same as -0")
+	flag.BoolVar(&cfg.ContinueOnWalkError, "continue-on-walk-error", false, "Optional: Skip directories that cannot be read instead of aborting")
+	flag.BoolVar(&cfg.IgnoreErrors, "ignore-errors", false, "Optional: Exit successfully even if some matched files could not be archived")
+	flag.BoolVar(&cfg.Strict, "strict", false, "Optional: Exit with code 2 when a list entry matches no files")
 
 	flag.Parse()
 
-	// Check if the specified directory exists
-	if _, err := os.Stat(directory); os.IsNotExist(err) {
-		fmt.Println("Error: The specified directory does not exist.")
-		os.Exit(1)
+	if showVersion {
+		fmt.Println(versionString())
+		return 0
 	}
 
-	// Check if the specified list file exists
-	if _, err := os.Stat(listFile); os.IsNotExist(err) {
-		fmt.Println("Error: The specified list file does not exist.")
-		os.Exit(1)
+	if cfg.Metadata {
+		cfg.ToolVersion = versionString()
+		cfg.Flags = make(map[string]string)
+		flag.Visit(func(fl *flag.Flag) {
+			// Never record the password itself
+			if fl.Name == "password" {
+				cfg.Flags[fl.Name] = "(redacted)"
+				return
+			}
+			cfg.Flags[fl.Name] = fl.Value.String()
+		})
 	}
 
-	// Read the text file
-	readTextFile(listFile)
-
-	// Create a new zip archive
-	outputFilename := generateOutputFilename(outputName)
-	outputPathAndName := filepath.Join(outputPath, outputFilename)
-
-	if err := createZipArchive(outputPathAndName); err != nil {
-		fmt.Println("Error creating zip archive:", err)
-		os.Exit(1)
+	if len(searchDirs) == 0 {
+		searchDirs = valueList{defaultDirectory}
 	}
-
-	defer closeResources()
-
-	// Search for files in the specified directory
-	searchFiles(directory)
-
-	if verbose {
-		fmt.Printf("New zip archive created: %s\n", outputFilename)
+	for i, dir := range searchDirs {
+		searchDirs[i] = pathfinder.ExpandPath(dir)
 	}
-}
-
-// readTextFile reads a text file and categorizes lines into sections.
-func readTextFile(filename string) {
-	// Open the file
-	file, err := os.Open(filename)
-	if err != nil {
-		log.Fatalf("Error opening text file: %v", err)
+	cfg.Directories = searchDirs
+	if len(listFiles) == 0 {
+		listFiles = valueList{filepath.Join(".", cfg.ListFile)}
 	}
-	defer file.Close()
-
-	var section string
-	scanner := bufio.NewScanner(file)
-
-	// Scan the file line by line
-	// Scan the file line by line
-	for scanner.Scan() {
-		line := scanner.Text()
-
-		// Check if the line is a section header
-		isSectionHeader := strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]")
-		if isSectionHeader {
-			section = line[1 : len(line)-1]
-			continue
-		}
-
-		// Ignore empty lines
-		if line == "" {
-			continue
-		}
-
-		// Categorize the line based on the current section
-		switch section {
-		case "files":
-			fileNames = append(fileNames, line)
-		case "paths":
-			filePaths = append(filePaths, line)
-		case "directories":
-			directories = append(directories, line)
-		}
+	for i, listFile := range listFiles {
+		listFiles[i] = pathfinder.ExpandPath(listFile)
 	}
-
-	// Check for errors during scanning
-	if err := scanner.Err(); err != nil {
-		fmt.Printf("Error reading text file: %v", err)
+	cfg.ListFiles = listFiles
+	cfg.OutputPath = pathfinder.ExpandPath(cfg.OutputPath)
+	cfg.RelativeBase = pathfinder.ExpandPath(cfg.RelativeBase)
+	cfg.Extensions = extensions
+	cfg.ExcludeExtensions = excludeExtensions
+	cfg.ExcludeRegexes = excludeRegexes
+	if skipVCS {
+		cfg.SkipDirs = append(cfg.SkipDirs, pathfinder.VCSDirs...)
 	}
-}
-
-func searchFiles(dir string) {
-	filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+	if skipBuild {
+		cfg.SkipDirs = append(cfg.SkipDirs, pathfinder.BuildDirs...)
+	}
+	cfg.SkipDirs = append(cfg.SkipDirs, skipDirs...)
+
+	cfg.Password = password.value
+	if password.prompt && flag.NArg() > 0 {
+		// -password takes no separate value, so "-password secret" would
+		// prompt and leave the password behind as an argument
+		fmt.Fprintf(os.Stderr, "Error: unexpected argument %q after -password; give the password as -password=VALUE\n", flag.Arg(0))
+		return 1
+	}
+	if password.prompt {
+		value, err := promptPassword()
 		if err != nil {
-			return err
+			fmt.Fprintln(os.Stderr, "Error:", err)
+			return 1
 		}
+		cfg.Password = value
+	}
 
-		handleFileByNames(path, info)
-		handleFileByPaths(path, info)
-		handleDirectories(path, info)
-
-		return nil
-	})
-}
-
-func handleFileByNames(path string, info os.FileInfo) {
-	if !info.IsDir() && contains(info.Name(), fileNames) {
-		if verbose {
-			fmt.Printf("Found by name: %s\n", path)
+	if logFile != "" || logJSON {
+		var level slog.Level
+		if err := level.UnmarshalText([]byte(logLevel)); err != nil {
+			fmt.Fprintln(os.Stderr, "Error: invalid log level:", logLevel)
+			return 1
 		}
-
-		// Add the file to the new zip archive
-		if err := addToZipArchive(path); err != nil {
-			fmt.Println("Error adding file to archive:", err)
+		var out io.Writer = os.Stderr
+		if logFile != "" {
+			file, err := os.OpenFile(logFile, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, "Error: failed to open log file:", err)
+				return 1
+			}
+			defer file.Close()
+			out = file
+		}
+		options := &slog.HandlerOptions{Level: level}
+		if logJSON {
+			cfg.Logger = slog.New(slog.NewJSONHandler(out, options))
+		} else {
+			cfg.Logger = slog.New(slog.NewTextHandler(out, options))
 		}
-	}
-}
-
-func handleFileByPaths(path string, info os.FileInfo) {
-	if info.IsDir() {
-		return
 	}
 
-	// Check if the path contains any specified paths
-	for _, specifiedPath := range filePaths {
-		if strings.HasPrefix(path, specifiedPath) {
-			handleFoundPath(path)
-			break
+	if summaryJSON {
+		if cfg.OutputName == "-" {
+			fmt.Fprintln(os.Stderr, "Error: -summary-json cannot be used when the archive is written to stdout")
+			return 1
 		}
+		cfg.NoSummary = true
+		// Keep stdout to the JSON object, moving the dry-run listing and
+		// verbose messages to stderr
+		cfg.Output = os.Stderr
 	}
-}
 
-func handleFoundPath(path string) {
-	if verbose {
-		fmt.Printf("Found by path: %s\n", path)
-	}
+	// Stop on Ctrl-C without leaving a partial archive behind
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
 
-	// Add the file to the new zip archive
-	if err := addToZipArchive(path); err != nil {
-		fmt.Println("Error adding file to archive:", err)
+	started := time.Now()
+	result, err := pathfinder.RunContext(ctx, cfg)
+	if summaryJSON {
+		printSummaryJSON(result, time.Since(started))
 	}
-}
-
-func handleDirectories(path string, info os.FileInfo) {
-	if info.IsDir() && isUnderDirectory(path, directories) {
-		if verbose {
-			fmt.Printf("Found under directory: %s\n", path)
+	if len(result.Unmatched) > 0 {
+		fmt.Fprintln(os.Stderr, "Warning: the following entries matched no files:")
+		for _, entry := range result.Unmatched {
+			fmt.Fprintln(os.Stderr, "  "+entry)
 		}
-
-		// Add all files under the directory to the new zip archive
-		if err := filepath.Walk(path, addFilesToZip); err != nil {
-			fmt.Println("Error walking through directory:", err)
+	}
+	if len(result.WalkErrors) > 0 {
+		fmt.Fprintf(os.Stderr, "Warning: %d paths could not be searched:\n", len(result.WalkErrors))
+		for _, skipped := range result.WalkErrors {
+			fmt.Fprintf(os.Stderr, "  %s: %v\n", skipped.Path, skipped.Err)
 		}
 	}
-}
-
-func addFilesToZip(subPath string, subInfo os.FileInfo, subErr error) error {
-	if subErr != nil {
-		return subErr
+	if len(result.Skipped) > 0 {
+		fmt.Fprintf(os.Stderr, "Warning: %d matched files could not be archived:\n", len(result.Skipped))
+		for _, skipped := range result.Skipped {
+			fmt.Fprintf(os.Stderr, "  %s: %v\n", skipped.Path, skipped.Err)
+		}
 	}
-	if !subInfo.IsDir() {
-		// Add the file to the new zip archive
-		if err := addToZipArchive(subPath); err != nil {
-			fmt.Println("Error adding file to archive:", err)
+	if len(result.VerifyProblems) > 0 {
+		fmt.Fprintf(os.Stderr, "Verification found %d problems:\n", len(result.VerifyProblems))
+		for _, problem := range result.VerifyProblems {
+			fmt.Fprintln(os.Stderr, "  "+problem)
 		}
 	}
-	return nil
-}
-
-func generateOutputFilename(userProvidedName string) string {
-	if userProvidedName != "" {
-		return userProvidedName
+	if errors.Is(err, pathfinder.ErrUnmatched) {
+		return 2
 	}
-	return fmt.Sprintf("request-%s.zip", time.Now().Format("2006-Jan-02-15-04"))
-}
-
-func contains(needle string, haystack []string) bool {
-	for _, item := range haystack {
-		if needle == item {
-			return true
-		}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		return 1
 	}
-	return false
+	return 0
 }
 
-func isUnderDirectory(filePath string, directories []string) bool {
-	for _, dir := range directories {
-		if strings.HasPrefix(filePath, dir) {
-			return true
-		}
-	}
-	return false
+// runSummary is the JSON object printed by -summary-json.
+type runSummary struct {
+	FilesAdded int   `json:"files_added"`
+	BytesIn    int64 `json:"bytes_in"`
+	BytesOut   int64 `json:"bytes_out"`
+	DurationMS int64 `json:"duration_ms"`
+	Skipped    int   `json:"skipped"`
+	Unmatched  int   `json:"unmatched"`
 }
 
-func createZipArchive(outputPathAndName string) error {
-	archiveFile, err := os.Create(outputPathAndName)
+// printSummaryJSON prints the counts of result and the run's duration as a
+// single line of JSON on stdout.
+func printSummaryJSON(result pathfinder.Result, duration time.Duration) {
+	data, err := json.Marshal(runSummary{
+		FilesAdded: result.FilesAdded,
+		BytesIn:    result.BytesUncompressed,
+		BytesOut:   result.BytesCompressed,
+		DurationMS: duration.Milliseconds(),
+		Skipped:    len(result.Skipped),
+		Unmatched:  len(result.Unmatched),
+	})
 	if err != nil {
-		return err
+		fmt.Fprintln(os.Stderr, "Error: failed to encode summary:", err)
+		return
 	}
-
-	// Create a new zip writer
-	zipWriter = zip.NewWriter(archiveFile)
-	return nil
+	fmt.Println(string(data))
 }
 
-func addToZipArchive(filePath string) error {
-	sourceFile, err := os.Open(filePath)
-	if err != nil {
-		return fmt.Errorf("failed to open source file: %w", err)
-	}
-	defer sourceFile.Close()
+// stringList is a flag.Value collecting repeated or comma-separated values.
+type stringList []string
 
-	entry, err := zipWriter.Create(filepath.Base(filePath))
-	if err != nil {
-		return fmt.Errorf("failed to create entry in zip file: %w", err)
-	}
+func (s *stringList) String() string {
+	return strings.Join(*s, ",")
+}
 
-	_, err = io.Copy(entry, sourceFile)
-	if err != nil {
-		return fmt.Errorf("failed to copy file content to zip archive: %w", err)
+func (s *stringList) Set(value string) error {
+	for _, item := range strings.Split(value, ",") {
+		if item != "" {
+			*s = append(*s, item)
+		}
 	}
-
 	return nil
 }
 
-func closeResources() {
-	if zipWriter != nil {
-		// Close the zip writer
-		err := zipWriter.Close()
-		if err != nil {
-			fmt.Println("Error closing zip writer:", err)
-		}
-	}
-	if archiveFile != nil {
-		// Close the archive file
-		err := archiveFile.Close()
-		if err != nil {
-			fmt.Println("Error closing archive file:", err)
-		}
-	}
+// valueList is a flag.Value collecting repeated values. Unlike stringList it
+// does not split at commas, which paths and regular expressions may contain.
+type valueList []string
+
+func (v *valueList) String() string {
+	return strings.Join(*v, " ")
+}
+
+func (v *valueList) Set(value string) error {
+	*v = append(*v, value)
+	return nil
 }
@@ -0,0 +1,362 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime/debug"
+	"strings"
+	"testing"
+)
+
+// TestMain runs the command instead of the tests when the test binary was
+// started by runMain, so that tests can check its output and exit code.
+func TestMain(m *testing.M) {
+	if os.Getenv("PATHFINDER_RUN_MAIN") == "1" {
+		os.Exit(run())
+	}
+	os.Exit(m.Run())
+}
+
+// runMain runs the command with args in dir, in a child process, and returns
+// what it wrote to stdout and stderr and its exit code.
+func runMain(t *testing.T, dir string, stdin io.Reader, args ...string) (stdout, stderr string, code int) {
+	t.Helper()
+	cmd := exec.Command(os.Args[0], args...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), "PATHFINDER_RUN_MAIN=1")
+	cmd.Stdin = stdin
+	var out, errOut bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &out, &errOut
+
+	err := cmd.Run()
+	var exitErr *exec.ExitError
+	switch {
+	case errors.As(err, &exitErr):
+		code = exitErr.ExitCode()
+	case err != nil:
+		t.Fatal(err)
+	}
+	return out.String(), errOut.String(), code
+}
+
+// writeFile creates the file at path with content, along with its parent
+// directories.
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestStrictExitCode(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "src", "a.txt"), "alpha")
+	writeFile(t, filepath.Join(dir, "list.txt"), "[files]\na.txt\nmissing.txt\n")
+
+	args := []string{"-d", "src", "-l", "list.txt", "-p", dir, "-dry-run"}
+	if _, stderr, code := runMain(t, dir, nil, args...); code != 0 || !strings.Contains(stderr, "missing.txt") {
+		t.Errorf("without -strict: exit code %d, stderr %q, want 0 and a warning about missing.txt", code, stderr)
+	}
+	if _, stderr, code := runMain(t, dir, nil, append(args, "-strict")...); code != 2 || !strings.Contains(stderr, "missing.txt") {
+		t.Errorf("with -strict: exit code %d, stderr %q, want 2 and a warning about missing.txt", code, stderr)
+	}
+
+	// Everything matched, so -strict has nothing to complain about
+	writeFile(t, filepath.Join(dir, "list.txt"), "[files]\na.txt\n")
+	if _, stderr, code := runMain(t, dir, nil, append(args, "-strict")...); code != 0 {
+		t.Errorf("with -strict and every entry matched: exit code %d, stderr %q, want 0", code, stderr)
+	}
+}
+
+func TestPasswordNeedsEqualsSign(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "src", "a.txt"), "alpha")
+	writeFile(t, filepath.Join(dir, "list.txt"), "[files]\na.txt\n")
+
+	_, stderr, code := runMain(t, dir, strings.NewReader("prompted\n"), "-d", "src", "-l", "list.txt", "-p", dir, "-n", "out.zip", "-password", "secret")
+	if code != 1 || !strings.Contains(stderr, `unexpected argument "secret"`) || !strings.Contains(stderr, "-password=VALUE") {
+		t.Errorf("-password secret: exit code %d, stderr %q, want 1 and a hint to use -password=VALUE", code, stderr)
+	}
+	if strings.Contains(stderr, "Password:") {
+		t.Error("-password secret prompted for a password")
+	}
+	if _, err := os.Stat(filepath.Join(dir, "out.zip")); !os.IsNotExist(err) {
+		t.Errorf("an archive was written: %v", err)
+	}
+
+	if _, stderr, code := runMain(t, dir, nil, "-d", "src", "-l", "list.txt", "-p", dir, "-n", "out.zip", "-password=secret"); code != 0 {
+		t.Errorf("-password=secret: exit code %d, stderr %q, want 0", code, stderr)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "out.zip")); err != nil {
+		t.Errorf("no archive was written with -password=secret: %v", err)
+	}
+}
+
+func TestFlagsExpandHomeAndVariables(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("HOME", dir)
+	t.Setenv("USERPROFILE", dir)
+	t.Setenv("PATHFINDER_LIST", "list.txt")
+	writeFile(t, filepath.Join(dir, "src", "a.txt"), "alpha")
+	writeFile(t, filepath.Join(dir, "list.txt"), "[files]\na.txt\n")
+
+	stdout, stderr, code := runMain(t, t.TempDir(), nil, "-d", "~/src", "-l", "$HOME/${PATHFINDER_LIST}", "-dry-run")
+	if code != 0 || !strings.Contains(stdout, filepath.Join(dir, "src", "a.txt")) {
+		t.Errorf("exit code %d, stdout %q, stderr %q, want a.txt under the expanded home", code, stdout, stderr)
+	}
+}
+
+func TestExcludeRegexFlag(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"a.txt", "a.txt.bak", "xx.txt", "x.txt"} {
+		writeFile(t, filepath.Join(dir, "src", name), name)
+	}
+	writeFile(t, filepath.Join(dir, "list.txt"), "[files]\n*\n")
+
+	// Commas are part of the expression rather than separating values
+	stdout, stderr, code := runMain(t, dir, nil, "-d", "src", "-l", "list.txt", "-dry-run",
+		"-exclude-regex", `.*\.bak$`, "-exclude-regex", `^x{2,3}\.`)
+	if code != 0 {
+		t.Fatalf("exit code %d, stderr %q", code, stderr)
+	}
+	for name, want := range map[string]bool{"a.txt": true, "x.txt": true, "a.txt.bak": false, "xx.txt": false} {
+		if got := strings.Contains(stdout, filepath.Join("src", name)+"\n"); got != want {
+			t.Errorf("%s listed %v, want %v in %q", name, got, want, stdout)
+		}
+	}
+}
+
+func TestRepeatedListFiles(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "my,src")
+	writeFile(t, filepath.Join(src, "base.txt"), "base")
+	writeFile(t, filepath.Join(src, "env.txt"), "env")
+	writeFile(t, filepath.Join(src, "env.tmp"), "scratch")
+	writeFile(t, filepath.Join(dir, "base,list.txt"), "[files]\nbase.txt\n*.tmp\nmissing.md\n")
+	writeFile(t, filepath.Join(dir, "env.txt"), "[files]\nenv.txt\n[exclude]\n*.tmp\n")
+
+	// Neither flag splits its value at commas
+	stdout, stderr, code := runMain(t, dir, nil, "-d", src, "-l", "base,list.txt", "-l", "env.txt", "-dry-run")
+	if code != 0 {
+		t.Fatalf("exit code %d, stderr %q", code, stderr)
+	}
+	for name, want := range map[string]bool{"base.txt": true, "env.txt": true, "env.tmp": false} {
+		if got := strings.Contains(stdout, filepath.Join(src, name)+"\n"); got != want {
+			t.Errorf("%s listed %v, want %v in %q", name, got, want, stdout)
+		}
+	}
+	// The later list's [exclude] applies to the earlier list's entries, and
+	// unmatched entries name the list they came from
+	if !strings.Contains(stderr, "missing.md") || !strings.Contains(stderr, "base,list.txt") {
+		t.Errorf("stderr %q, want missing.md reported with base,list.txt", stderr)
+	}
+}
+
+func TestVersionString(t *testing.T) {
+	version, commit, date, read := Version, Commit, Date, readBuildInfo
+	t.Cleanup(func() { Version, Commit, Date, readBuildInfo = version, commit, date, read })
+
+	embedded := &debug.BuildInfo{Settings: []debug.BuildSetting{
+		{Key: "vcs.revision", Value: "0123456789abcdef0123"},
+		{Key: "vcs.time", Value: "2024-05-06T07:08:09Z"},
+	}}
+	tests := []struct {
+		commit, date string
+		info         *debug.BuildInfo
+		want         string
+	}{
+		// Values set with -ldflags win over the embedded ones
+		{"abc1234", "2024-01-02T03:04:05Z", embedded, "pathfinder 1.2.0 (commit abc1234, built 2024-01-02T03:04:05Z)"},
+		{"", "", embedded, "pathfinder 1.2.0 (commit 0123456789ab, built 2024-05-06T07:08:09Z)"},
+		{"abc1234", "", embedded, "pathfinder 1.2.0 (commit abc1234, built 2024-05-06T07:08:09Z)"},
+		{"", "", &debug.BuildInfo{}, "pathfinder 1.2.0 (commit unknown, built unknown)"},
+		{"", "", nil, "pathfinder 1.2.0 (commit unknown, built unknown)"},
+	}
+	for _, test := range tests {
+		Version, Commit, Date = "1.2.0", test.commit, test.date
+		info := test.info
+		readBuildInfo = func() (*debug.BuildInfo, bool) { return info, info != nil }
+		if got := versionString(); got != test.want {
+			t.Errorf("versionString() = %q, want %q", got, test.want)
+		}
+	}
+}
+
+func TestLogFile(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "src", "a.txt"), "alpha")
+	writeFile(t, filepath.Join(dir, "src", "b.txt"), "bravo")
+	writeFile(t, filepath.Join(dir, "list.txt"), "[files]\n*.txt\nmissing.md\n")
+	logPath := filepath.Join(dir, "run.log")
+
+	// The log is complete even when the run exits with an error code
+	args := []string{"-d", "src", "-l", "list.txt", "-p", dir, "-n", "out.zip", "-strict", "-log", logPath}
+	if _, stderr, code := runMain(t, dir, nil, append(args, "-log-level", "debug")...); code != 2 {
+		t.Fatalf("exit code %d, stderr %q, want 2", code, stderr)
+	}
+	data, err := os.ReadFile(logPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	log := string(data)
+	for _, want := range []string{"level=DEBUG msg=file_added path=" + filepath.Join("src", "a.txt"), "msg=file_added path=" + filepath.Join("src", "b.txt"), "level=INFO msg=run_complete"} {
+		if !strings.Contains(log, want) {
+			t.Errorf("log lacks %q:\n%s", want, log)
+		}
+	}
+	if !strings.HasPrefix(log, "time=") {
+		t.Errorf("log lines are not timestamped:\n%s", log)
+	}
+
+	// Further runs append, and the default level leaves out added files
+	if err := os.Remove(logPath); err != nil {
+		t.Fatal(err)
+	}
+	if _, stderr, code := runMain(t, dir, nil, append(args, "-force")...); code != 2 {
+		t.Fatalf("exit code %d, stderr %q, want 2", code, stderr)
+	}
+	if _, stderr, code := runMain(t, dir, nil, append(args, "-force")...); code != 2 {
+		t.Fatalf("exit code %d, stderr %q, want 2", code, stderr)
+	}
+	data, err = os.ReadFile(logPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Count(string(data), "msg=run_complete"); got != 2 {
+		t.Errorf("log holds %d run_complete records, want 2:\n%s", got, data)
+	}
+	if strings.Contains(string(data), "file_added") {
+		t.Errorf("info level log holds debug records:\n%s", data)
+	}
+
+	if _, stderr, code := runMain(t, dir, nil, "-log", logPath, "-log-level", "loud"); code != 1 || !strings.Contains(stderr, "invalid log level") {
+		t.Errorf("-log-level loud: exit code %d, stderr %q, want 1 and an invalid level error", code, stderr)
+	}
+}
+
+func TestJSONLogEvents(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "src", "a.txt"), "alpha")
+	writeFile(t, filepath.Join(dir, "list.txt"), "[files]\n*\n")
+
+	// The archive is written inside the search directory, where it is
+	// found and skipped
+	_, stderr, code := runMain(t, dir, nil, "-d", "src", "-l", "list.txt", "-p", "src", "-n", "out.zip",
+		"-log-json", "-log-level", "debug")
+	if code != 0 {
+		t.Fatalf("exit code %d, stderr %q", code, stderr)
+	}
+
+	events := make(map[string]map[string]any)
+	for _, line := range strings.Split(strings.TrimSpace(stderr), "\n") {
+		var record map[string]any
+		if err := json.Unmarshal([]byte(line), &record); err != nil {
+			t.Fatalf("log line %q is not JSON: %v", line, err)
+		}
+		events[record["msg"].(string)] = record
+	}
+	tests := []struct {
+		event, level string
+		fields       []string
+	}{
+		{"file_added", "DEBUG", []string{"time", "path", "name", "size", "rule"}},
+		{"file_skipped", "INFO", []string{"time", "path", "reason"}},
+		{"run_complete", "INFO", []string{"time", "output", "files", "skipped"}},
+	}
+	for _, test := range tests {
+		record, ok := events[test.event]
+		if !ok {
+			t.Errorf("no %s event in %q", test.event, stderr)
+			continue
+		}
+		if record["level"] != test.level {
+			t.Errorf("%s logged at %v, want %s", test.event, record["level"], test.level)
+		}
+		for _, field := range test.fields {
+			if _, ok := record[field]; !ok {
+				t.Errorf("%s event lacks %q: %v", test.event, field, record)
+			}
+		}
+	}
+	if added := events["file_added"]; added != nil && (added["path"] != filepath.Join("src", "a.txt") || added["size"] != float64(5) || added["rule"] != "name") {
+		t.Errorf("file_added event %v, want src/a.txt of 5 bytes matched by name", added)
+	}
+	if skipped := events["file_skipped"]; skipped != nil && skipped["reason"] != "output archive" {
+		t.Errorf("file_skipped event %v, want the output archive", skipped)
+	}
+	if complete := events["run_complete"]; complete != nil && complete["files"] != float64(1) {
+		t.Errorf("run_complete event %v, want 1 file", complete)
+	}
+}
+
+func TestSummaryJSON(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "src", "a.txt"), "alpha")
+	writeFile(t, filepath.Join(dir, "src", "b.txt"), "bravo!")
+	writeFile(t, filepath.Join(dir, "list.txt"), "[files]\n*.txt\nmissing.md\n")
+
+	tests := []struct {
+		args []string
+		out  string
+	}{
+		{[]string{"-n", "out.zip"}, "out.zip"},
+		// The listing goes to stderr, so stdout still parses
+		{[]string{"-dry-run"}, ""},
+		{[]string{"-n", "verbose.zip", "-v"}, "verbose.zip"},
+	}
+	for _, test := range tests {
+		args := append([]string{"-d", "src", "-l", "list.txt", "-p", dir, "-summary-json"}, test.args...)
+		stdout, stderr, code := runMain(t, dir, nil, args...)
+		if code != 0 {
+			t.Fatalf("%q: exit code %d, stderr %q", test.args, code, stderr)
+		}
+		var summary runSummary
+		if err := json.Unmarshal([]byte(stdout), &summary); err != nil {
+			t.Errorf("%q: stdout %q is not one JSON object: %v", test.args, stdout, err)
+			continue
+		}
+		if summary.FilesAdded != 2 || summary.BytesIn != 11 || summary.Unmatched != 1 || summary.Skipped != 0 {
+			t.Errorf("%q: summary %+v, want 2 files of 11 bytes and 1 unmatched entry", test.args, summary)
+		}
+		if test.out != "" && summary.BytesOut == 0 {
+			t.Errorf("%q: summary %+v, want the compressed size", test.args, summary)
+		}
+		if test.out == "" && !strings.Contains(stderr, filepath.Join("src", "a.txt")) {
+			t.Errorf("%q: stderr %q lacks the dry-run listing", test.args, stderr)
+		}
+		if strings.Contains(stderr, "Archived ") {
+			t.Errorf("%q: the summary line was printed as well: %q", test.args, stderr)
+		}
+	}
+
+	if _, stderr, code := runMain(t, dir, nil, "-d", "src", "-l", "list.txt", "-n", "-", "-summary-json"); code != 1 || !strings.Contains(stderr, "-summary-json") {
+		t.Errorf("-summary-json -n -: exit code %d, stderr %q, want 1 and an error", code, stderr)
+	}
+}
+
+func TestExcludeLargerThanOnDiskFlag(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "src", "big.bin"), strings.Repeat("x", 64<<10))
+	writeFile(t, filepath.Join(dir, "src", "small.txt"), "small")
+	writeFile(t, filepath.Join(dir, "list.txt"), "[files]\n*\n")
+
+	stdout, stderr, code := runMain(t, dir, nil, "-d", "src", "-l", "list.txt", "-dry-run", "-exclude-larger-than-on-disk", "16KB")
+	if code != 0 {
+		t.Fatalf("exit code %d, stderr %q", code, stderr)
+	}
+	if !strings.Contains(stdout, "small.txt") || strings.Contains(stdout, "big.bin") {
+		t.Errorf("stdout %q, want small.txt listed without big.bin", stdout)
+	}
+
+	if _, stderr, code := runMain(t, dir, nil, "-exclude-larger-than-on-disk", "huge"); code != 2 || !strings.Contains(stderr, "exclude-larger-than-on-disk") {
+		t.Errorf("invalid size: exit code %d, stderr %q, want a usage error", code, stderr)
+	}
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// passwordFlag is a flag.Value for -password. Given as -password=secret it
+// holds the password; given alone it requests an interactive prompt. Being
+// a boolean flag, it never takes the following argument as its value, so
+// main rejects "-password secret".
+type passwordFlag struct {
+	value  string
+	prompt bool
+}
+
+func (p *passwordFlag) String() string {
+	return ""
+}
+
+func (p *passwordFlag) Set(value string) error {
+	if value == "true" {
+		p.prompt = true
+		return nil
+	}
+	p.value = value
+	return nil
+}
+
+// IsBoolFlag lets the flag be given without a value.
+func (p *passwordFlag) IsBoolFlag() bool {
+	return true
+}
+
+// promptPassword asks for a password on the terminal, hiding the input where
+// stty is available. It reads from standard input when no terminal is
+// attached.
+func promptPassword() (string, error) {
+	input := os.Stdin
+	if tty, err := os.Open("/dev/tty"); err == nil {
+		defer tty.Close()
+		input = tty
+
+		if err := stty(tty, "-echo"); err == nil {
+			defer stty(tty, "echo")
+		}
+	}
+
+	fmt.Fprint(os.Stderr, "Password: ")
+	line, err := bufio.NewReader(input).ReadString('\n')
+	fmt.Fprintln(os.Stderr)
+	if err != nil && line == "" {
+		return "", fmt.Errorf("failed to read password: %w", err)
+	}
+
+	password := strings.TrimRight(line, "\r\n")
+	if password == "" {
+		return "", fmt.Errorf("the password must not be empty")
+	}
+	return password, nil
+}
+
+// stty runs stty with the given setting on the terminal tty.
+func stty(tty *os.File, setting string) error {
+	cmd := exec.Command("stty", setting)
+	cmd.Stdin = tty
+	return cmd.Run()
+}
@@ -0,0 +1,223 @@
+package pathfinder
+
+import (
+	"archive/zip"
+	"compress/flate"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/binary"
+	"fmt"
+	"hash"
+	"io"
+	"time"
+)
+
+// WinZip AES encryption (AE-2) constants, see
+// https://www.winzip.com/en/support/aes-encryption/
+const (
+	aesMethod        = 99
+	aesExtraID       = 0x9901
+	aesVendorVersion = 2 // AE-2: the CRC is not stored
+	aesStrength256   = 3
+	aesKeySize       = 32
+	aesSaltSize      = 16
+	aesVerifierSize  = 2
+	aesMACSize       = 10
+	aesIterations    = 1000
+	aesReaderVersion = 51
+)
+
+// addEncrypted writes an AES-256 encrypted entry. The content is compressed
+// with the configured method first and encrypted in a single pass.
+func (a *zipArchiver) addEncrypted(header *zip.FileHeader, r io.Reader) error {
+	method := header.Method
+
+	header.Method = aesMethod
+	header.Flags |= 0x1 | 0x8 // encrypted, sizes follow in a data descriptor
+	header.CreatorVersion = header.CreatorVersion&0xff00 | aesReaderVersion
+	header.ReaderVersion = aesReaderVersion
+	header.ModifiedDate, header.ModifiedTime = msDosTime(header.Modified)
+	header.Extra = append(header.Extra, aesExtraField(method)...)
+
+	entry, err := a.writer.CreateRaw(header)
+	if err != nil {
+		return fmt.Errorf("failed to create entry in zip file: %w", err)
+	}
+
+	encrypter, err := newAESWriter(entry, a.password)
+	if err != nil {
+		return err
+	}
+
+	var compressor io.WriteCloser = nopWriteCloser{encrypter}
+	if method == zip.Deflate {
+		compressor, err = flate.NewWriter(encrypter, a.level)
+		if err != nil {
+			return err
+		}
+	}
+
+	size, err := io.Copy(compressor, r)
+	if err != nil {
+		return fmt.Errorf("failed to copy file content to zip archive: %w", err)
+	}
+	if err := compressor.Close(); err != nil {
+		return fmt.Errorf("failed to compress file content: %w", err)
+	}
+	if err := encrypter.Close(); err != nil {
+		return fmt.Errorf("failed to encrypt file content: %w", err)
+	}
+
+	// The sizes are written in the data descriptor and central directory
+	// once the next entry is created or the archive is closed
+	header.UncompressedSize64 = uint64(size)
+	header.CompressedSize64 = uint64(encrypter.written)
+	header.UncompressedSize = uint32(min(header.UncompressedSize64, uint64(^uint32(0))))
+	header.CompressedSize = uint32(min(header.CompressedSize64, uint64(^uint32(0))))
+	return nil
+}
+
+// aesExtraField returns the AES extra field recording the real compression
+// method of an encrypted entry.
+func aesExtraField(method uint16) []byte {
+	field := make([]byte, 11)
+	binary.LittleEndian.PutUint16(field[0:], aesExtraID)
+	binary.LittleEndian.PutUint16(field[2:], 7)
+	binary.LittleEndian.PutUint16(field[4:], aesVendorVersion)
+	copy(field[6:], "AE")
+	field[8] = aesStrength256
+	binary.LittleEndian.PutUint16(field[9:], method)
+	return field
+}
+
+// aesWriter encrypts data with AES-256 in WinZip's CTR mode and appends an
+// HMAC-SHA1 authentication code on Close.
+type aesWriter struct {
+	w         io.Writer
+	block     cipher.Block
+	mac       hash.Hash
+	counter   uint64
+	keystream [aes.BlockSize]byte
+	pos       int
+	written   int64
+}
+
+// newAESWriter derives the keys for password and writes the salt and
+// password verifier to w.
+func newAESWriter(w io.Writer, password string) (*aesWriter, error) {
+	salt := make([]byte, aesSaltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, fmt.Errorf("failed to generate salt: %w", err)
+	}
+
+	keys := pbkdf2SHA1([]byte(password), salt, aesIterations, 2*aesKeySize+aesVerifierSize)
+	block, err := aes.NewCipher(keys[:aesKeySize])
+	if err != nil {
+		return nil, err
+	}
+
+	a := &aesWriter{
+		w:     w,
+		block: block,
+		mac:   hmac.New(sha1.New, keys[aesKeySize:2*aesKeySize]),
+		pos:   aes.BlockSize,
+	}
+	if err := a.writeRaw(salt); err != nil {
+		return nil, err
+	}
+	if err := a.writeRaw(keys[2*aesKeySize:]); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+func (a *aesWriter) Write(p []byte) (int, error) {
+	encrypted := make([]byte, len(p))
+	for i, b := range p {
+		if a.pos == aes.BlockSize {
+			a.nextKeystream()
+		}
+		encrypted[i] = b ^ a.keystream[a.pos]
+		a.pos++
+	}
+
+	a.mac.Write(encrypted)
+	if err := a.writeRaw(encrypted); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// Close writes the authentication code. It does not close the underlying
+// writer.
+func (a *aesWriter) Close() error {
+	return a.writeRaw(a.mac.Sum(nil)[:aesMACSize])
+}
+
+// nextKeystream encrypts the next counter block. WinZip uses a little-endian
+// counter starting at 1.
+func (a *aesWriter) nextKeystream() {
+	a.counter++
+	var counter [aes.BlockSize]byte
+	binary.LittleEndian.PutUint64(counter[:], a.counter)
+	a.block.Encrypt(a.keystream[:], counter[:])
+	a.pos = 0
+}
+
+func (a *aesWriter) writeRaw(p []byte) error {
+	n, err := a.w.Write(p)
+	a.written += int64(n)
+	return err
+}
+
+// pbkdf2SHA1 derives a key of keyLen bytes from password and salt using
+// PBKDF2 with HMAC-SHA1, as specified in RFC 8018.
+func pbkdf2SHA1(password, salt []byte, iterations, keyLen int) []byte {
+	prf := hmac.New(sha1.New, password)
+	hashLen := prf.Size()
+	blocks := (keyLen + hashLen - 1) / hashLen
+
+	var index [4]byte
+	key := make([]byte, 0, blocks*hashLen)
+	u := make([]byte, hashLen)
+	for block := 1; block <= blocks; block++ {
+		prf.Reset()
+		prf.Write(salt)
+		binary.BigEndian.PutUint32(index[:], uint32(block))
+		prf.Write(index[:])
+		key = prf.Sum(key)
+
+		t := key[len(key)-hashLen:]
+		copy(u, t)
+		for i := 1; i < iterations; i++ {
+			prf.Reset()
+			prf.Write(u)
+			u = prf.Sum(u[:0])
+			for j := range u {
+				t[j] ^= u[j]
+			}
+		}
+	}
+	return key[:keyLen]
+}
+
+// msDosTime converts t to the MS-DOS date and time fields used by zip
+// headers. Raw entries do not get them filled in by archive/zip.
+func msDosTime(t time.Time) (date, clock uint16) {
+	if t.Year() < 1980 {
+		t = time.Date(1980, 1, 1, 0, 0, 0, 0, time.UTC)
+	}
+	date = uint16(t.Day() + int(t.Month())<<5 + (t.Year()-1980)<<9)
+	clock = uint16(t.Second()/2 + t.Minute()<<5 + t.Hour()<<11)
+	return date, clock
+}
+
+// nopWriteCloser adds a no-op Close to a writer.
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error { return nil }
@@ -0,0 +1,189 @@
+package pathfinder
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/flate"
+	"crypto/aes"
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/binary"
+	"encoding/hex"
+	"io"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+// RFC 6070 test vectors, leaving out the one with 16777216 iterations.
+func TestPBKDF2SHA1(t *testing.T) {
+	tests := []struct {
+		password, salt string
+		iterations     int
+		want           string
+	}{
+		{"password", "salt", 1, "0c60c80f961f0e71f3a9b524af6012062fe037a6"},
+		{"password", "salt", 2, "ea6c014dc72d6f8ccd1ed92ace1d41f0d8de8957"},
+		{"password", "salt", 4096, "4b007901b765489abead49d926f721d065a429c1"},
+		{"passwordPASSWORDpassword", "saltSALTsaltSALTsaltSALTsaltSALTsalt", 4096,
+			"3d2eec4fe41c849b80c8d83662c0e44a8b291a964cf2f07038"},
+		{"pass\x00word", "sa\x00lt", 4096, "56fa6aa75548099dcc37d7f03425e0c3"},
+	}
+	for _, test := range tests {
+		want, _ := hex.DecodeString(test.want)
+		got := pbkdf2SHA1([]byte(test.password), []byte(test.salt), test.iterations, len(want))
+		if !bytes.Equal(got, want) {
+			t.Errorf("pbkdf2SHA1(%q, %q, %d) = %x, want %x", test.password, test.salt, test.iterations, got, want)
+		}
+	}
+}
+
+// decryptAES decrypts the raw data of a WinZip AE-2 entry, checking the
+// password verifier and the authentication code. It reports false when the
+// password is wrong.
+func decryptAES(t *testing.T, raw []byte, password string) ([]byte, bool) {
+	t.Helper()
+	if len(raw) < aesSaltSize+aesVerifierSize+aesMACSize {
+		t.Fatalf("encrypted entry of %d bytes is too short", len(raw))
+	}
+	salt := raw[:aesSaltSize]
+	verifier := raw[aesSaltSize : aesSaltSize+aesVerifierSize]
+	data := raw[aesSaltSize+aesVerifierSize : len(raw)-aesMACSize]
+	mac := raw[len(raw)-aesMACSize:]
+
+	keys := pbkdf2SHA1([]byte(password), salt, aesIterations, 2*aesKeySize+aesVerifierSize)
+	if !bytes.Equal(keys[2*aesKeySize:], verifier) {
+		return nil, false
+	}
+
+	authenticator := hmac.New(sha1.New, keys[aesKeySize:2*aesKeySize])
+	authenticator.Write(data)
+	if !bytes.Equal(authenticator.Sum(nil)[:aesMACSize], mac) {
+		t.Fatal("authentication code does not match")
+	}
+
+	block, err := aes.NewCipher(keys[:aesKeySize])
+	if err != nil {
+		t.Fatal(err)
+	}
+	plain := make([]byte, len(data))
+	var counter, keystream [aes.BlockSize]byte
+	for i := range data {
+		if i%aes.BlockSize == 0 {
+			binary.LittleEndian.PutUint64(counter[:], uint64(i/aes.BlockSize+1))
+			block.Encrypt(keystream[:], counter[:])
+		}
+		plain[i] = data[i] ^ keystream[i%aes.BlockSize]
+	}
+	return plain, true
+}
+
+func TestEncryptedArchiveNeedsPassword(t *testing.T) {
+	dir := t.TempDir()
+	content := bytes.Repeat([]byte("secret content "), 100)
+	writeFile(t, filepath.Join(dir, "src", "secret.txt"), string(content))
+	writeFile(t, filepath.Join(dir, "list.txt"), "[files]\nsecret.txt\n")
+
+	cfg := DefaultConfig()
+	cfg.Directories = []string{filepath.Join(dir, "src")}
+	cfg.ListFile = filepath.Join(dir, "list.txt")
+	cfg.OutputPath = dir
+	cfg.OutputName = "out.zip"
+	cfg.Password = "correct horse"
+	cfg.Workers = 1
+	cfg.Output = io.Discard
+
+	result, err := Run(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reader, err := zip.OpenReader(result.OutputPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+	if len(reader.File) != 1 {
+		t.Fatalf("archive holds %d entries, want 1", len(reader.File))
+	}
+	file := reader.File[0]
+
+	// Without the password the content cannot be read
+	if file.Method != aesMethod {
+		t.Fatalf("entry method = %d, want %d", file.Method, aesMethod)
+	}
+	if _, err := file.Open(); err == nil {
+		t.Error("encrypted entry opened without a password")
+	}
+	raw, err := file.OpenRaw()
+	if err != nil {
+		t.Fatal(err)
+	}
+	encrypted, err := io.ReadAll(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(encrypted, []byte("secret")) {
+		t.Error("encrypted entry holds the plain text")
+	}
+	if _, ok := decryptAES(t, encrypted, "wrong"); ok {
+		t.Error("wrong password passed the verifier")
+	}
+
+	// With it the content comes back
+	compressed, ok := decryptAES(t, encrypted, cfg.Password)
+	if !ok {
+		t.Fatal("password verifier does not match")
+	}
+	if uint64(len(compressed)) != file.CompressedSize64-aesSaltSize-aesVerifierSize-aesMACSize {
+		t.Errorf("decrypted %d bytes, header says %d", len(compressed), file.CompressedSize64)
+	}
+	plain, err := io.ReadAll(flate.NewReader(bytes.NewReader(compressed)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(plain, content) {
+		t.Errorf("decrypted content = %q, want %q", plain, content)
+	}
+	if uint64(len(plain)) != file.UncompressedSize64 {
+		t.Errorf("uncompressed size = %d, want %d", file.UncompressedSize64, len(plain))
+	}
+}
+
+// libarchive reads WinZip AES entries, so bsdtar checks that the archive is
+// understood by other tools.
+func TestEncryptedArchiveOtherTools(t *testing.T) {
+	bsdtar, err := exec.LookPath("bsdtar")
+	if err != nil {
+		t.Skip("bsdtar is not installed")
+	}
+
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "src", "secret.txt"), "secret content")
+	writeFile(t, filepath.Join(dir, "list.txt"), "[files]\nsecret.txt\n")
+
+	cfg := DefaultConfig()
+	cfg.Directories = []string{filepath.Join(dir, "src")}
+	cfg.ListFile = filepath.Join(dir, "list.txt")
+	cfg.OutputPath = dir
+	cfg.OutputName = "out.zip"
+	cfg.Password = "correct horse"
+	cfg.Workers = 1
+	cfg.Output = io.Discard
+
+	result, err := Run(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	out, err := exec.Command(bsdtar, "--passphrase", cfg.Password, "-xOf", result.OutputPath).Output()
+	if err != nil {
+		t.Fatalf("bsdtar failed: %v", err)
+	}
+	if string(out) != "secret content" {
+		t.Errorf("bsdtar extracted %q, want %q", out, "secret content")
+	}
+	if err := exec.Command(bsdtar, "--passphrase", "wrong", "-xOf", result.OutputPath).Run(); err == nil {
+		t.Error("bsdtar extracted the entry with a wrong password")
+	}
+}
@@ -0,0 +1,48 @@
+package pathfinder
+
+import (
+	"archive/zip"
+	"fmt"
+	"os"
+)
+
+// appendArchive starts a new archive holding the entries of the existing zip
+// archive at path, so that matched files are added to them. Like any other
+// archive it is written to a temporary file that replaces the original when
+// the archive is closed.
+func (f *finder) appendArchive(path string) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return fmt.Errorf("failed to open archive to append to: %w", err)
+	}
+	reader, err := zip.OpenReader(path)
+	if err != nil {
+		return fmt.Errorf("failed to open archive to append to: %w", err)
+	}
+	defer reader.Close()
+
+	f.outputInfos = append(f.outputInfos, info)
+
+	temp, err := f.createTemp(info.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	if err := f.openArchiver(temp); err != nil {
+		temp.Close()
+		f.discardTemp()
+		return err
+	}
+
+	// Copy the existing entries without recompressing them and remember
+	// their names, so matched files do not shadow them
+	writer := f.archiver.(*zipArchiver).writer
+	f.existingNames = make(map[string]struct{}, len(reader.File))
+	for _, file := range reader.File {
+		if err := writer.Copy(file); err != nil {
+			f.discardTemp()
+			return fmt.Errorf("failed to copy %s from existing archive: %w", file.Name, err)
+		}
+		f.existingNames[file.Name] = struct{}{}
+	}
+	return nil
+}
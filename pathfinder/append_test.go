@@ -0,0 +1,129 @@
+package pathfinder
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"io"
+	"maps"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeZip writes a zip archive at path holding files.
+func writeZip(t *testing.T, path string, files map[string]string) {
+	t.Helper()
+	var buf bytes.Buffer
+	writer := zip.NewWriter(&buf)
+	for name, content := range files {
+		entry, err := writer.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := io.WriteString(entry, content); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, buf.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestAppendKeepsExistingEntries(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "src", "a.txt"), "new alpha")
+	writeFile(t, filepath.Join(dir, "src", "new.txt"), "new")
+	writeFile(t, filepath.Join(dir, "list.txt"), "[files]\n*.txt\n")
+	writeZip(t, filepath.Join(dir, "backup.zip"), map[string]string{"a.txt": "old alpha", "old/b.txt": "bravo"})
+
+	var errOutput bytes.Buffer
+	cfg := DefaultConfig()
+	cfg.Directories = []string{filepath.Join(dir, "src")}
+	cfg.ListFile = filepath.Join(dir, "list.txt")
+	cfg.OutputPath = dir
+	cfg.OutputName = "backup.zip"
+	cfg.Append = true
+	cfg.Output = io.Discard
+	cfg.ErrOutput = &errOutput
+
+	result, err := Run(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.FilesAdded != 1 {
+		t.Errorf("added %d files, want 1", result.FilesAdded)
+	}
+	files := readZip(t, filepath.Join(dir, "backup.zip"))
+	want := map[string]string{"a.txt": "old alpha", "old/b.txt": "bravo", "new.txt": "new"}
+	if len(files) != len(want) {
+		t.Errorf("archive holds %v, want %v", files, want)
+	}
+	for name, content := range want {
+		if files[name] != content {
+			t.Errorf("%s holds %q, want %q", name, files[name], content)
+		}
+	}
+	if !strings.Contains(errOutput.String(), "skipping a.txt, already in archive") {
+		t.Errorf("the name clash was not reported: %q", errOutput.String())
+	}
+
+	// Nothing to append to is an error, not a new archive
+	cfg.OutputName = "missing.zip"
+	if _, err := Run(cfg); err == nil {
+		t.Error("appending to a missing archive succeeded")
+	}
+}
+
+func TestAppendUnderPrefix(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "src", "a.txt"), "new alpha")
+	writeFile(t, filepath.Join(dir, "src", "sub", "b.txt"), "bravo")
+	writeFile(t, filepath.Join(dir, "list.txt"), "[files]\n*.txt\n")
+	existing := map[string]string{"snapshots/2024/a.txt": "old alpha", "a.txt": "top alpha", "snapshots/2023/c.txt": "charlie"}
+
+	// Only the name under the prefix clashes, and the existing entry is kept
+	// either way
+	want := map[string]string{
+		"snapshots/2024/a.txt": "old alpha", "a.txt": "top alpha", "snapshots/2023/c.txt": "charlie",
+		"snapshots/2024/sub/b.txt": "bravo",
+	}
+	for _, failOnExisting := range []bool{false, true} {
+		writeZip(t, filepath.Join(dir, "archive.zip"), existing)
+
+		var errOutput bytes.Buffer
+		cfg := DefaultConfig()
+		cfg.Directories = []string{filepath.Join(dir, "src")}
+		cfg.ListFile = filepath.Join(dir, "list.txt")
+		cfg.OutputPath = dir
+		cfg.OutputName = "archive.zip"
+		cfg.Append = true
+		cfg.Prefix = "/snapshots/2024/"
+		cfg.FailOnExisting = failOnExisting
+		cfg.Output = io.Discard
+		cfg.ErrOutput = &errOutput
+
+		result, err := Run(cfg)
+		if failOnExisting {
+			if !errors.Is(err, ErrSkipped) || len(result.Skipped) != 1 || !strings.Contains(result.Skipped[0].Err.Error(), "snapshots/2024/a.txt is already in the archive") {
+				t.Errorf("failing on existing entries: error %v, skipped %v, want a.txt skipped as already in the archive", err, result.Skipped)
+			}
+		} else {
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !strings.Contains(errOutput.String(), "skipping snapshots/2024/a.txt, already in archive") {
+				t.Errorf("the name clash was not reported: %q", errOutput.String())
+			}
+		}
+
+		files := readZip(t, filepath.Join(dir, "archive.zip"))
+		if !maps.Equal(files, want) {
+			t.Errorf("FailOnExisting %v: archive holds %v, want %v", failOnExisting, files, want)
+		}
+	}
+}
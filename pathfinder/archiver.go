@@ -0,0 +1,225 @@
+package pathfinder
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bufio"
+	"compress/flate"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+)
+
+// Archiver writes files into an output archive.
+type Archiver interface {
+	// AddFile stores the contents of r under name in the archive.
+	AddFile(name string, r io.Reader, info os.FileInfo) error
+	// Close flushes the archive and closes the underlying file.
+	Close() error
+}
+
+// countingWriter passes writes through to an io.WriteCloser and counts the
+// bytes written, which gives the size of the finished archive.
+type countingWriter struct {
+	io.WriteCloser
+	written int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.WriteCloser.Write(p)
+	c.written += int64(n)
+	return n, err
+}
+
+// stdoutWriter buffers writes to standard output. Closing it flushes the
+// buffer but leaves standard output open.
+type stdoutWriter struct {
+	*bufio.Writer
+}
+
+func newStdoutWriter() stdoutWriter {
+	return stdoutWriter{bufio.NewWriter(os.Stdout)}
+}
+
+func (s stdoutWriter) Close() error {
+	return s.Flush()
+}
+
+// defaultStoreExtensions are the extensions of formats that are compressed
+// already, which zip archives store rather than deflate again.
+var defaultStoreExtensions = []string{
+	"jpg", "jpeg", "png", "gif", "webp", "heic",
+	"mp3", "aac", "ogg", "flac", "mp4", "m4a", "m4v", "mkv", "mov", "avi", "webm",
+	"zip", "gz", "tgz", "bz2", "xz", "zst", "7z", "rar", "jar",
+	"docx", "xlsx", "pptx", "odt", "ods", "odp", "epub",
+}
+
+// newArchiver returns an Archiver for the given format writing to file,
+// which it closes when the Archiver is closed.
+// level is a flate compression level; 0 stores entries uncompressed. Zip
+// entries with one of storeExtensions are stored uncompressed at any level.
+// A non-empty password encrypts zip entries with AES-256.
+func newArchiver(format string, file io.WriteCloser, level int, password string, storeExtensions []string) (Archiver, error) {
+	if password != "" && format != "zip" {
+		return nil, fmt.Errorf("encryption is only supported for zip archives")
+	}
+
+	switch format {
+	case "zip":
+		method := zip.Deflate
+		if level == flate.NoCompression {
+			method = zip.Store
+		}
+		archiver := &zipArchiver{
+			file:            file,
+			writer:          zip.NewWriter(file),
+			method:          method,
+			level:           level,
+			password:        password,
+			storeExtensions: storeExtensions,
+		}
+		archiver.writer.RegisterCompressor(zip.Deflate, func(w io.Writer) (io.WriteCloser, error) {
+			compressor, err := flate.NewWriter(w, level)
+			archiver.compressor = compressor
+			return compressor, err
+		})
+		return archiver, nil
+	case "tar":
+		return &tarArchiver{file: file, writer: tar.NewWriter(file)}, nil
+	case "tgz":
+		gzipWriter, err := gzip.NewWriterLevel(file, level)
+		if err != nil {
+			return nil, err
+		}
+		return &tarArchiver{file: file, gzip: gzipWriter, writer: tar.NewWriter(gzipWriter)}, nil
+	default:
+		return nil, fmt.Errorf("unsupported archive format %q", format)
+	}
+}
+
+// archiveExtension returns the file extension used for the given format.
+func archiveExtension(format string) string {
+	switch format {
+	case "tar":
+		return ".tar"
+	case "tgz":
+		return ".tar.gz"
+	default:
+		return ".zip"
+	}
+}
+
+type zipArchiver struct {
+	file     io.WriteCloser
+	writer   *zip.Writer
+	method   uint16
+	level    int
+	password string
+	// storeExtensions are stored with zip.Store regardless of method.
+	storeExtensions []string
+	// compressor is the compressor of the entry written last, so that flush
+	// can push out its pending output. It is nil when that entry was not
+	// deflated, as archive/zip closes the compressor of the entry before.
+	compressor *flate.Writer
+}
+
+func (a *zipArchiver) AddFile(name string, r io.Reader, info os.FileInfo) error {
+	header := &zip.FileHeader{
+		Name:     name,
+		Method:   a.method,
+		Modified: info.ModTime(),
+	}
+	header.SetMode(info.Mode())
+	if hasExtension(name, a.storeExtensions) {
+		header.Method = zip.Store
+	}
+	// Creating a deflated entry registers its compressor again
+	a.compressor = nil
+
+	// Directories have no content to compress or encrypt
+	if info.IsDir() {
+		header.Method = zip.Store
+		_, err := a.writer.CreateHeader(header)
+		return err
+	}
+
+	if a.password != "" {
+		return a.addEncrypted(header, r)
+	}
+
+	entry, err := a.writer.CreateHeader(header)
+	if err != nil {
+		return fmt.Errorf("failed to create entry in zip file: %w", err)
+	}
+
+	if _, err := io.Copy(entry, r); err != nil {
+		return fmt.Errorf("failed to copy file content to zip archive: %w", err)
+	}
+	return nil
+}
+
+func (a *zipArchiver) flush() error {
+	if a.compressor != nil {
+		if err := a.compressor.Flush(); err != nil {
+			return err
+		}
+	}
+	return a.writer.Flush()
+}
+
+func (a *zipArchiver) Close() error {
+	if err := a.writer.Close(); err != nil {
+		a.file.Close()
+		return fmt.Errorf("failed to close zip writer: %w", err)
+	}
+	return a.file.Close()
+}
+
+type tarArchiver struct {
+	file   io.WriteCloser
+	gzip   *gzip.Writer
+	writer *tar.Writer
+}
+
+func (a *tarArchiver) AddFile(name string, r io.Reader, info os.FileInfo) error {
+	// FileInfoHeader carries over the permission bits and modification time
+	header, err := tar.FileInfoHeader(info, "")
+	if err != nil {
+		return fmt.Errorf("failed to create tar header: %w", err)
+	}
+	header.Name = name
+
+	if err := a.writer.WriteHeader(header); err != nil {
+		return fmt.Errorf("failed to write tar header: %w", err)
+	}
+
+	if _, err := io.Copy(a.writer, r); err != nil {
+		return fmt.Errorf("failed to copy file content to tar archive: %w", err)
+	}
+	return nil
+}
+
+func (a *tarArchiver) flush() error {
+	if err := a.writer.Flush(); err != nil {
+		return err
+	}
+	if a.gzip != nil {
+		return a.gzip.Flush()
+	}
+	return nil
+}
+
+func (a *tarArchiver) Close() error {
+	if err := a.writer.Close(); err != nil {
+		a.file.Close()
+		return fmt.Errorf("failed to close tar writer: %w", err)
+	}
+	if a.gzip != nil {
+		if err := a.gzip.Close(); err != nil {
+			a.file.Close()
+			return fmt.Errorf("failed to close gzip writer: %w", err)
+		}
+	}
+	return a.file.Close()
+}
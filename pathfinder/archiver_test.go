@@ -0,0 +1,225 @@
+package pathfinder
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+// readTgz returns the content and the header of every entry of the gzipped
+// tar archive at path by name, checking the gzip checksum on the way.
+func readTgz(t *testing.T, path string) (map[string]string, map[string]*tar.Header) {
+	t.Helper()
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	decompressor, err := gzip.NewReader(file)
+	if err != nil {
+		t.Fatalf("%s is not gzip compressed: %v", path, err)
+	}
+
+	contents := make(map[string]string)
+	headers := make(map[string]*tar.Header)
+	reader := tar.NewReader(decompressor)
+	for {
+		header, err := reader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("reading the tar archive in %s: %v", path, err)
+		}
+		content, err := io.ReadAll(reader)
+		if err != nil {
+			t.Fatalf("reading %s: %v", header.Name, err)
+		}
+		contents[header.Name] = string(content)
+		headers[header.Name] = header
+	}
+	// Reading to the end verifies the gzip checksum and size
+	if _, err := io.Copy(io.Discard, decompressor); err != nil {
+		t.Fatalf("%s has a broken gzip stream: %v", path, err)
+	}
+	return contents, headers
+}
+
+func TestTgzOutput(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "src", "a.txt"), "alpha")
+	writeFile(t, filepath.Join(dir, "src", "sub", "b.txt"), "bravo")
+	writeFile(t, filepath.Join(dir, "list.txt"), "[files]\n*.txt\n")
+
+	cfg := DefaultConfig()
+	cfg.Directories = []string{filepath.Join(dir, "src")}
+	cfg.ListFile = filepath.Join(dir, "list.txt")
+	cfg.OutputPath = dir
+	cfg.Format = "tgz"
+	cfg.Output = io.Discard
+
+	result, err := Run(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if filepath.Ext(result.OutputPath) != ".gz" {
+		t.Errorf("archive is named %s, want a .tar.gz name", result.OutputPath)
+	}
+	contents, _ := readTgz(t, result.OutputPath)
+	want := map[string]string{"a.txt": "alpha", "sub/b.txt": "bravo"}
+	if len(contents) != len(want) {
+		t.Errorf("archive holds %v, want %v", contents, want)
+	}
+	for name, content := range want {
+		if contents[name] != content {
+			t.Errorf("entry %s = %q, want %q", name, contents[name], content)
+		}
+	}
+}
+
+func TestModificationTimesArePreserved(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "src", "old.txt"), "old")
+	writeFile(t, filepath.Join(dir, "list.txt"), "[files]\nold.txt\n")
+	modified := time.Date(2015, 6, 1, 12, 30, 45, 0, time.UTC)
+	if err := os.Chtimes(filepath.Join(dir, "src", "old.txt"), modified, modified); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, format := range []string{"zip", "tgz"} {
+		cfg := DefaultConfig()
+		cfg.Directories = []string{filepath.Join(dir, "src")}
+		cfg.ListFile = filepath.Join(dir, "list.txt")
+		cfg.OutputPath = dir
+		cfg.OutputName = "out." + format
+		cfg.Format = format
+		cfg.Output = io.Discard
+
+		result, err := Run(cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got time.Time
+		if format == "zip" {
+			reader, err := zip.OpenReader(result.OutputPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got = reader.File[0].Modified
+			reader.Close()
+		} else {
+			_, headers := readTgz(t, result.OutputPath)
+			got = headers["old.txt"].ModTime
+		}
+		if !got.Equal(modified) {
+			t.Errorf("%s entry modified at %v, want %v", format, got, modified)
+		}
+	}
+}
+
+func TestPermissionsArePreserved(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Windows has no Unix permissions")
+	}
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "src", "run.sh"), "#!/bin/sh\n")
+	writeFile(t, filepath.Join(dir, "src", "data.txt"), "data")
+	if err := os.Chmod(filepath.Join(dir, "src", "run.sh"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chmod(filepath.Join(dir, "src", "data.txt"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, filepath.Join(dir, "list.txt"), "[files]\nrun.sh\ndata.txt\n")
+	want := map[string]os.FileMode{"run.sh": 0o755, "data.txt": 0o600}
+
+	for _, format := range []string{"zip", "tgz"} {
+		cfg := DefaultConfig()
+		cfg.Directories = []string{filepath.Join(dir, "src")}
+		cfg.ListFile = filepath.Join(dir, "list.txt")
+		cfg.OutputPath = dir
+		cfg.OutputName = "out." + format
+		cfg.Format = format
+		cfg.Output = io.Discard
+
+		result, err := Run(cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		modes := make(map[string]os.FileMode)
+		if format == "zip" {
+			reader, err := zip.OpenReader(result.OutputPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, file := range reader.File {
+				modes[file.Name] = file.Mode()
+			}
+			reader.Close()
+		} else {
+			_, headers := readTgz(t, result.OutputPath)
+			for name, header := range headers {
+				modes[name] = header.FileInfo().Mode()
+			}
+		}
+		for name, mode := range want {
+			if modes[name] != mode {
+				t.Errorf("%s entry %s has mode %v, want %v", format, name, modes[name], mode)
+			}
+		}
+	}
+}
+
+func TestCompressionLevels(t *testing.T) {
+	dir := t.TempDir()
+	content := strings.Repeat("compressible content ", 500)
+	writeFile(t, filepath.Join(dir, "src", "a.txt"), content)
+	writeFile(t, filepath.Join(dir, "list.txt"), "[files]\na.txt\n")
+
+	for _, level := range []int{0, 9} {
+		cfg := DefaultConfig()
+		cfg.Directories = []string{filepath.Join(dir, "src")}
+		cfg.ListFile = filepath.Join(dir, "list.txt")
+		cfg.OutputPath = dir
+		cfg.OutputName = fmt.Sprintf("level%d.zip", level)
+		cfg.Level = level
+		cfg.Output = io.Discard
+
+		result, err := Run(cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		reader, err := zip.OpenReader(result.OutputPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		file := reader.File[0]
+		reader.Close()
+
+		switch {
+		case level == 0 && (file.Method != zip.Store || file.CompressedSize64 != uint64(len(content))):
+			t.Errorf("level 0 wrote method %d and %d bytes, want the content stored as is", file.Method, file.CompressedSize64)
+		case level == 9 && (file.Method != zip.Deflate || file.CompressedSize64 >= uint64(len(content))/10):
+			t.Errorf("level 9 wrote method %d and %d bytes, want it deflated", file.Method, file.CompressedSize64)
+		}
+		if entries := readZip(t, result.OutputPath); entries["a.txt"] != content {
+			t.Errorf("level %d entry does not read back", level)
+		}
+	}
+
+	cfg := DefaultConfig()
+	cfg.Directories = []string{filepath.Join(dir, "src")}
+	cfg.ListFile = filepath.Join(dir, "list.txt")
+	cfg.Level = 10
+	if _, err := Run(cfg); err == nil {
+		t.Error("level 10 was accepted")
+	}
+}
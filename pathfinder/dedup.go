@@ -0,0 +1,59 @@
+package pathfinder
+
+import (
+	"archive/tar"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+)
+
+// linker is implemented by the archivers to store an entry that refers to
+// the content of an entry written earlier, see Config.DedupContent.
+type linker interface {
+	addLink(name, target string, info os.FileInfo) error
+}
+
+// addLink stores name as a symbolic link to target, since zip has no hard
+// links. The link is relative, so it resolves wherever the archive is
+// extracted. Like directories, links are never compressed or encrypted.
+func (a *zipArchiver) addLink(name, target string, info os.FileInfo) error {
+	return a.addSymlink(name, relativeLink(name, target), info)
+}
+
+// addLink stores name as a hard link to the entry target.
+func (a *tarArchiver) addLink(name, target string, info os.FileInfo) error {
+	header, err := tar.FileInfoHeader(info, "")
+	if err != nil {
+		return fmt.Errorf("failed to create tar header: %w", err)
+	}
+	header.Name = name
+	header.Typeflag = tar.TypeLink
+	header.Linkname = target
+	header.Size = 0
+
+	if err := a.writer.WriteHeader(header); err != nil {
+		return fmt.Errorf("failed to write tar header: %w", err)
+	}
+	return nil
+}
+
+// relativeLink returns the path of the entry target relative to the
+// directory of the entry name.
+func relativeLink(name, target string) string {
+	from := strings.Split(path.Dir(name), "/")
+	to := strings.Split(target, "/")
+	if from[0] == "." {
+		from = nil
+	}
+
+	common := 0
+	for common < len(from) && common < len(to)-1 && from[common] == to[common] {
+		common++
+	}
+	parts := make([]string, 0, len(from)-common+len(to)-common)
+	for range from[common:] {
+		parts = append(parts, "..")
+	}
+	return path.Join(append(parts, to[common:]...)...)
+}
@@ -0,0 +1,76 @@
+package pathfinder
+
+import (
+	"archive/tar"
+	"io"
+	"maps"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDedupContent(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "src")
+	shared := strings.Repeat("shared content ", 100)
+	writeFile(t, filepath.Join(src, "a", "orig.txt"), shared)
+	writeFile(t, filepath.Join(src, "b", "copy.txt"), shared)
+	writeFile(t, filepath.Join(src, "c.txt"), "different")
+	writeFile(t, filepath.Join(dir, "list.txt"), "[files]\n*.txt\n")
+
+	for _, format := range []string{"zip", "tgz"} {
+		cfg := DefaultConfig()
+		cfg.Directories = []string{src}
+		cfg.ListFile = filepath.Join(dir, "list.txt")
+		cfg.OutputPath = dir
+		cfg.OutputName = "out." + format
+		cfg.Format = format
+		cfg.DedupContent = true
+		cfg.Output = io.Discard
+
+		result, err := Run(cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result.FilesAdded != 3 {
+			t.Errorf("%s: added %d files, want 3", format, result.FilesAdded)
+		}
+
+		if format == "zip" {
+			files := readZip(t, result.OutputPath)
+			if files["a/orig.txt"] != shared || files["c.txt"] != "different" {
+				t.Errorf("zip: unexpected contents %v", files)
+			}
+			// The copy is a relative symlink holding only the target name
+			if links, want := zipLinks(t, result.OutputPath), map[string]string{"b/copy.txt": "../a/orig.txt"}; !maps.Equal(links, want) {
+				t.Errorf("zip: links %v, want %v", links, want)
+			}
+			continue
+		}
+
+		files, headers := readTgz(t, result.OutputPath)
+		if files["a/orig.txt"] != shared || files["b/copy.txt"] != "" {
+			t.Errorf("tgz: the shared content is not stored once: %q", files)
+		}
+		if header := headers["b/copy.txt"]; header == nil || header.Typeflag != tar.TypeLink || header.Linkname != "a/orig.txt" {
+			t.Errorf("tgz: b/copy.txt has header %+v, want a hard link to a/orig.txt", header)
+		}
+	}
+}
+
+func TestRelativeLink(t *testing.T) {
+	tests := []struct {
+		name, target, want string
+	}{
+		{"copy.txt", "orig.txt", "orig.txt"},
+		{"b/copy.txt", "a/orig.txt", "../a/orig.txt"},
+		{"a/copy.txt", "a/orig.txt", "orig.txt"},
+		{"a/b/c/copy.txt", "a/orig.txt", "../../orig.txt"},
+		{"copy.txt", "a/b/orig.txt", "a/b/orig.txt"},
+	}
+	for _, test := range tests {
+		if got := relativeLink(test.name, test.target); got != test.want {
+			t.Errorf("relativeLink(%q, %q) = %q, want %q", test.name, test.target, got, test.want)
+		}
+	}
+}
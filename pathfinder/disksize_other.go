@@ -0,0 +1,11 @@
+//go:build !unix
+
+package pathfinder
+
+import "os"
+
+// diskSize returns the size of the file described by info, since the space
+// it takes on disk is not available on this platform.
+func diskSize(info os.FileInfo) int64 {
+	return info.Size()
+}
@@ -0,0 +1,19 @@
+//go:build unix
+
+package pathfinder
+
+import (
+	"os"
+	"syscall"
+)
+
+// diskSize returns the space the file described by info takes on disk,
+// which is less than its size for sparse files.
+func diskSize(info os.FileInfo) int64 {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return info.Size()
+	}
+	// Blocks counts 512-byte units whatever the file system's block size
+	return int64(stat.Blocks) * 512
+}
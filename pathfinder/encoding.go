@@ -0,0 +1,59 @@
+package pathfinder
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"unicode/utf16"
+)
+
+// Byte order marks some editors put at the start of text files.
+var (
+	utf8BOM    = []byte{0xEF, 0xBB, 0xBF}
+	utf16LEBOM = []byte{0xFF, 0xFE}
+	utf16BEBOM = []byte{0xFE, 0xFF}
+)
+
+// decodeList returns a reader of the UTF-8 content of a list file. A leading
+// UTF-8 byte order mark is dropped, and files starting with a UTF-16 byte
+// order mark, as saved by some Windows editors, are transcoded. Anything
+// else is read as UTF-8.
+func decodeList(r io.Reader) (io.Reader, error) {
+	buffered := bufio.NewReader(r)
+	start, _ := buffered.Peek(3)
+
+	switch {
+	case bytes.HasPrefix(start, utf8BOM):
+		buffered.Discard(len(utf8BOM))
+		return buffered, nil
+	case bytes.HasPrefix(start, utf16LEBOM):
+		return decodeUTF16(buffered, binary.LittleEndian)
+	case bytes.HasPrefix(start, utf16BEBOM):
+		return decodeUTF16(buffered, binary.BigEndian)
+	}
+	return buffered, nil
+}
+
+// decodeUTF16 transcodes UTF-16 text in the given byte order, starting with
+// its byte order mark, to UTF-8.
+func decodeUTF16(r io.Reader, order binary.ByteOrder) (io.Reader, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("error reading list file: %w", err)
+	}
+	if len(data)%2 != 0 {
+		return nil, fmt.Errorf("error reading list file: truncated UTF-16 text")
+	}
+
+	units := make([]uint16, 0, len(data)/2-1)
+	for i := 2; i < len(data); i += 2 {
+		units = append(units, order.Uint16(data[i:]))
+	}
+	var decoded bytes.Buffer
+	for _, r := range utf16.Decode(units) {
+		decoded.WriteRune(r)
+	}
+	return &decoded, nil
+}
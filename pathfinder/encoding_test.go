@@ -0,0 +1,62 @@
+package pathfinder
+
+import (
+	"bytes"
+	"encoding/binary"
+	"path/filepath"
+	"slices"
+	"testing"
+	"unicode/utf16"
+)
+
+// encodeUTF16 encodes s as UTF-16 in the given byte order, with a byte order
+// mark.
+func encodeUTF16(s string, order binary.ByteOrder) []byte {
+	var buf bytes.Buffer
+	for _, unit := range utf16.Encode(append([]rune{0xFEFF}, []rune(s)...)) {
+		binary.Write(&buf, order, unit)
+	}
+	return buf.Bytes()
+}
+
+func TestListEncodings(t *testing.T) {
+	content := "[files]\r\nrésumé.txt\r\n[paths]\r\nconf/b.ini\r\n[exclude]\r\n*.tmp\r\n"
+	encodings := map[string][]byte{
+		"utf8.txt":    []byte(content),
+		"utf8bom.txt": append(slices.Clone(utf8BOM), content...),
+		"utf16le.txt": encodeUTF16(content, binary.LittleEndian),
+		"utf16be.txt": encodeUTF16(content, binary.BigEndian),
+	}
+	if !bytes.HasPrefix(encodings["utf16le.txt"], utf16LEBOM) || !bytes.HasPrefix(encodings["utf16be.txt"], utf16BEBOM) {
+		t.Fatal("encodeUTF16 wrote no byte order mark")
+	}
+
+	dir := t.TempDir()
+	for name, data := range encodings {
+		writeFile(t, filepath.Join(dir, name), string(data))
+		list, err := readTextFile([]string{filepath.Join(dir, name)}, false, false)
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+			continue
+		}
+		if want := []string{"résumé.txt"}; !slices.Equal(list.fileNames, want) {
+			t.Errorf("%s: [files] = %q, want %q", name, list.fileNames, want)
+		}
+		if want := []string{filepath.Join("conf", "b.ini")}; !slices.Equal(list.filePaths, want) {
+			t.Errorf("%s: [paths] = %q, want %q", name, list.filePaths, want)
+		}
+		if want := []string{"*.tmp"}; !slices.Equal(list.excludes, want) {
+			t.Errorf("%s: [exclude] = %q, want %q", name, list.excludes, want)
+		}
+		if len(list.unknownSections) > 0 {
+			t.Errorf("%s: unknown sections %q", name, list.unknownSections)
+		}
+	}
+
+	// An odd number of bytes cannot be UTF-16
+	truncated := encodings["utf16le.txt"]
+	writeFile(t, filepath.Join(dir, "truncated.txt"), string(truncated[:len(truncated)-1]))
+	if _, err := readTextFile([]string{filepath.Join(dir, "truncated.txt")}, false, false); err == nil {
+		t.Error("a truncated UTF-16 list was read")
+	}
+}
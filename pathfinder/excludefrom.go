@@ -0,0 +1,35 @@
+package pathfinder
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// readExcludeFile appends the patterns in filename, one per line, to the
+// [exclude] section of list, like tar's --exclude-from. Blank lines and
+// comments are skipped as in list files.
+func readExcludeFile(list *sections, filename string) error {
+	file, err := os.Open(filename)
+	if err != nil {
+		return fmt.Errorf("error opening exclude file: %w", err)
+	}
+	defer file.Close()
+
+	sizes := list.sectionSizes()
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if isBlankOrComment(line) {
+			continue
+		}
+		list.excludes = append(list.excludes, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("error reading exclude file: %w", err)
+	}
+
+	list.noteOrigins(filename, sizes)
+	return nil
+}
@@ -0,0 +1,39 @@
+package pathfinder
+
+import (
+	"io"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestExcludeFrom(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "src")
+	for _, name := range []string{"a.txt", "debug.log", "keep.log", "scratch.tmp", "old.bak", "cache/c.txt", "sub/b.txt"} {
+		writeFile(t, filepath.Join(src, filepath.FromSlash(name)), name)
+	}
+	writeFile(t, filepath.Join(dir, "list.txt"), "[files]\n*\n[exclude]\n*.tmp\n")
+	writeFile(t, filepath.Join(dir, "ignore.txt"), "# shared ignore file\n\n*.log\n  "+
+		filepath.Join(src, "cache")+"  \n!keep.log\n")
+
+	cfg := DefaultConfig()
+	cfg.Directories = []string{src}
+	cfg.ListFile = filepath.Join(dir, "list.txt")
+	cfg.ExcludeFrom = []string{filepath.Join(dir, "ignore.txt")}
+	cfg.ExcludeRegexes = []string{`\.bak$`}
+	cfg.Output = io.Discard
+
+	// The file's globs, path prefixes and negations join the [exclude]
+	// section and the regular expressions
+	if got, want := matchNames(t, cfg, src), []string{"a.txt", "keep.log", "sub/b.txt"}; !slices.Equal(got, want) {
+		t.Errorf("matched %v, want %v", got, want)
+	}
+
+	cfg.ExcludeFrom = []string{filepath.Join(dir, "missing.txt")}
+	cfg.OutputPath = dir
+	if _, err := Run(cfg); err == nil || !strings.Contains(err.Error(), "exclude file") {
+		t.Errorf("missing exclude file: error %v, want one naming the exclude file", err)
+	}
+}
@@ -0,0 +1,106 @@
+package pathfinder
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"path"
+	"time"
+)
+
+// extrasDir is the top-level archive directory holding the entries Pathfinder
+// writes about the run itself rather than about matched files.
+const extrasDir = ".pathfinder"
+
+// listEntryName is the entry IncludeList stores the effective list under.
+var listEntryName = path.Join(extrasDir, "list.txt")
+
+// addListEntry stores the effective list, with included and merged list
+// files flattened into one, in the text list format.
+func (f *finder) addListEntry() error {
+	var list bytes.Buffer
+	printSections(&list, &f.sections)
+	return f.addGeneratedEntry(listEntryName, list.Bytes())
+}
+
+// metadataEntryName is the entry Metadata stores the run metadata under.
+var metadataEntryName = path.Join(extrasDir, "metadata.json")
+
+// runMetadata is the content of the metadata entry.
+type runMetadata struct {
+	Flags   map[string]string `json:"flags"`
+	Started time.Time         `json:"started"`
+	Host    string            `json:"host"`
+	User    string            `json:"user"`
+	Version string            `json:"version"`
+	// Files and Bytes count the matched files stored in the archive and
+	// their total size, Skipped the matched files that could not be stored.
+	Files   int   `json:"files"`
+	Bytes   int64 `json:"bytes"`
+	Skipped int   `json:"skipped"`
+}
+
+// addMetadataEntry stores the metadata of the run started at started.
+func (f *finder) addMetadataEntry(started time.Time) error {
+	flags := f.cfg.Flags
+	if flags == nil {
+		flags = map[string]string{}
+	}
+	metadata := runMetadata{
+		Flags:   flags,
+		Started: started,
+		Host:    hostName(),
+		User:    userName(),
+		Version: f.cfg.ToolVersion,
+		Files:   f.result.FilesAdded,
+		Bytes:   f.result.BytesUncompressed,
+		Skipped: len(f.result.Skipped),
+	}
+	data, err := json.MarshalIndent(metadata, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode metadata: %w", err)
+	}
+	return f.addGeneratedEntry(metadataEntryName, append(data, '\n'))
+}
+
+// addGeneratedEntry stores content under name in the archive. The name is
+// fixed, so Prefix does not apply. An entry of that name kept from the
+// archive appended to is left as it is.
+func (f *finder) addGeneratedEntry(name string, content []byte) error {
+	if _, ok := f.existingNames[name]; ok {
+		if f.cfg.Verbose {
+			fmt.Fprintf(f.cfg.Output, "Skipping %s, already in archive\n", name)
+		}
+		return nil
+	}
+	if err := f.prepareVolume(name, int64(len(content))); err != nil {
+		return err
+	}
+
+	info := generatedInfo{name: path.Base(name), size: int64(len(content)), modTime: time.Now()}
+	if f.cfg.Reproducible {
+		info.modTime = f.entryTime
+	}
+	if err := f.archiver.AddFile(name, bytes.NewReader(content), info); err != nil {
+		return fmt.Errorf("error adding %s to archive: %w", name, err)
+	}
+	if f.cfg.Verbose {
+		fmt.Fprintf(f.cfg.Output, "Added %s\n", name)
+	}
+	return nil
+}
+
+// generatedInfo describes an entry whose content Pathfinder generated.
+type generatedInfo struct {
+	name    string
+	size    int64
+	modTime time.Time
+}
+
+func (i generatedInfo) Name() string       { return i.name }
+func (i generatedInfo) Size() int64        { return i.size }
+func (i generatedInfo) Mode() fs.FileMode  { return 0o644 }
+func (i generatedInfo) ModTime() time.Time { return i.modTime }
+func (i generatedInfo) IsDir() bool        { return false }
+func (i generatedInfo) Sys() any           { return nil }
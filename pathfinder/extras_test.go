@@ -0,0 +1,109 @@
+package pathfinder
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestIncludeListEntry(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "src", "a.txt"), "alpha")
+	writeFile(t, filepath.Join(dir, "src", "b.ini"), "bravo")
+	writeFile(t, filepath.Join(dir, "main.txt"), "[files]\na.txt\n@include shared.txt\n[exclude]\n*.tmp\n")
+	writeFile(t, filepath.Join(dir, "shared.txt"), "[files]\n*.ini\n")
+
+	cfg := DefaultConfig()
+	cfg.Directories = []string{filepath.Join(dir, "src")}
+	cfg.ListFile = filepath.Join(dir, "main.txt")
+	cfg.OutputPath = dir
+	cfg.OutputName = "out.zip"
+	cfg.IncludeList = true
+	cfg.Output = io.Discard
+
+	if _, err := Run(cfg); err != nil {
+		t.Fatal(err)
+	}
+	files := readZip(t, filepath.Join(dir, "out.zip"))
+	list, ok := files[listEntryName]
+	if !ok {
+		t.Fatalf("archive lacks %s: %v", listEntryName, files)
+	}
+	// The include is flattened into the effective list, noting where each
+	// entry came from
+	main, shared := filepath.Join(dir, "main.txt"), filepath.Join(dir, "shared.txt")
+	want := "[files]\n# from " + main + "\na.txt\n# from " + shared + "\n*.ini\n" +
+		"[paths]\n[directories]\n[exclude]\n# from " + main + "\n*.tmp\n[regex]\n"
+	if list != want {
+		t.Errorf("%s holds %q, want %q", listEntryName, list, want)
+	}
+	if len(files) != 3 {
+		t.Errorf("archive holds %d entries, want a.txt, b.ini and the list", len(files))
+	}
+
+	// A list that includes itself fails before an archive is written
+	writeFile(t, filepath.Join(dir, "shared.txt"), "[files]\n*.ini\n@include main.txt\n")
+	cfg.OutputName = "cycle.zip"
+	if _, err := Run(cfg); err == nil || !strings.Contains(err.Error(), "include cycle detected") {
+		t.Errorf("include cycle: error %v, want an include cycle", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "cycle.zip")); !os.IsNotExist(err) {
+		t.Errorf("an archive was written for a list with an include cycle: %v", err)
+	}
+}
+
+func TestMetadataEntry(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "src", "a.txt"), "alpha")
+	writeFile(t, filepath.Join(dir, "src", "b.txt"), "bravo!")
+	writeFile(t, filepath.Join(dir, "list.txt"), "[files]\n*.txt\n")
+
+	cfg := DefaultConfig()
+	cfg.Directories = []string{filepath.Join(dir, "src")}
+	cfg.ListFile = filepath.Join(dir, "list.txt")
+	cfg.OutputPath = dir
+	cfg.OutputName = "out.zip"
+	cfg.Metadata = true
+	cfg.ToolVersion = "pathfinder 1.2.0"
+	cfg.Flags = map[string]string{"d": "src", "password": "(redacted)"}
+	cfg.Output = io.Discard
+
+	before := time.Now()
+	if _, err := Run(cfg); err != nil {
+		t.Fatal(err)
+	}
+	files := readZip(t, filepath.Join(dir, "out.zip"))
+	data, ok := files[metadataEntryName]
+	if !ok {
+		t.Fatalf("archive lacks %s: %v", metadataEntryName, files)
+	}
+	var metadata runMetadata
+	if err := json.Unmarshal([]byte(data), &metadata); err != nil {
+		t.Fatalf("%s is not valid JSON: %v", metadataEntryName, err)
+	}
+
+	want := runMetadata{
+		Flags:   cfg.Flags,
+		Started: metadata.Started,
+		Host:    hostName(),
+		User:    userName(),
+		Version: "pathfinder 1.2.0",
+		Files:   2,
+		Bytes:   11,
+	}
+	if !reflect.DeepEqual(metadata, want) {
+		t.Errorf("metadata = %+v, want %+v", metadata, want)
+	}
+	if metadata.Started.Before(before.Add(-time.Second)) || metadata.Started.After(time.Now()) {
+		t.Errorf("metadata started at %v, want the time of the run", metadata.Started)
+	}
+	// The metadata entry is not counted among the archived files
+	if len(files) != 3 {
+		t.Errorf("archive holds %d entries, want the two files and the metadata", len(files))
+	}
+}
@@ -0,0 +1,112 @@
+package pathfinder
+
+import (
+	"fmt"
+	"io/fs"
+	"math"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// passesFilters reports whether a matched file satisfies the extension, size
+// and modification time filters. It applies to every rule, after the file
+// has been matched. The file is only stat'ed when a size or time filter is
+// set; a file that cannot be stat'ed does not pass.
+func (f *finder) passesFilters(d fs.DirEntry) bool {
+	if len(f.cfg.Extensions) > 0 && !hasExtension(d.Name(), f.cfg.Extensions) {
+		return false
+	}
+	if hasExtension(d.Name(), f.cfg.ExcludeExtensions) {
+		return false
+	}
+	if f.cfg.MinSize <= 0 && f.cfg.MaxSize <= 0 && f.cfg.MaxDiskSize <= 0 && f.cfg.ModifiedAfter.IsZero() && f.cfg.ModifiedBefore.IsZero() {
+		return true
+	}
+
+	info, err := d.Info()
+	if err != nil {
+		return false
+	}
+	if f.cfg.MinSize > 0 && info.Size() < f.cfg.MinSize {
+		return false
+	}
+	if f.cfg.MaxSize > 0 && info.Size() > f.cfg.MaxSize {
+		return false
+	}
+	if f.cfg.MaxDiskSize > 0 && diskSize(info) > f.cfg.MaxDiskSize {
+		return false
+	}
+	if !f.cfg.ModifiedAfter.IsZero() && !info.ModTime().After(f.cfg.ModifiedAfter) {
+		return false
+	}
+	if !f.cfg.ModifiedBefore.IsZero() && !info.ModTime().Before(f.cfg.ModifiedBefore) {
+		return false
+	}
+	return true
+}
+
+// hasExtension reports whether name ends in one of extensions. Extensions
+// are compared case-insensitively and may be given with or without the
+// leading dot.
+func hasExtension(name string, extensions []string) bool {
+	ext := strings.TrimPrefix(filepath.Ext(name), ".")
+	if ext == "" {
+		return false
+	}
+	for _, candidate := range extensions {
+		if strings.EqualFold(ext, strings.TrimPrefix(candidate, ".")) {
+			return true
+		}
+	}
+	return false
+}
+
+// sizeUnits maps size suffixes to their multiplier. Units are powers of 1024.
+var sizeUnits = []struct {
+	suffix     string
+	multiplier int64
+}{
+	{"TB", 1 << 40}, {"GB", 1 << 30}, {"MB", 1 << 20}, {"KB", 1 << 10},
+	{"T", 1 << 40}, {"G", 1 << 30}, {"M", 1 << 20}, {"K", 1 << 10},
+	{"B", 1},
+}
+
+// ParseSize parses a human readable size such as "512", "10KB" or "1.5G".
+// Units are case-insensitive and powers of 1024.
+func ParseSize(s string) (int64, error) {
+	value := strings.ToUpper(strings.TrimSpace(s))
+	multiplier := int64(1)
+	for _, unit := range sizeUnits {
+		if strings.HasSuffix(value, unit.suffix) {
+			value = strings.TrimSpace(strings.TrimSuffix(value, unit.suffix))
+			multiplier = unit.multiplier
+			break
+		}
+	}
+
+	// ParseFloat also accepts "Inf" and "NaN", which are no sizes
+	number, err := strconv.ParseFloat(value, 64)
+	if err != nil || number < 0 || math.IsInf(number, 0) || math.IsNaN(number) {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+	size := number * float64(multiplier)
+	if size >= math.MaxInt64 {
+		return 0, fmt.Errorf("size %q is too large", s)
+	}
+	return int64(size), nil
+}
+
+// ParseTime parses an RFC 3339 timestamp, or a duration such as "24h" that
+// is taken relative to now, i.e. "24h" means 24 hours before now.
+func ParseTime(s string, now time.Time) (time.Time, error) {
+	value := strings.TrimSpace(s)
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	if d, err := time.ParseDuration(value); err == nil {
+		return now.Add(-d), nil
+	}
+	return time.Time{}, fmt.Errorf("invalid time %q: expected an RFC 3339 timestamp or a duration", s)
+}
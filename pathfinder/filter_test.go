@@ -0,0 +1,211 @@
+package pathfinder
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseSize(t *testing.T) {
+	tests := []struct {
+		in   string
+		want int64
+	}{
+		{"0", 0},
+		{"512", 512},
+		{"512B", 512},
+		{"10KB", 10 << 10},
+		{"10kb", 10 << 10},
+		{"1.5M", 3 << 19},
+		{" 5 MB ", 5 << 20},
+		{"2G", 2 << 30},
+		{"1TB", 1 << 40},
+		{"8388607TB", 8388607 << 40},
+	}
+	for _, test := range tests {
+		got, err := ParseSize(test.in)
+		if err != nil {
+			t.Errorf("ParseSize(%q) failed: %v", test.in, err)
+		} else if got != test.want {
+			t.Errorf("ParseSize(%q) = %d, want %d", test.in, got, test.want)
+		}
+	}
+}
+
+func TestParseSizeInvalid(t *testing.T) {
+	for _, in := range []string{"", "MB", "ten", "-1", "-5KB", "10XB", "1.2.3", "inf", "+Inf", "NaN", "1e30GB", "8388608TB", "9223372036854775808"} {
+		if size, err := ParseSize(in); err == nil {
+			t.Errorf("ParseSize(%q) = %d, want an error", in, size)
+		} else if !strings.Contains(err.Error(), "size") {
+			t.Errorf("ParseSize(%q) error %q does not say what is wrong", in, err)
+		}
+	}
+}
+
+func TestSizeBoundaries(t *testing.T) {
+	dir := t.TempDir()
+	for name, size := range map[string]int{"empty.txt": 0, "min.txt": 10, "below.txt": 9, "max.txt": 100, "above.txt": 101} {
+		writeFile(t, filepath.Join(dir, "src", name), strings.Repeat("x", size))
+	}
+	writeFile(t, filepath.Join(dir, "list.txt"), "[files]\n*.txt\n")
+
+	var matched []string
+	cfg := DefaultConfig()
+	cfg.Directories = []string{filepath.Join(dir, "src")}
+	cfg.ListFile = filepath.Join(dir, "list.txt")
+	cfg.MinSize = 10
+	cfg.MaxSize = 100
+	cfg.Output = io.Discard
+
+	results, errs := Matches(context.Background(), cfg)
+	for file := range results {
+		matched = append(matched, filepath.Base(file.Path))
+	}
+	if err := <-errs; err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(matched)
+	if want := []string{"max.txt", "min.txt"}; !slices.Equal(matched, want) {
+		t.Errorf("matched %v, want %v", matched, want)
+	}
+}
+
+func TestModificationTimeFilters(t *testing.T) {
+	dir := t.TempDir()
+	base := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	for name, age := range map[string]time.Duration{"old.txt": 72 * time.Hour, "mid.txt": 24 * time.Hour, "new.txt": time.Hour} {
+		path := filepath.Join(dir, "src", name)
+		writeFile(t, path, name)
+		if err := os.Chtimes(path, base.Add(-age), base.Add(-age)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writeFile(t, filepath.Join(dir, "list.txt"), "[files]\n*.txt\n")
+
+	tests := []struct {
+		after, before string
+		want          []string
+	}{
+		{"", "", []string{"mid.txt", "new.txt", "old.txt"}},
+		{"48h", "", []string{"mid.txt", "new.txt"}},
+		{"", "12h", []string{"mid.txt", "old.txt"}},
+		{"48h", "12h", []string{"mid.txt"}},
+		{"2024-05-31T12:00:00Z", "", []string{"new.txt"}},
+		{"", "2024-05-29T12:00:00Z", nil},
+	}
+	for _, test := range tests {
+		cfg := DefaultConfig()
+		cfg.Directories = []string{filepath.Join(dir, "src")}
+		cfg.ListFile = filepath.Join(dir, "list.txt")
+		cfg.Output = io.Discard
+		var err error
+		if test.after != "" {
+			if cfg.ModifiedAfter, err = ParseTime(test.after, base); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if test.before != "" {
+			if cfg.ModifiedBefore, err = ParseTime(test.before, base); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		var matched []string
+		results, errs := Matches(context.Background(), cfg)
+		for file := range results {
+			matched = append(matched, filepath.Base(file.Path))
+		}
+		if err := <-errs; err != nil {
+			t.Fatal(err)
+		}
+		sort.Strings(matched)
+		if !slices.Equal(matched, test.want) {
+			t.Errorf("after %q, before %q: matched %v, want %v", test.after, test.before, matched, test.want)
+		}
+	}
+}
+
+func TestParseTimeInvalid(t *testing.T) {
+	if _, err := ParseTime("yesterday", time.Now()); err == nil {
+		t.Error("ParseTime accepted \"yesterday\"")
+	}
+}
+
+func TestExtensionFilters(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"a.go", "b.GO", "c.txt", "d.Txt", "e", "f.go.bak"} {
+		writeFile(t, filepath.Join(dir, "src", name), name)
+	}
+	writeFile(t, filepath.Join(dir, "list.txt"), "[files]\n*\n")
+
+	tests := []struct {
+		include, exclude []string
+		want             []string
+	}{
+		{[]string{"go"}, nil, []string{"a.go", "b.GO"}},
+		{[]string{".go"}, nil, []string{"a.go", "b.GO"}},
+		{[]string{"Go", ".TXT"}, nil, []string{"a.go", "b.GO", "c.txt", "d.Txt"}},
+		{nil, []string{".txt", "BAK"}, []string{"a.go", "b.GO", "e"}},
+		{[]string{"go", "txt"}, []string{".Txt"}, []string{"a.go", "b.GO"}},
+	}
+	for _, test := range tests {
+		cfg := DefaultConfig()
+		cfg.Directories = []string{filepath.Join(dir, "src")}
+		cfg.ListFile = filepath.Join(dir, "list.txt")
+		cfg.Extensions = test.include
+		cfg.ExcludeExtensions = test.exclude
+		cfg.Output = io.Discard
+
+		if got := matchNames(t, cfg, filepath.Join(dir, "src")); !slices.Equal(got, test.want) {
+			t.Errorf("extensions %q, excluded %q: matched %v, want %v", test.include, test.exclude, got, test.want)
+		}
+	}
+}
+
+func TestDiskSizeFilter(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "src")
+	writeFile(t, filepath.Join(src, "dense.bin"), strings.Repeat("x", 2<<20))
+	writeFile(t, filepath.Join(src, "small.txt"), "small")
+	sparse := filepath.Join(src, "sparse.bin")
+	writeFile(t, sparse, "head")
+	if err := os.Truncate(sparse, 64<<20); err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(sparse)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diskSize(info) >= info.Size() {
+		t.Skip("the file system or platform does not report sparse files")
+	}
+	writeFile(t, filepath.Join(dir, "list.txt"), "[files]\n*\n")
+
+	tests := []struct {
+		maxSize, maxDiskSize int64
+		want                 []string
+	}{
+		{0, 0, []string{"dense.bin", "small.txt", "sparse.bin"}},
+		// The sparse file is large by its apparent size only
+		{1 << 20, 0, []string{"small.txt"}},
+		{0, 1 << 20, []string{"small.txt", "sparse.bin"}},
+	}
+	for _, test := range tests {
+		cfg := DefaultConfig()
+		cfg.Directories = []string{src}
+		cfg.ListFile = filepath.Join(dir, "list.txt")
+		cfg.MaxSize = test.maxSize
+		cfg.MaxDiskSize = test.maxDiskSize
+		cfg.Output = io.Discard
+
+		if got := matchNames(t, cfg, src); !slices.Equal(got, test.want) {
+			t.Errorf("MaxSize %d, MaxDiskSize %d: matched %v, want %v", test.maxSize, test.maxDiskSize, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,177 @@
+package pathfinder
+
+import (
+	"bufio"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// gitignorePattern is a single rule of a .gitignore file.
+type gitignorePattern struct {
+	// segments are the slash-separated parts of the pattern, where "**"
+	// matches any number of path segments.
+	segments []string
+	negate   bool
+	dirOnly  bool
+}
+
+// parseGitignoreLine parses a line of a .gitignore file. ok is false for
+// blank lines and comments.
+func parseGitignoreLine(line string) (pattern gitignorePattern, ok bool) {
+	line = strings.TrimSuffix(line, "\r")
+	if line == "" || strings.HasPrefix(line, "#") {
+		return pattern, false
+	}
+
+	// Trailing spaces are ignored unless escaped
+	for strings.HasSuffix(line, " ") && !strings.HasSuffix(line, "\\ ") {
+		line = line[:len(line)-1]
+	}
+	if strings.HasPrefix(line, "!") {
+		pattern.negate = true
+		line = line[1:]
+	} else if strings.HasPrefix(line, "\\!") || strings.HasPrefix(line, "\\#") {
+		line = line[1:]
+	}
+	if strings.HasSuffix(line, "/") {
+		pattern.dirOnly = true
+		line = strings.TrimSuffix(line, "/")
+	}
+	if line == "" {
+		return pattern, false
+	}
+
+	// A pattern without a slash matches at any depth, one with a slash is
+	// relative to the directory of the .gitignore file
+	if strings.Contains(line, "/") {
+		pattern.segments = strings.Split(strings.TrimPrefix(line, "/"), "/")
+	} else {
+		pattern.segments = []string{"**", line}
+	}
+	return pattern, true
+}
+
+// matches reports whether the slash-separated path rel, relative to the
+// directory of the .gitignore file, is matched by the pattern.
+func (p gitignorePattern) matches(rel string, isDir bool) bool {
+	if p.dirOnly && !isDir {
+		return false
+	}
+	return matchSegments(p.segments, strings.Split(rel, "/"))
+}
+
+// matchSegments matches path segments against pattern segments, where a
+// "**" pattern segment matches zero or more path segments. As in git, a
+// trailing "**" matches one or more, so "a/**" matches what is inside a but
+// not a itself.
+func matchSegments(patterns, segments []string) bool {
+	if len(patterns) == 0 {
+		return len(segments) == 0
+	}
+	if len(patterns) == 1 && patterns[0] == "**" {
+		return len(segments) > 0
+	}
+	if patterns[0] == "**" {
+		for i := 0; i <= len(segments); i++ {
+			if matchSegments(patterns[1:], segments[i:]) {
+				return true
+			}
+		}
+		return false
+	}
+	if len(segments) == 0 {
+		return false
+	}
+	matched, err := path.Match(patterns[0], segments[0])
+	if err != nil || !matched {
+		return false
+	}
+	return matchSegments(patterns[1:], segments[1:])
+}
+
+// gitignored reports whether path is ignored by the .gitignore files of the
+// directories between the current search directory and path. Files inside
+// an ignored directory are ignored as well.
+func (f *finder) gitignored(path string, isDir bool) bool {
+	root := filepath.Clean(f.directory)
+	path = filepath.Clean(path)
+	rel, err := filepath.Rel(root, path)
+	if err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return false
+	}
+
+	parent := filepath.Dir(path)
+	if parent != root && f.dirIgnored(parent) {
+		return true
+	}
+	return f.matchGitignores(path, isDir)
+}
+
+// dirIgnored reports whether the directory dir is ignored, remembering the
+// answer since every file below dir asks again.
+func (f *finder) dirIgnored(dir string) bool {
+	if ignored, ok := f.ignoredDirs[dir]; ok {
+		return ignored
+	}
+	ignored := f.gitignored(dir, true)
+	if f.ignoredDirs == nil {
+		f.ignoredDirs = make(map[string]bool)
+	}
+	f.ignoredDirs[dir] = ignored
+	return ignored
+}
+
+// matchGitignores applies the .gitignore files from the search directory down
+// to the parent of path. Within a file the last matching pattern decides,
+// and deeper files override the ones above them.
+func (f *finder) matchGitignores(path string, isDir bool) bool {
+	root := filepath.Clean(f.directory)
+
+	var dirs []string
+	for dir := filepath.Dir(path); ; dir = filepath.Dir(dir) {
+		dirs = append(dirs, dir)
+		if dir == root || dir == filepath.Dir(dir) {
+			break
+		}
+	}
+
+	ignored := false
+	for i := len(dirs) - 1; i >= 0; i-- {
+		rel, err := filepath.Rel(dirs[i], path)
+		if err != nil {
+			continue
+		}
+		rel = filepath.ToSlash(rel)
+		for _, pattern := range f.loadGitignore(dirs[i]) {
+			if pattern.matches(rel, isDir) {
+				ignored = !pattern.negate
+			}
+		}
+	}
+	return ignored
+}
+
+// loadGitignore returns the patterns of the .gitignore file in dir, reading
+// it on first use. A missing or unreadable file has no patterns.
+func (f *finder) loadGitignore(dir string) []gitignorePattern {
+	if patterns, ok := f.gitignores[dir]; ok {
+		return patterns
+	}
+	if f.gitignores == nil {
+		f.gitignores = make(map[string][]gitignorePattern)
+	}
+
+	var patterns []gitignorePattern
+	if file, err := f.open(filepath.Join(dir, ".gitignore")); err == nil {
+		scanner := bufio.NewScanner(file)
+		for scanner.Scan() {
+			if pattern, ok := parseGitignoreLine(scanner.Text()); ok {
+				patterns = append(patterns, pattern)
+			}
+		}
+		file.Close()
+	}
+	f.gitignores[dir] = patterns
+	return patterns
+}
@@ -0,0 +1,81 @@
+package pathfinder
+
+import (
+	"context"
+	"io"
+	"path/filepath"
+	"slices"
+	"sort"
+	"testing"
+)
+
+func TestRespectGitignore(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "src")
+	writeFile(t, filepath.Join(src, ".gitignore"), "*.log\n/build/**\n!build/keep.txt\n")
+	writeFile(t, filepath.Join(src, "a.txt"), "alpha")
+	writeFile(t, filepath.Join(src, "b.log"), "bravo")
+	writeFile(t, filepath.Join(src, "build", "keep.txt"), "charlie")
+	writeFile(t, filepath.Join(src, "build", "out.txt"), "delta")
+	writeFile(t, filepath.Join(src, "sub", ".gitignore"), "!*.log\n*.tmp\n")
+	writeFile(t, filepath.Join(src, "sub", "c.log"), "echo")
+	writeFile(t, filepath.Join(src, "sub", "d.tmp"), "foxtrot")
+	writeFile(t, filepath.Join(src, "other", "e.tmp"), "golf")
+	writeFile(t, filepath.Join(dir, "list.txt"), "[directories]\n"+src+"\n")
+
+	cfg := DefaultConfig()
+	cfg.Directories = []string{src}
+	cfg.ListFile = filepath.Join(dir, "list.txt")
+	cfg.RespectGitignore = true
+	cfg.Output = io.Discard
+
+	var matched []string
+	results, errs := Matches(context.Background(), cfg)
+	for file := range results {
+		rel, err := filepath.Rel(src, file.Path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		matched = append(matched, filepath.ToSlash(rel))
+	}
+	if err := <-errs; err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(matched)
+
+	// The nested .gitignore re-includes *.log below sub and ignores *.tmp
+	// there only. As in git, "build/**" leaves build itself alone, so a file
+	// below it can be re-included.
+	want := []string{".gitignore", "a.txt", "build/keep.txt", "other/e.tmp", "sub/.gitignore", "sub/c.log"}
+	if !slices.Equal(matched, want) {
+		t.Errorf("matched %v, want %v", matched, want)
+	}
+}
+
+func TestGitignorePatternMatches(t *testing.T) {
+	tests := []struct {
+		pattern, path string
+		isDir, want   bool
+	}{
+		{"*.log", "a.log", false, true},
+		{"*.log", "x/y/a.log", false, true},
+		{"/a.log", "x/a.log", false, false},
+		{"build/", "build", true, true},
+		{"build/", "build", false, false},
+		{"a/**/b", "a/b", false, true},
+		{"a/**/b", "a/x/y/b", false, true},
+		{"a/**", "a/x", false, true},
+		{"a/**", "a/x/y", false, true},
+		{"a/**", "a", true, false},
+		{"a/**", "a", false, false},
+	}
+	for _, test := range tests {
+		pattern, ok := parseGitignoreLine(test.pattern)
+		if !ok {
+			t.Fatalf("%q was not parsed as a pattern", test.pattern)
+		}
+		if got := pattern.matches(test.path, test.isDir); got != test.want {
+			t.Errorf("%q matches %q (dir %v) = %v, want %v", test.pattern, test.path, test.isDir, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,85 @@
+package pathfinder
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// jsonList is the structure of a JSON list file.
+type jsonList struct {
+	Files       []string `json:"files"`
+	Paths       []string `json:"paths"`
+	Directories []string `json:"directories"`
+	Exclude     []string `json:"exclude"`
+	Regex       []string `json:"regex"`
+}
+
+// isJSONList reports whether filename names a JSON list file.
+func isJSONList(filename string) bool {
+	return strings.EqualFold(filepath.Ext(filename), ".json")
+}
+
+// parseJSONList reads a JSON list file into list. Syntax and type errors
+// report the line and column they occurred at.
+func parseJSONList(list *sections, r io.Reader) error {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return fmt.Errorf("error reading JSON list: %w", err)
+	}
+
+	var parsed jsonList
+	if err := json.Unmarshal(data, &parsed); err != nil {
+		var syntaxErr *json.SyntaxError
+		var typeErr *json.UnmarshalTypeError
+		switch {
+		case errors.As(err, &syntaxErr):
+			line, column := lineAndColumn(data, syntaxErr.Offset)
+			return fmt.Errorf("error parsing JSON list at line %d, column %d: %w", line, column, err)
+		case errors.As(err, &typeErr):
+			line, column := lineAndColumn(data, typeErr.Offset)
+			return fmt.Errorf("error parsing JSON list at line %d, column %d: %w", line, column, err)
+		}
+		return fmt.Errorf("error parsing JSON list: %w", err)
+	}
+
+	// Unmarshal silently drops keys it does not know, which are most likely
+	// misspelled sections. It matches known keys ignoring case.
+	var keys map[string]json.RawMessage
+	if err := json.Unmarshal(data, &keys); err == nil {
+		names := make([]string, 0, len(keys))
+		for key := range keys {
+			names = append(names, key)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			if !slices.ContainsFunc(knownSections, func(known string) bool { return strings.EqualFold(known, name) }) {
+				list.noteSection(name)
+			}
+		}
+	}
+
+	list.fileNames = append(list.fileNames, parsed.Files...)
+	list.filePaths = append(list.filePaths, parsed.Paths...)
+	list.directories = append(list.directories, parsed.Directories...)
+	list.excludes = append(list.excludes, parsed.Exclude...)
+	list.regexes = append(list.regexes, parsed.Regex...)
+	return nil
+}
+
+// lineAndColumn converts a byte offset in data to a 1-based line and column.
+func lineAndColumn(data []byte, offset int64) (int, int) {
+	if offset > int64(len(data)) {
+		offset = int64(len(data))
+	}
+	before := data[:offset]
+	line := bytes.Count(before, []byte("\n")) + 1
+	column := len(before) - bytes.LastIndexByte(before, '\n')
+	return line, column
+}
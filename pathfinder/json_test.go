@@ -0,0 +1,79 @@
+package pathfinder
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestJSONListMatchesTextList(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "src")
+	writeFile(t, filepath.Join(dir, "list.txt"), "[files]\n*.txt\nit's.md\n"+
+		"[paths]\n"+filepath.Join(src, "conf", "b.ini")+"\n"+
+		"[directories]\n"+filepath.Join(src, "docs")+"\n"+
+		"[exclude]\n*.tmp\n"+
+		"[regex]\n^e\\.csv$\n")
+	data, err := json.MarshalIndent(map[string][]string{
+		"files":       {"*.txt", "it's.md"},
+		"paths":       {filepath.Join(src, "conf", "b.ini")},
+		"directories": {filepath.Join(src, "docs")},
+		"exclude":     {"*.tmp"},
+		"regex":       {`^e\.csv$`},
+	}, "", "  ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, filepath.Join(dir, "list.json"), string(data))
+
+	text, err := readTextFile([]string{filepath.Join(dir, "list.txt")}, false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed, err := readTextFile([]string{filepath.Join(dir, "list.json")}, false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, group := range parsed.sectionEntries() {
+		if want := text.sectionEntries()[i].entries; !slices.Equal(group.entries, want) {
+			t.Errorf("JSON [%s] = %q, want %q", group.section, group.entries, want)
+		}
+	}
+	if len(parsed.unknownSections) > 0 {
+		t.Errorf("unknown sections %q", parsed.unknownSections)
+	}
+}
+
+func TestJSONListErrors(t *testing.T) {
+	tests := []struct {
+		content, err string
+	}{
+		{"{\n  \"files\": [\"a.txt\",]\n}", "line 2, column 22"},
+		{"{\n  \"files\": \"a.txt\"\n}", "line 2, column 19"},
+		{"{\n  \"files\": [1]\n}", "line 2, column 14"},
+		{"[\"a.txt\"]", "line 1, column 2"},
+	}
+	for _, test := range tests {
+		var list sections
+		err := parseJSONList(&list, strings.NewReader(test.content))
+		if err == nil {
+			t.Errorf("%q parsed as %v, want an error", test.content, list.fileNames)
+		} else if !strings.Contains(err.Error(), test.err) {
+			t.Errorf("%q: error %q, want %q", test.content, err, test.err)
+		}
+	}
+
+	// Misspelled keys are reported like unknown sections
+	var list sections
+	if err := parseJSONList(&list, strings.NewReader(`{"Files": ["a.txt"], "fils": ["b.txt"]}`)); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"fils"}; !slices.Equal(list.unknownSections, want) {
+		t.Errorf("unknown sections %q, want %q", list.unknownSections, want)
+	}
+	if want := []string{"a.txt"}; !slices.Equal(list.fileNames, want) {
+		t.Errorf("files = %q, want %q", list.fileNames, want)
+	}
+}
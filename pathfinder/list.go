@@ -0,0 +1,389 @@
+package pathfinder
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// sections holds the entries of a list file grouped by section.
+type sections struct {
+	fileNames   []string
+	filePaths   []string
+	directories []string
+	excludes    []string
+	// regexes holds the [regex] entries, compiled by compileRegexes.
+	regexes []string
+
+	// unknownSections lists the section headers that are not recognized and
+	// whose lines were therefore ignored.
+	unknownSections []string
+
+	// origins maps each entry to the list file it was read from, and
+	// listFiles counts the list files read, including included ones.
+	origins   map[ruleKey]string
+	listFiles int
+
+	// resolvedPaths and resolvedDirectories count the leading [paths] and
+	// [directories] entries already passed through resolveEntries.
+	resolvedPaths, resolvedDirectories int
+}
+
+// knownSections are the section names a list file may use.
+var knownSections = []string{"files", "paths", "directories", "exclude", "regex"}
+
+// noteSection records name in unknownSections unless it is a known section
+// or was already recorded.
+func (list *sections) noteSection(name string) {
+	for _, known := range knownSections {
+		if name == known {
+			return
+		}
+	}
+	for _, unknown := range list.unknownSections {
+		if name == unknown {
+			return
+		}
+	}
+	list.unknownSections = append(list.unknownSections, name)
+}
+
+// includeDirective starts a line that reads another list file in place.
+const includeDirective = "@include "
+
+// readTextFile reads text files and categorizes lines into sections, the
+// entries of later files following those of earlier ones. A filename of "-"
+// reads the list from standard input. ".yaml", ".yml" and ".json" files are
+// read with parseYAMLList and parseJSONList instead. With relToList, relative
+// [paths] and [directories] entries are resolved against the directory of
+// the list file they appear in rather than the working directory. A
+// directory stands for the ".txt" files in it, read in order of their names.
+// With nullList, standard input is read with readNullList instead.
+func readTextFile(filenames []string, relToList, nullList bool) (sections, error) {
+	var list sections
+	for _, filename := range filenames {
+		if filename == "-" && nullList {
+			if err := readNullList(&list, os.Stdin); err != nil {
+				return list, err
+			}
+			continue
+		}
+		fragments, err := listFragments(filename)
+		if err != nil {
+			return list, err
+		}
+		for _, fragment := range fragments {
+			if err := readListInto(&list, fragment, relToList, nil); err != nil {
+				return list, err
+			}
+		}
+	}
+	return list, nil
+}
+
+// listFragments returns the list files filename stands for: the ".txt" files
+// of a directory sorted by name, or filename itself.
+func listFragments(filename string) ([]string, error) {
+	if filename == "-" {
+		return []string{filename}, nil
+	}
+	info, err := os.Stat(filename)
+	if err != nil || !info.IsDir() {
+		return []string{filename}, nil
+	}
+
+	fragments, err := filepath.Glob(filepath.Join(filename, "*.txt"))
+	if err != nil {
+		return nil, err
+	}
+	if len(fragments) == 0 {
+		return nil, fmt.Errorf("the list directory %s holds no .txt files", filename)
+	}
+	sort.Strings(fragments)
+	return fragments, nil
+}
+
+// sectionGroup is the entries of a single section.
+type sectionGroup struct {
+	section string
+	entries []string
+}
+
+// sectionEntries returns the entries of list by section name.
+func (list *sections) sectionEntries() []sectionGroup {
+	return []sectionGroup{
+		{"files", list.fileNames},
+		{"paths", list.filePaths},
+		{"directories", list.directories},
+		{"exclude", list.excludes},
+		{"regex", list.regexes},
+	}
+}
+
+// sectionSizes returns the number of entries in each section, in the order
+// of sectionEntries.
+func (list *sections) sectionSizes() []int {
+	groups := list.sectionEntries()
+	sizes := make([]int, len(groups))
+	for i, group := range groups {
+		sizes[i] = len(group.entries)
+	}
+	return sizes
+}
+
+// printSections writes the entries of list to w, grouped under their section
+// headers in list file syntax. When several list files were read, comment
+// lines name the file the following entries came from.
+func printSections(w io.Writer, list *sections) {
+	for _, group := range list.sectionEntries() {
+		fmt.Fprintf(w, "[%s]\n", group.section)
+		lastOrigin := ""
+		for _, entry := range group.entries {
+			origin := list.origins[ruleKey{group.section, entry}]
+			if list.listFiles > 1 && origin != lastOrigin {
+				fmt.Fprintf(w, "# from %s\n", origin)
+				lastOrigin = origin
+			}
+			fmt.Fprintln(w, entry)
+		}
+	}
+}
+
+// noteOrigins records filename as the origin of the entries added since the
+// section sizes were taken that have no origin yet. Entries of included
+// files already have theirs.
+func (list *sections) noteOrigins(filename string, sizes []int) {
+	if filename == "-" {
+		filename = "standard input"
+	}
+	if list.origins == nil {
+		list.origins = make(map[ruleKey]string)
+	}
+	for i, group := range list.sectionEntries() {
+		for _, entry := range group.entries[sizes[i]:] {
+			key := ruleKey{group.section, entry}
+			if _, ok := list.origins[key]; !ok {
+				list.origins[key] = filename
+			}
+		}
+	}
+	list.listFiles++
+}
+
+// ExpandPath expands a leading "~" to the user's home directory and $VAR or
+// ${VAR} references to the values of environment variables, with undefined
+// variables expanding to nothing. "$$" stands for a literal "$".
+func ExpandPath(path string) string {
+	if path == "~" || strings.HasPrefix(path, "~/") || strings.HasPrefix(path, "~"+string(filepath.Separator)) {
+		if home, err := os.UserHomeDir(); err == nil {
+			path = home + path[1:]
+		}
+	}
+	return os.Expand(path, func(name string) string {
+		if name == "$" {
+			return "$"
+		}
+		return os.Getenv(name)
+	})
+}
+
+// resolveEntries applies ExpandPath and filepath.Clean to each entry in
+// place, keeping a leading "!" negation and a trailing separator, so that
+// "./data//" reads as "data/". Both "/" and "\" are taken as separators, so
+// one list file serves Windows and Unix alike. A non-empty baseDir is joined
+// in front of the entries that are still relative afterwards.
+func resolveEntries(entries []string, baseDir string) {
+	for i, entry := range entries {
+		rest, negated := strings.CutPrefix(entry, "!")
+		rest = ExpandPath(normalizeSeparators(rest))
+		trailing := strings.HasSuffix(rest, "/") || strings.HasSuffix(rest, string(filepath.Separator))
+		if baseDir != "" && !filepath.IsAbs(rest) {
+			rest = filepath.Join(baseDir, rest)
+		}
+		rest = filepath.Clean(rest)
+		if trailing && !strings.HasSuffix(rest, string(filepath.Separator)) {
+			rest += string(filepath.Separator)
+		}
+		if negated {
+			rest = "!" + rest
+		}
+		entries[i] = rest
+	}
+}
+
+// resolvePending resolves the [paths] and [directories] entries appended
+// since the last call against baseDir, see resolveEntries. Every entry is
+// resolved exactly once, as a second pass would expand a "$$" escape.
+func (list *sections) resolvePending(baseDir string) {
+	resolveEntries(list.filePaths[list.resolvedPaths:], baseDir)
+	resolveEntries(list.directories[list.resolvedDirectories:], baseDir)
+	list.resolvedPaths, list.resolvedDirectories = len(list.filePaths), len(list.directories)
+}
+
+// entryBaseDir returns the directory the relative entries of a list file in
+// listDir are resolved against: with relToList listDir made absolute, and
+// otherwise none. Standard input has no directory of its own.
+func entryBaseDir(listDir string, relToList bool) (string, error) {
+	if !relToList || listDir == "" {
+		return "", nil
+	}
+	baseDir, err := filepath.Abs(listDir)
+	if err != nil {
+		return "", fmt.Errorf("error resolving list file: %w", err)
+	}
+	return baseDir, nil
+}
+
+// normalizeSeparators replaces both "/" and "\" in path with the separator
+// of the operating system.
+func normalizeSeparators(path string) string {
+	return filepath.FromSlash(strings.ReplaceAll(path, "\\", "/"))
+}
+
+// readListInto parses filename into list, see readTextFile. stack holds the
+// absolute paths of the list files currently being read, to reject include
+// cycles.
+func readListInto(list *sections, filename string, relToList bool, stack []string) error {
+	sizes := list.sectionSizes()
+	listDir := ""
+	if filename != "-" {
+		listDir = filepath.Dir(filename)
+	}
+	baseDir, err := entryBaseDir(listDir, relToList)
+	if err != nil {
+		return err
+	}
+
+	if filename == "-" {
+		var r io.Reader
+		if r, err = decodeList(os.Stdin); err == nil {
+			err = parseList(list, r, listDir, relToList, stack)
+		}
+	} else {
+		err = readListFile(list, filename, relToList, stack)
+	}
+	if err != nil {
+		return err
+	}
+
+	// Entries of included files were resolved when those were read
+	list.resolvePending(baseDir)
+	list.noteOrigins(filename, sizes)
+	return nil
+}
+
+// readListFile opens filename and parses it in the format its extension
+// selects.
+func readListFile(list *sections, filename string, relToList bool, stack []string) error {
+	absPath, err := filepath.Abs(filename)
+	if err != nil {
+		return fmt.Errorf("error resolving list file: %w", err)
+	}
+	for _, open := range stack {
+		if open == absPath {
+			return fmt.Errorf("include cycle detected: %s", strings.Join(append(stack, absPath), " -> "))
+		}
+	}
+
+	// Open the file
+	file, err := os.Open(filename)
+	if err != nil {
+		return fmt.Errorf("error opening text file: %w", err)
+	}
+	defer file.Close()
+
+	r, err := decodeList(file)
+	if err != nil {
+		return err
+	}
+	switch {
+	case isYAMLList(filename):
+		return parseYAMLList(list, r)
+	case isJSONList(filename):
+		return parseJSONList(list, r)
+	}
+	return parseList(list, r, filepath.Dir(filename), relToList, append(stack, absPath))
+}
+
+// parseList reads list entries from r and categorizes lines into sections
+// of list. Within a section an entry starting with "!" negates the entries
+// before it for the candidates it matches; see evaluateRules. A line
+// "@include other.txt" merges another list file, resolved relative to
+// baseDir, without changing the current section. Being line based, the
+// format cannot name files whose names contain newlines; readNullList can.
+func parseList(list *sections, r io.Reader, baseDir string, relToList bool, stack []string) error {
+	entryBase, err := entryBaseDir(baseDir, relToList)
+	if err != nil {
+		return err
+	}
+	var section string
+	scanner := bufio.NewScanner(r)
+
+	// Scan the file line by line
+	for scanner.Scan() {
+		// Trim surrounding whitespace, including the "\r" left behind by
+		// CRLF line endings
+		line := strings.TrimSpace(scanner.Text())
+
+		// Merge included list files
+		if strings.HasPrefix(line, includeDirective) {
+			included := ExpandPath(strings.TrimSpace(strings.TrimPrefix(line, includeDirective)))
+			if !filepath.IsAbs(included) {
+				included = filepath.Join(baseDir, included)
+			}
+			// The included file resolves its own entries, against its own
+			// directory, so the ones read so far are resolved first
+			list.resolvePending(entryBase)
+			if err := readListInto(list, included, relToList, stack); err != nil {
+				return err
+			}
+			continue
+		}
+
+		// Check if the line is a section header
+		isSectionHeader := strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]")
+		if isSectionHeader {
+			section = line[1 : len(line)-1]
+			list.noteSection(section)
+			continue
+		}
+
+		// Ignore empty lines and comments. A "#" or ";" only starts a comment
+		// at the beginning of a line, so file names may still contain them.
+		if isBlankOrComment(line) {
+			continue
+		}
+
+		// Categorize the line based on the current section
+		switch section {
+		case "files":
+			list.fileNames = append(list.fileNames, line)
+		case "paths":
+			list.filePaths = append(list.filePaths, line)
+		case "directories":
+			list.directories = append(list.directories, line)
+		case "exclude":
+			list.excludes = append(list.excludes, line)
+		case "regex":
+			list.regexes = append(list.regexes, line)
+		}
+	}
+
+	// Check for errors during scanning
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("error reading text file: %w", err)
+	}
+
+	return nil
+}
+
+// isBlankOrComment reports whether line is empty or whitespace only, or
+// whether its first non-whitespace character is "#" or ";".
+func isBlankOrComment(line string) bool {
+	trimmed := strings.TrimLeft(line, " \t")
+	return trimmed == "" || strings.HasPrefix(trimmed, "#") || strings.HasPrefix(trimmed, ";")
+}
@@ -0,0 +1,433 @@
+package pathfinder
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestUnknownSectionsAreReported(t *testing.T) {
+	tests := []struct {
+		name, content string
+	}{
+		{"list.txt", "[files]\na.txt\n[fils]\nb.txt\n[exclude]\n*.tmp\n"},
+		{"list.json", `{"files": ["a.txt"], "fils": ["b.txt"], "Exclude": ["*.tmp"]}`},
+		{"list.yaml", "files:\n  - a.txt\nfils:\n  - b.txt\nexclude:\n  - '*.tmp'\n"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dir := t.TempDir()
+			writeFile(t, filepath.Join(dir, test.name), test.content)
+
+			list, err := readTextFile([]string{filepath.Join(dir, test.name)}, false, false)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want := []string{"fils"}; !slices.Equal(list.unknownSections, want) {
+				t.Errorf("unknown sections = %v, want %v", list.unknownSections, want)
+			}
+			if want := []string{"a.txt"}; !slices.Equal(list.fileNames, want) {
+				t.Errorf("[files] = %v, want %v", list.fileNames, want)
+			}
+			if want := []string{"*.tmp"}; !slices.Equal(list.excludes, want) {
+				t.Errorf("[exclude] = %v, want %v", list.excludes, want)
+			}
+
+			writeFile(t, filepath.Join(dir, "src", "a.txt"), "alpha")
+			var errOutput bytes.Buffer
+			cfg := DefaultConfig()
+			cfg.Directories = []string{filepath.Join(dir, "src")}
+			cfg.ListFile = filepath.Join(dir, test.name)
+			cfg.DryRun = true
+			cfg.Output = io.Discard
+			cfg.ErrOutput = &errOutput
+
+			result, err := Run(cfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if result.FilesAdded != 1 {
+				t.Errorf("matched %d files, want 1", result.FilesAdded)
+			}
+			if !strings.Contains(errOutput.String(), "unknown section [fils]") {
+				t.Errorf("no warning about [fils] in %q", errOutput.String())
+			}
+		})
+	}
+}
+
+func TestIncludedEntriesAreResolvedOnce(t *testing.T) {
+	t.Setenv("HOME", "/home/user")
+	dir := t.TempDir()
+	inc := filepath.Join(dir, "inc")
+	writeFile(t, filepath.Join(inc, "inner.txt"), "[paths]\nlit$$HOME/x\nrel/y.txt\n[directories]\nsub\n")
+	writeFile(t, filepath.Join(dir, "outer.txt"), "[paths]\nouter.txt\n@include inc/inner.txt\nafter.txt\n[directories]\ndata\n")
+
+	tests := []struct {
+		relToList          bool
+		paths, directories []string
+	}{
+		{
+			false,
+			[]string{"outer.txt", filepath.FromSlash("lit$HOME/x"), filepath.FromSlash("rel/y.txt"), "after.txt"},
+			[]string{"sub", "data"},
+		},
+		{
+			true,
+			[]string{
+				filepath.Join(dir, "outer.txt"),
+				filepath.Join(inc, "lit$HOME", "x"),
+				filepath.Join(inc, "rel", "y.txt"),
+				filepath.Join(dir, "after.txt"),
+			},
+			[]string{filepath.Join(inc, "sub"), filepath.Join(dir, "data")},
+		},
+	}
+	for _, test := range tests {
+		list, err := readTextFile([]string{filepath.Join(dir, "outer.txt")}, test.relToList, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !slices.Equal(list.filePaths, test.paths) {
+			t.Errorf("relative to list %v: [paths] = %q, want %q", test.relToList, list.filePaths, test.paths)
+		}
+		if !slices.Equal(list.directories, test.directories) {
+			t.Errorf("relative to list %v: [directories] = %q, want %q", test.relToList, list.directories, test.directories)
+		}
+	}
+}
+
+// withStdin runs fn with os.Stdin reading content.
+func withStdin(t *testing.T, content string, fn func()) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "stdin")
+	writeFile(t, path, content)
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	stdin := os.Stdin
+	os.Stdin = file
+	defer func() { os.Stdin = stdin }()
+	fn()
+}
+
+func TestListFromReader(t *testing.T) {
+	content := "[files]\na.txt\n[paths]\nconf/b.ini\n[directories]\nlogs\n[exclude]\n*.tmp\n[regex]\n^c\\d$\n"
+	want := sections{
+		fileNames:   []string{"a.txt"},
+		filePaths:   []string{filepath.Join("conf", "b.ini")},
+		directories: []string{"logs"},
+		excludes:    []string{"*.tmp"},
+		regexes:     []string{`^c\d$`},
+	}
+	check := func(name string, list sections) {
+		t.Helper()
+		for i, group := range list.sectionEntries() {
+			if wantEntries := want.sectionEntries()[i].entries; !slices.Equal(group.entries, wantEntries) {
+				t.Errorf("%s: [%s] = %q, want %q", name, group.section, group.entries, wantEntries)
+			}
+		}
+	}
+
+	var list sections
+	if err := parseList(&list, strings.NewReader(content), "", false, nil); err != nil {
+		t.Fatal(err)
+	}
+	list.resolvePending("")
+	check("parseList", list)
+
+	withStdin(t, content, func() {
+		list, err := readTextFile([]string{"-"}, false, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		check("standard input", list)
+		if origin := list.origins[ruleKey{"files", "a.txt"}]; origin != "standard input" {
+			t.Errorf("entries are from %q, want standard input", origin)
+		}
+	})
+}
+
+func TestListComments(t *testing.T) {
+	content := "# leading comment\n\n[files]\n# a comment\n; another comment\n   # indented comment\na.txt\nissue#12.txt\nb.txt # not a comment\n\n\t\n[paths]\n;skipped\nc;d.txt\n"
+	var list sections
+	if err := parseList(&list, strings.NewReader(content), "", false, nil); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"a.txt", "issue#12.txt", "b.txt # not a comment"}; !slices.Equal(list.fileNames, want) {
+		t.Errorf("[files] = %q, want %q", list.fileNames, want)
+	}
+	if want := []string{"c;d.txt"}; !slices.Equal(list.filePaths, want) {
+		t.Errorf("[paths] = %q, want %q", list.filePaths, want)
+	}
+}
+
+func TestPaddedEntriesMatch(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "src")
+	writeFile(t, filepath.Join(src, "report.txt"), "report")
+	writeFile(t, filepath.Join(src, "conf", "b.ini"), "bravo")
+	writeFile(t, filepath.Join(src, "logs", "c.log"), "charlie")
+	writeFile(t, filepath.Join(dir, "list.txt"), "  [files] \t\r\n"+
+		"report.txt \r\n"+
+		"\t[paths]\r\n"+
+		"  "+filepath.Join(src, "conf", "b.ini")+"\t\r\n"+
+		"[directories]  \r\n"+
+		"\t "+filepath.Join(src, "logs")+"  \r\n")
+
+	list, err := readTextFile([]string{filepath.Join(dir, "list.txt")}, false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list.unknownSections) > 0 {
+		t.Errorf("padded headers read as unknown sections %q", list.unknownSections)
+	}
+
+	cfg := DefaultConfig()
+	cfg.Directories = []string{src}
+	cfg.ListFile = filepath.Join(dir, "list.txt")
+	cfg.Output = io.Discard
+	if got, want := matchNames(t, cfg, src), []string{"conf/b.ini", "logs/c.log", "report.txt"}; !slices.Equal(got, want) {
+		t.Errorf("matched %v, want %v", got, want)
+	}
+}
+
+func TestNestedIncludes(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "main.txt"), "[files]\na.txt\n@include teams/web.txt\nz.txt\n[exclude]\n*.tmp\n")
+	writeFile(t, filepath.Join(dir, "teams", "web.txt"), "[files]\nweb.txt\n@include shared/common.txt\n")
+	writeFile(t, filepath.Join(dir, "teams", "shared", "common.txt"), "[files]\ncommon.txt\n[exclude]\n*.bak\n")
+
+	list, err := readTextFile([]string{filepath.Join(dir, "main.txt")}, false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Includes resolve against the including file and keep its section
+	if want := []string{"a.txt", "web.txt", "common.txt", "z.txt"}; !slices.Equal(list.fileNames, want) {
+		t.Errorf("[files] = %q, want %q", list.fileNames, want)
+	}
+	if want := []string{"*.bak", "*.tmp"}; !slices.Equal(list.excludes, want) {
+		t.Errorf("[exclude] = %q, want %q", list.excludes, want)
+	}
+	if origin := list.origins[ruleKey{"files", "common.txt"}]; origin != filepath.Join(dir, "teams", "shared", "common.txt") {
+		t.Errorf("common.txt is from %q, want the innermost list", origin)
+	}
+}
+
+func TestIncludeCycles(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "self.txt"), "[files]\na.txt\n@include self.txt\n")
+	writeFile(t, filepath.Join(dir, "a.txt"), "[files]\na\n@include b.txt\n")
+	writeFile(t, filepath.Join(dir, "b.txt"), "[files]\nb\n@include a.txt\n")
+
+	for _, name := range []string{"self.txt", "a.txt"} {
+		_, err := readTextFile([]string{filepath.Join(dir, name)}, false, false)
+		if err == nil || !strings.Contains(err.Error(), "include cycle detected") {
+			t.Errorf("%s: error %v, want an include cycle", name, err)
+		}
+	}
+
+	// Including the same file twice without a cycle is fine
+	writeFile(t, filepath.Join(dir, "twice.txt"), "@include b2.txt\n@include b2.txt\n")
+	writeFile(t, filepath.Join(dir, "b2.txt"), "[files]\nb2\n")
+	if _, err := readTextFile([]string{filepath.Join(dir, "twice.txt")}, false, false); err != nil {
+		t.Errorf("including a file twice: %v", err)
+	}
+}
+
+func TestExpandPath(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("USERPROFILE", home)
+	t.Setenv("PROJECT", "demo")
+	t.Setenv("PATHFINDER_UNDEFINED", "")
+	os.Unsetenv("PATHFINDER_UNDEFINED")
+
+	tests := []struct {
+		path, want string
+	}{
+		{"~", home},
+		{"~/data", home + "/data"},
+		{"~user/data", "~user/data"},
+		{"a/~/b", "a/~/b"},
+		{"$HOME/projects", home + "/projects"},
+		{"${PROJECT}/src", "demo/src"},
+		{"x/$PATHFINDER_UNDEFINED/y", "x//y"},
+		{"price$$5", "price$5"},
+		{"$$HOME", "$HOME"},
+	}
+	for _, test := range tests {
+		if got := ExpandPath(test.path); got != test.want {
+			t.Errorf("ExpandPath(%q) = %q, want %q", test.path, got, test.want)
+		}
+	}
+}
+
+func TestExpandedListEntriesMatch(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("HOME", dir)
+	t.Setenv("USERPROFILE", dir)
+	t.Setenv("PATHFINDER_DATA", "data")
+	writeFile(t, filepath.Join(dir, "data", "a.txt"), "alpha")
+	writeFile(t, filepath.Join(dir, "logs", "b.log"), "bravo")
+	writeFile(t, filepath.Join(dir, "list.txt"), "[paths]\n~/$PATHFINDER_DATA/a.txt\n[directories]\n${HOME}/logs\n")
+
+	cfg := DefaultConfig()
+	cfg.Directories = []string{dir}
+	cfg.ListFile = filepath.Join(dir, "list.txt")
+	cfg.Output = io.Discard
+	if got, want := matchNames(t, cfg, dir), []string{"data/a.txt", "logs/b.log"}; !slices.Equal(got, want) {
+		t.Errorf("matched %v, want %v", got, want)
+	}
+}
+
+func TestListSections(t *testing.T) {
+	dir := t.TempDir()
+	first, second := filepath.Join(dir, "base.txt"), filepath.Join(dir, "env.txt")
+	writeFile(t, first, "[files]\na.txt\n[paths]\n./conf//b.ini\n")
+	writeFile(t, second, "[files]\nb.txt\n[exclude]\n*.tmp\n")
+	out := filepath.Join(dir, "out")
+	if err := os.Mkdir(out, 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	var output bytes.Buffer
+	cfg := DefaultConfig()
+	cfg.Directories = []string{filepath.Join(dir, "missing")}
+	cfg.ListFiles = []string{first, second}
+	cfg.OutputPath = out
+	cfg.ListSections = true
+	cfg.Output = &output
+
+	if _, err := Run(cfg); err != nil {
+		t.Fatal(err)
+	}
+	want := "[files]\n# from " + first + "\na.txt\n# from " + second + "\nb.txt\n" +
+		"[paths]\n# from " + first + "\n" + filepath.Join("conf", "b.ini") + "\n" +
+		"[directories]\n" +
+		"[exclude]\n# from " + second + "\n*.tmp\n" +
+		"[regex]\n"
+	if output.String() != want {
+		t.Errorf("printed\n%s\nwant\n%s", output.String(), want)
+	}
+	if entries, err := os.ReadDir(out); err != nil || len(entries) > 0 {
+		t.Errorf("listing sections wrote %v (%v)", entries, err)
+	}
+
+	// A single list file needs no origins
+	output.Reset()
+	cfg.ListFiles = []string{second}
+	if _, err := Run(cfg); err != nil {
+		t.Fatal(err)
+	}
+	if want := "[files]\nb.txt\n[paths]\n[directories]\n[exclude]\n*.tmp\n[regex]\n"; output.String() != want {
+		t.Errorf("printed\n%s\nwant\n%s", output.String(), want)
+	}
+}
+
+func TestResolveEntries(t *testing.T) {
+	tests := []struct {
+		entry, baseDir, want string
+	}{
+		{"./data/", "", "data/"},
+		{"data//sub", "", "data/sub"},
+		{"data/./sub/../sub", "", "data/sub"},
+		{"!./data//tmp/", "", "!data/tmp/"},
+		{"./data", "/lists", "/lists/data"},
+	}
+	for _, test := range tests {
+		entries := []string{filepath.FromSlash(test.entry)}
+		resolveEntries(entries, filepath.FromSlash(test.baseDir))
+		if want := filepath.FromSlash(test.want); entries[0] != want {
+			t.Errorf("resolveEntries(%q, %q) = %q, want %q", test.entry, test.baseDir, entries[0], want)
+		}
+	}
+}
+
+func TestMessyPathSpellingsMatch(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "data", "sub", "a.txt"), "alpha")
+	writeFile(t, filepath.Join(dir, "data", "b.txt"), "bravo")
+	writeFile(t, filepath.Join(dir, "logs", "c.log"), "charlie")
+	writeFile(t, filepath.Join(dir, "other.txt"), "other")
+	writeFile(t, filepath.Join(dir, "list.txt"), "[paths]\n./data//sub/\n"+
+		"./logs/../data/./b.txt\n[directories]\nlogs//\n")
+
+	cfg := DefaultConfig()
+	cfg.Directories = []string{dir}
+	cfg.ListFile = filepath.Join(dir, "list.txt")
+	cfg.RelToList = true
+	cfg.Output = io.Discard
+	if got, want := matchNames(t, cfg, dir), []string{"data/b.txt", "data/sub/a.txt", "logs/c.log"}; !slices.Equal(got, want) {
+		t.Errorf("matched %v, want %v", got, want)
+	}
+}
+
+func TestMixedSeparatorsMatch(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "data", "sub", "a.txt"), "alpha")
+	writeFile(t, filepath.Join(dir, "logs", "deep", "c.log"), "charlie")
+	writeFile(t, filepath.Join(dir, "conf", "b.ini"), "bravo")
+	writeFile(t, filepath.Join(dir, "other.txt"), "other")
+	// The same list written on Windows and on Unix
+	writeFile(t, filepath.Join(dir, "list.txt"), "[paths]\ndata\\sub\nconf/b.ini\n[directories]\nlogs\\deep/\n")
+
+	cfg := DefaultConfig()
+	cfg.Directories = []string{dir}
+	cfg.ListFile = filepath.Join(dir, "list.txt")
+	cfg.RelToList = true
+	cfg.OutputPath = dir
+	cfg.OutputName = "out.zip"
+	cfg.Output = io.Discard
+
+	// Entry names use forward slashes whatever the separator of the list
+	want := []string{"conf/b.ini", "data/sub/a.txt", "logs/deep/c.log"}
+	if got := archiveNames(t, cfg); !slices.Equal(got, want) {
+		t.Errorf("archived %v, want %v", got, want)
+	}
+}
+
+func TestListDirectory(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "src")
+	for _, name := range []string{"web.conf", "db.conf", "db.tmp", "other.conf"} {
+		writeFile(t, filepath.Join(src, name), name)
+	}
+	lists := filepath.Join(dir, "lists")
+	writeFile(t, filepath.Join(lists, "web.txt"), "[files]\nweb.conf\n")
+	writeFile(t, filepath.Join(lists, "db.txt"), "[files]\ndb.*\n[exclude]\n*.tmp\n")
+	// Only .txt files are fragments
+	writeFile(t, filepath.Join(lists, "README.md"), "[files]\nother.conf\n")
+
+	list, err := readTextFile([]string{lists}, false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Fragments are merged in order of their names
+	if want := []string{"db.*", "web.conf"}; !slices.Equal(list.fileNames, want) {
+		t.Errorf("[files] = %q, want %q", list.fileNames, want)
+	}
+
+	cfg := DefaultConfig()
+	cfg.Directories = []string{src}
+	cfg.ListFile = lists
+	cfg.Output = io.Discard
+	if got, want := matchNames(t, cfg, src), []string{"db.conf", "web.conf"}; !slices.Equal(got, want) {
+		t.Errorf("matched %v, want %v", got, want)
+	}
+
+	empty := filepath.Join(dir, "empty")
+	if err := os.Mkdir(empty, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := readTextFile([]string{empty}, false, false); err == nil || !strings.Contains(err.Error(), "holds no .txt files") {
+		t.Errorf("empty list directory: error %v, want one saying it holds no lists", err)
+	}
+}
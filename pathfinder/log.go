@@ -0,0 +1,34 @@
+package pathfinder
+
+import (
+	"context"
+	"log/slog"
+)
+
+// Events logged to Config.Logger. Each is the message of a log record whose
+// attributes describe it.
+const (
+	// eventFileAdded is logged at debug level for every file stored in the
+	// archive, with its path, entry name, size and rule.
+	eventFileAdded = "file_added"
+	// eventFileSkipped is logged at info level for matched files left out on
+	// purpose, with their path and the reason.
+	eventFileSkipped = "file_skipped"
+	// eventFileFailed is logged at error level for matched files that could
+	// not be archived, with their path and the error.
+	eventFileFailed = "file_failed"
+	// eventWalkError is logged at warn level for paths that could not be
+	// searched, with their path and the error.
+	eventWalkError = "walk_error"
+	// eventRunComplete is logged at info level when the run has finished,
+	// with the archive path and totals.
+	eventRunComplete = "run_complete"
+)
+
+// log writes a record to the configured logger, if any.
+func (f *finder) log(level slog.Level, event string, attrs ...slog.Attr) {
+	if f.cfg.Logger == nil {
+		return
+	}
+	f.cfg.Logger.LogAttrs(context.Background(), level, event, attrs...)
+}
@@ -0,0 +1,50 @@
+package pathfinder
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// manifestEntry describes a single archived file.
+type manifestEntry struct {
+	Name     string    `json:"name"`
+	Path     string    `json:"path"`
+	Size     int64     `json:"size"`
+	Modified time.Time `json:"modified"`
+	Rule     string    `json:"rule"`
+	SHA256   string    `json:"sha256"`
+	// DuplicateOf names the entry holding the content when the file was
+	// stored as a link to it.
+	DuplicateOf string `json:"duplicate_of,omitempty"`
+}
+
+// manifestFilename returns the manifest path for an archive, replacing the
+// archive extension with ".manifest.json".
+func manifestFilename(archivePath, format string) string {
+	base := strings.TrimSuffix(archivePath, archiveExtension(format))
+	if base == archivePath {
+		base = strings.TrimSuffix(archivePath, filepath.Ext(archivePath))
+	}
+	return base + ".manifest.json"
+}
+
+// writeManifest writes entries as indented JSON to path.
+func writeManifest(path string, entries []manifestEntry) error {
+	if entries == nil {
+		entries = []manifestEntry{}
+	}
+
+	data, err := json.MarshalIndent(entries, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode manifest: %w", err)
+	}
+
+	if err := os.WriteFile(path, append(data, '\n'), 0o644); err != nil {
+		return fmt.Errorf("failed to write manifest: %w", err)
+	}
+	return nil
+}
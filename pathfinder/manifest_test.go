@@ -0,0 +1,115 @@
+package pathfinder
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+// readManifest decodes the manifest at path, sorted by entry name.
+func readManifest(t *testing.T, path string) []manifestEntry {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var entries []manifestEntry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		t.Fatalf("manifest is not valid JSON: %v", err)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name < entries[j].Name })
+	return entries
+}
+
+func TestManifestDescribesArchivedFiles(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "src")
+	writeFile(t, filepath.Join(src, "a.txt"), "alpha")
+	writeFile(t, filepath.Join(src, "conf", "b.ini"), "bravo!")
+	writeFile(t, filepath.Join(src, "logs", "c.log"), "charlie")
+	writeFile(t, filepath.Join(dir, "list.txt"), "[files]\na.txt\n[paths]\n"+
+		filepath.Join(src, "conf", "b.ini")+"\n[directories]\n"+filepath.Join(src, "logs")+"\n")
+	modified := time.Date(2020, 2, 3, 4, 5, 6, 0, time.UTC)
+	for _, name := range []string{"a.txt", "conf/b.ini", "logs/c.log"} {
+		if err := os.Chtimes(filepath.Join(src, name), modified, modified); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cfg := DefaultConfig()
+	cfg.Directories = []string{src}
+	cfg.ListFile = filepath.Join(dir, "list.txt")
+	cfg.OutputPath = dir
+	cfg.OutputName = "out.zip"
+	cfg.Manifest = true
+	cfg.Output = io.Discard
+
+	if _, err := Run(cfg); err != nil {
+		t.Fatal(err)
+	}
+	entries := readManifest(t, filepath.Join(dir, "out.manifest.json"))
+	want := []manifestEntry{
+		{Name: "a.txt", Path: filepath.Join(src, "a.txt"), Size: 5, Rule: "name"},
+		{Name: "conf/b.ini", Path: filepath.Join(src, "conf", "b.ini"), Size: 6, Rule: "path"},
+		{Name: "logs/c.log", Path: filepath.Join(src, "logs", "c.log"), Size: 7, Rule: "directory"},
+	}
+	if len(entries) != len(want) {
+		t.Fatalf("manifest lists %+v, want %+v", entries, want)
+	}
+	for i, entry := range entries {
+		w := want[i]
+		if entry.Name != w.Name || entry.Path != w.Path || entry.Size != w.Size || entry.Rule != w.Rule || !entry.Modified.Equal(modified) {
+			t.Errorf("manifest entry %+v, want %+v modified at %v", entry, w, modified)
+		}
+	}
+}
+
+func TestManifestChecksums(t *testing.T) {
+	dir := t.TempDir()
+	contents := map[string][]byte{
+		"a.txt":   []byte("alpha"),
+		"big.bin": bytes.Repeat([]byte{0, 1, 2, 3, 255}, 100000),
+		"empty":   nil,
+	}
+	for name, content := range contents {
+		writeFile(t, filepath.Join(dir, "src", name), string(content))
+	}
+	writeFile(t, filepath.Join(dir, "list.txt"), "[files]\n*\n")
+
+	var output bytes.Buffer
+	cfg := DefaultConfig()
+	cfg.Directories = []string{filepath.Join(dir, "src")}
+	cfg.ListFile = filepath.Join(dir, "list.txt")
+	cfg.OutputPath = dir
+	cfg.OutputName = "out.zip"
+	cfg.Manifest = true
+	cfg.Verbose = true
+	cfg.Output = &output
+
+	if _, err := Run(cfg); err != nil {
+		t.Fatal(err)
+	}
+	entries := readManifest(t, filepath.Join(dir, "out.manifest.json"))
+	if len(entries) != len(contents) {
+		t.Fatalf("manifest lists %d files, want %d", len(entries), len(contents))
+	}
+	for _, entry := range entries {
+		sum := sha256.Sum256(contents[entry.Name])
+		want := hex.EncodeToString(sum[:])
+		if entry.SHA256 != want {
+			t.Errorf("manifest has sha256 %s for %s, want %s", entry.SHA256, entry.Name, want)
+		}
+		if line := fmt.Sprintf("Added %s (sha256 %s)", entry.Name, want); !strings.Contains(output.String(), line) {
+			t.Errorf("verbose output lacks %q", line)
+		}
+	}
+}
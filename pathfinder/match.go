@@ -0,0 +1,228 @@
+package pathfinder
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// fold lowercases s when matching is case-insensitive and returns it
+// unchanged otherwise.
+func (f *finder) fold(s string) string {
+	if f.cfg.CaseInsensitive {
+		return strings.ToLower(s)
+	}
+	return s
+}
+
+// foldAll applies fold to every element of values.
+func (f *finder) foldAll(values []string) []string {
+	if !f.cfg.CaseInsensitive {
+		return values
+	}
+	folded := make([]string, len(values))
+	for i, value := range values {
+		folded[i] = f.fold(value)
+	}
+	return folded
+}
+
+// evaluateRules applies the entries of a section to a candidate in order.
+// An entry matching the candidate includes it, while an entry starting with
+// "!" that matches removes it again, so the last matching entry decides, as
+// in .gitignore files. match is called with the entry's "!" removed.
+func evaluateRules(entries []string, match func(pattern string) bool) bool {
+	included := false
+	for _, entry := range entries {
+		negated := strings.HasPrefix(entry, "!")
+		if included != negated {
+			// The entry could not change the outcome
+			continue
+		}
+		if match(strings.TrimPrefix(entry, "!")) {
+			included = !negated
+		}
+	}
+	return included
+}
+
+// matchesAnyPattern reports whether name is selected by the shell glob
+// patterns, evaluated in order with "!" negations. Literal names match
+// themselves. Unlike in a shell, a leading "." is not special, so "*"
+// matches dotfiles too; see Config.NoHidden. Malformed patterns are skipped
+// and the first such error is returned alongside the result.
+func matchesAnyPattern(name string, patterns []string) (bool, error) {
+	var firstErr error
+	matched := evaluateRules(patterns, func(pattern string) bool {
+		ok, err := filepath.Match(pattern, name)
+		if err != nil && firstErr == nil {
+			firstErr = fmt.Errorf("invalid pattern %q: %w", pattern, err)
+		}
+		return ok
+	})
+	return matched, firstErr
+}
+
+// pathMatches reports whether candidate lies at or below spec. The comparison
+// is done per path segment, so "data/log" matches "data/log/x" but not
+// "data/logarithm.txt". Each segment of spec may be a shell glob. A trailing
+// separator on spec restricts the match to files inside that directory.
+// Both are cleaned first, so "./data//log" is the same as "data/log".
+func pathMatches(candidate, spec string) bool {
+	sep := string(os.PathSeparator)
+	dirOnly := strings.HasSuffix(spec, sep) || strings.HasSuffix(spec, "/")
+
+	specParts := strings.Split(filepath.Clean(spec), sep)
+	candidateParts := strings.Split(filepath.Clean(candidate), sep)
+
+	if len(specParts) > len(candidateParts) {
+		return false
+	}
+	if dirOnly && len(specParts) == len(candidateParts) {
+		return false
+	}
+
+	for i, part := range specParts {
+		matched, err := filepath.Match(part, candidateParts[i])
+		if err != nil {
+			matched = part == candidateParts[i]
+		}
+		if !matched {
+			return false
+		}
+	}
+	return true
+}
+
+// pruned reports whether the walk leaves out path, either as a hidden file or
+// directory with NoHidden or as a directory named in SkipDirs. The root of
+// the walk itself is never left out.
+func (f *finder) pruned(path, root string, d fs.DirEntry) bool {
+	if path == root {
+		return false
+	}
+	name := d.Name()
+	if f.cfg.NoHidden && strings.HasPrefix(name, ".") && name != "." && name != ".." {
+		return true
+	}
+	if d.IsDir() {
+		for _, pattern := range f.cfg.SkipDirs {
+			if matched, _ := filepath.Match(f.fold(pattern), f.fold(name)); matched {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// VCSDirs are the names of version control metadata directories, which
+// callers may add to Config.SkipDirs.
+var VCSDirs = []string{".git", ".hg", ".svn", ".bzr", "_darcs", "CVS"}
+
+// BuildDirs are the names of common dependency, cache and build output
+// directories, which callers may add to Config.SkipDirs.
+var BuildDirs = []string{
+	"node_modules", "bower_components", "target", "__pycache__", ".pytest_cache",
+	".mypy_cache", ".tox", ".venv", ".gradle", ".next", ".cache",
+}
+
+// exceedsDepth reports whether the directory dirPath lies deeper below the
+// current search directory than MaxDepth allows. A depth of 0 keeps only the
+// files directly inside the search directory.
+func (f *finder) exceedsDepth(dirPath string) bool {
+	if f.cfg.MaxDepth < 0 {
+		return false
+	}
+	rel, err := filepath.Rel(f.directory, dirPath)
+	if err != nil || rel == "." {
+		return false
+	}
+	return len(strings.Split(rel, string(filepath.Separator))) > f.cfg.MaxDepth
+}
+
+// shouldExclude reports whether path is covered by an [exclude] entry, either
+// as a glob on its base name or as a path prefix. Excludes take precedence
+// over every include rule, and a "!" entry re-includes what earlier
+// excludes matched. Files matching ExcludeRegexes are excluded as well.
+func (f *finder) shouldExclude(path string, d fs.DirEntry) bool {
+	excluded := evaluateRules(f.excludes, func(pattern string) bool {
+		if matched, _ := filepath.Match(f.fold(pattern), f.fold(d.Name())); matched {
+			return true
+		}
+		return pathMatches(f.fold(path), f.fold(pattern))
+	})
+	return excluded || (!d.IsDir() && f.excludedByRegex(path))
+}
+
+// isUnderDirectory reports whether filePath, a directory if isDir is set, is
+// selected by the [directories] entries, evaluated in order with "!"
+// negations.
+func isUnderDirectory(filePath string, isDir bool, directories []string) bool {
+	return evaluateRules(directories, func(entry string) bool {
+		return directoryMatches(filePath, isDir, entry)
+	})
+}
+
+// splitDirectoryEntry separates the directory of a [directories] entry from
+// its depth suffix. "dir/*" selects only the files directly inside dir,
+// while "dir/**" and a plain "dir" select its whole subtree.
+func splitDirectoryEntry(entry string) (dir string, shallow bool) {
+	for _, sep := range []string{"/", string(filepath.Separator)} {
+		if dir, ok := strings.CutSuffix(entry, sep+"**"); ok {
+			return dir, false
+		}
+		if dir, ok := strings.CutSuffix(entry, sep+"*"); ok {
+			return dir, true
+		}
+	}
+	return entry, false
+}
+
+// directoryMatches reports whether a single [directories] entry selects
+// filePath, a directory if isDir is set. A shallow entry selects its
+// directory and the files directly inside it, a deep one everything below.
+func directoryMatches(filePath string, isDir bool, entry string) bool {
+	dir, shallow := splitDirectoryEntry(entry)
+	if !shallow {
+		return isWithin(filePath, dir)
+	}
+	filePath, dir = filepath.Clean(filePath), filepath.Clean(dir)
+	if isDir {
+		return filePath == dir
+	}
+	return filepath.Dir(filePath) == dir
+}
+
+// descendsInto reports whether some [directories] entry may select files
+// below the directory dirPath, so that walking it is worthwhile.
+func descendsInto(dirPath string, directories []string) bool {
+	for _, entry := range directories {
+		if strings.HasPrefix(entry, "!") {
+			continue
+		}
+		dir, shallow := splitDirectoryEntry(entry)
+		if isWithin(dir, dirPath) || (!shallow && isWithin(dirPath, dir)) {
+			return true
+		}
+	}
+	return false
+}
+
+// isWithin reports whether path is dir or lies below it. Both are cleaned
+// and compared per path segment, so "data" does not contain "database".
+func isWithin(path, dir string) bool {
+	path, dir = filepath.Clean(path), filepath.Clean(dir)
+	if path == dir {
+		return true
+	}
+	sep := string(filepath.Separator)
+	if dir == "." {
+		return !filepath.IsAbs(path) && path != ".." && !strings.HasPrefix(path, ".."+sep)
+	}
+	if !strings.HasSuffix(dir, sep) {
+		dir += sep
+	}
+	return strings.HasPrefix(path, dir)
+}
@@ -0,0 +1,338 @@
+package pathfinder
+
+import (
+	"context"
+	"io"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// matchNames runs Matches with cfg and returns the matched files relative to
+// root, with forward slashes and sorted.
+func matchNames(t *testing.T, cfg Config, root string) []string {
+	t.Helper()
+	var names []string
+	results, errs := Matches(context.Background(), cfg)
+	for file := range results {
+		rel, err := filepath.Rel(root, file.Path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		names = append(names, filepath.ToSlash(rel))
+	}
+	if err := <-errs; err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func TestMatchesAnyPattern(t *testing.T) {
+	tests := []struct {
+		name     string
+		patterns []string
+		want     bool
+	}{
+		{"a.txt", []string{"*.txt"}, true},
+		{"a.txt.bak", []string{"*.txt"}, false},
+		{".hidden.txt", []string{"*.txt"}, true},
+		{"report1.csv", []string{"report?.csv"}, true},
+		{"report10.csv", []string{"report?.csv"}, false},
+		{"b.log", []string{"[ab].log"}, true},
+		{"c.log", []string{"[ab].log"}, false},
+		{"exact.md", []string{"other.md", "exact.md"}, true},
+	}
+	for _, test := range tests {
+		got, err := matchesAnyPattern(test.name, test.patterns)
+		if err != nil {
+			t.Errorf("matchesAnyPattern(%q, %q) failed: %v", test.name, test.patterns, err)
+		} else if got != test.want {
+			t.Errorf("matchesAnyPattern(%q, %q) = %v, want %v", test.name, test.patterns, got, test.want)
+		}
+	}
+
+	// A malformed pattern is reported, the others still apply
+	matched, err := matchesAnyPattern("a.txt", []string{"[", "*.txt"})
+	if !matched || err == nil {
+		t.Errorf("matchesAnyPattern with a malformed pattern = %v, %v, want true and an error", matched, err)
+	}
+}
+
+func TestGlobInFilesSection(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "src")
+	writeFile(t, filepath.Join(src, "a.txt"), "alpha")
+	writeFile(t, filepath.Join(src, "sub", "b.txt"), "bravo")
+	writeFile(t, filepath.Join(src, "c.log"), "charlie")
+	writeFile(t, filepath.Join(src, "d.txt.bak"), "delta")
+	writeFile(t, filepath.Join(dir, "list.txt"), "[files]\n*.txt\n")
+
+	cfg := DefaultConfig()
+	cfg.Directories = []string{src}
+	cfg.ListFile = filepath.Join(dir, "list.txt")
+	cfg.Output = io.Discard
+
+	if got, want := matchNames(t, cfg, src), []string{"a.txt", "sub/b.txt"}; !slices.Equal(got, want) {
+		t.Errorf("matched %v, want %v", got, want)
+	}
+}
+
+func TestPathMatches(t *testing.T) {
+	tests := []struct {
+		candidate, spec string
+		want            bool
+	}{
+		{"data/log", "data/log", true},
+		{"data/log/x.txt", "data/log", true},
+		{"data/logarithm.txt", "data/log", false},
+		{"data/log.txt", "data/log", false},
+		{"data/x.txt", "data/*.txt", true},
+		{"data/sub/x.txt", "data/*/x.txt", true},
+		{"data/sub/x.txt", "./data//sub", true},
+		// A trailing separator selects only what is inside the directory
+		{"data/log", "data/log/", false},
+		{"data/log/x.txt", "data/log/", true},
+		{"data/log/sub/y.txt", "data/log/", true},
+		{"data", "data/log", false},
+	}
+	for _, test := range tests {
+		candidate, spec := filepath.FromSlash(test.candidate), filepath.FromSlash(test.spec)
+		if got := pathMatches(candidate, spec); got != test.want {
+			t.Errorf("pathMatches(%q, %q) = %v, want %v", test.candidate, test.spec, got, test.want)
+		}
+	}
+}
+
+func TestExcludeInsideIncludedDirectory(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "src")
+	writeFile(t, filepath.Join(src, "data", "keep.txt"), "keep")
+	writeFile(t, filepath.Join(src, "data", "scratch.tmp"), "scratch")
+	writeFile(t, filepath.Join(src, "data", "cache", "c.txt"), "cache")
+	writeFile(t, filepath.Join(src, "other.tmp"), "other")
+	writeFile(t, filepath.Join(dir, "list.txt"), "[files]\n*.tmp\n[directories]\n"+
+		filepath.Join(src, "data")+"\n[exclude]\n*.tmp\n"+filepath.Join(src, "data", "cache")+"\n")
+
+	cfg := DefaultConfig()
+	cfg.Directories = []string{src}
+	cfg.ListFile = filepath.Join(dir, "list.txt")
+	cfg.Output = io.Discard
+
+	// Excludes win over [files] and [directories] alike
+	if got, want := matchNames(t, cfg, src), []string{"data/keep.txt"}; !slices.Equal(got, want) {
+		t.Errorf("matched %v, want %v", got, want)
+	}
+}
+
+func TestMaxDepth(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "src")
+	writeFile(t, filepath.Join(src, "a.txt"), "alpha")
+	writeFile(t, filepath.Join(src, "one", "b.txt"), "bravo")
+	writeFile(t, filepath.Join(src, "one", "two", "c.txt"), "charlie")
+	writeFile(t, filepath.Join(dir, "list.txt"), "[files]\n*.txt\n")
+
+	tests := []struct {
+		depth int
+		want  []string
+	}{
+		{0, []string{"a.txt"}},
+		{1, []string{"a.txt", "one/b.txt"}},
+		{-1, []string{"a.txt", "one/b.txt", "one/two/c.txt"}},
+	}
+	for _, test := range tests {
+		cfg := DefaultConfig()
+		cfg.Directories = []string{src}
+		cfg.ListFile = filepath.Join(dir, "list.txt")
+		cfg.MaxDepth = test.depth
+		cfg.Output = io.Discard
+
+		if got := matchNames(t, cfg, src); !slices.Equal(got, test.want) {
+			t.Errorf("depth %d matched %v, want %v", test.depth, got, test.want)
+		}
+	}
+}
+
+func TestCaseInsensitiveSections(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "src")
+	writeFile(t, filepath.Join(src, "README.MD"), "readme")
+	writeFile(t, filepath.Join(src, "Config", "App.YAML"), "app")
+	writeFile(t, filepath.Join(src, "Data", "x.txt"), "x")
+	writeFile(t, filepath.Join(src, "Data", "Skip.TMP"), "skip")
+	writeFile(t, filepath.Join(dir, "list.txt"), "[files]\nreadme.md\n"+
+		"[paths]\n"+filepath.Join(src, "config", "app.yaml")+"\n"+
+		"[directories]\n"+filepath.Join(src, "DATA")+"\n"+
+		"[exclude]\n*.tmp\n")
+
+	tests := []struct {
+		caseInsensitive bool
+		want            []string
+	}{
+		{false, nil},
+		{true, []string{"Config/App.YAML", "Data/x.txt", "README.MD"}},
+	}
+	for _, test := range tests {
+		cfg := DefaultConfig()
+		cfg.Directories = []string{src}
+		cfg.ListFile = filepath.Join(dir, "list.txt")
+		cfg.CaseInsensitive = test.caseInsensitive
+		cfg.Output = io.Discard
+
+		if got := matchNames(t, cfg, src); !slices.Equal(got, test.want) {
+			t.Errorf("case-insensitive %v matched %v, want %v", test.caseInsensitive, got, test.want)
+		}
+	}
+}
+
+func TestNegationLastMatchWins(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "src")
+	for _, name := range []string{"a.log", "debug.log", "debug-keep.log", "b.txt"} {
+		writeFile(t, filepath.Join(src, name), name)
+	}
+
+	tests := []struct {
+		files []string
+		want  []string
+	}{
+		// A negation removes what the entries before it matched
+		{[]string{"*.log", "!debug*.log"}, []string{"a.log"}},
+		// and a later entry adds it back
+		{[]string{"*.log", "!debug*.log", "debug-keep.log"}, []string{"a.log", "debug-keep.log"}},
+		// A negation before any match has nothing to remove
+		{[]string{"!debug*.log", "*.log"}, []string{"a.log", "debug-keep.log", "debug.log"}},
+		{[]string{"!b.txt"}, nil},
+	}
+	for _, test := range tests {
+		writeFile(t, filepath.Join(dir, "list.txt"), "[files]\n"+strings.Join(test.files, "\n")+"\n")
+		cfg := DefaultConfig()
+		cfg.Directories = []string{src}
+		cfg.ListFile = filepath.Join(dir, "list.txt")
+		cfg.Output = io.Discard
+
+		if got := matchNames(t, cfg, src); !slices.Equal(got, test.want) {
+			t.Errorf("[files] %q matched %v, want %v", test.files, got, test.want)
+		}
+	}
+}
+
+func TestNegatedDirectoryEntries(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "src")
+	writeFile(t, filepath.Join(src, "logs", "app.log"), "app")
+	writeFile(t, filepath.Join(src, "logs", "debug", "trace.log"), "trace")
+	writeFile(t, filepath.Join(src, "logs", "debug", "keep", "k.log"), "keep")
+	logs := filepath.Join(src, "logs")
+	writeFile(t, filepath.Join(dir, "list.txt"), "[directories]\n"+logs+"\n!"+
+		filepath.Join(logs, "debug")+"\n"+filepath.Join(logs, "debug", "keep")+"\n")
+
+	cfg := DefaultConfig()
+	cfg.Directories = []string{src}
+	cfg.ListFile = filepath.Join(dir, "list.txt")
+	cfg.Output = io.Discard
+
+	// Include, then exclude a subtree, then re-include part of it
+	if got, want := matchNames(t, cfg, src), []string{"logs/app.log", "logs/debug/keep/k.log"}; !slices.Equal(got, want) {
+		t.Errorf("matched %v, want %v", got, want)
+	}
+}
+
+func TestNoHidden(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "src")
+	for _, name := range []string{"a.txt", ".env", ".config/app.txt", "sub/.secret.txt", "sub/b.txt"} {
+		writeFile(t, filepath.Join(src, filepath.FromSlash(name)), name)
+	}
+	writeFile(t, filepath.Join(dir, "list.txt"), "[files]\n*\n")
+
+	tests := []struct {
+		noHidden bool
+		want     []string
+	}{
+		{false, []string{".config/app.txt", ".env", "a.txt", "sub/.secret.txt", "sub/b.txt"}},
+		{true, []string{"a.txt", "sub/b.txt"}},
+	}
+	for _, test := range tests {
+		cfg := DefaultConfig()
+		cfg.Directories = []string{src}
+		cfg.ListFile = filepath.Join(dir, "list.txt")
+		cfg.NoHidden = test.noHidden
+		cfg.Output = io.Discard
+
+		if got := matchNames(t, cfg, src); !slices.Equal(got, test.want) {
+			t.Errorf("no hidden %v matched %v, want %v", test.noHidden, got, test.want)
+		}
+	}
+}
+
+func TestSkipDirs(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "src")
+	for _, name := range []string{
+		"main.go", ".git/config", "lib/.svn/entries", "node_modules/p/index.js",
+		"app/target/out.class", "notes/target", "tmp-1/x.go", "keep/tmp/y.go",
+	} {
+		writeFile(t, filepath.Join(src, filepath.FromSlash(name)), name)
+	}
+	writeFile(t, filepath.Join(dir, "list.txt"), "[files]\n*\n")
+
+	all := []string{"app/target/out.class", ".git/config", "keep/tmp/y.go", "lib/.svn/entries", "main.go", "node_modules/p/index.js", "notes/target", "tmp-1/x.go"}
+	slices.Sort(all)
+	tests := []struct {
+		skip []string
+		want []string
+	}{
+		{nil, all},
+		{VCSDirs, []string{"app/target/out.class", "keep/tmp/y.go", "main.go", "node_modules/p/index.js", "notes/target", "tmp-1/x.go"}},
+		// A file named like a skipped directory is kept
+		{BuildDirs, []string{".git/config", "keep/tmp/y.go", "lib/.svn/entries", "main.go", "notes/target", "tmp-1/x.go"}},
+		{[]string{"tmp-*"}, []string{".git/config", "app/target/out.class", "keep/tmp/y.go", "lib/.svn/entries", "main.go", "node_modules/p/index.js", "notes/target"}},
+	}
+	for _, test := range tests {
+		cfg := DefaultConfig()
+		cfg.Directories = []string{src}
+		cfg.ListFile = filepath.Join(dir, "list.txt")
+		cfg.SkipDirs = test.skip
+		cfg.Output = io.Discard
+
+		if got := matchNames(t, cfg, src); !slices.Equal(got, test.want) {
+			t.Errorf("skipping %q matched %v, want %v", test.skip, got, test.want)
+		}
+	}
+}
+
+func TestDirectoryDepthSuffix(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "src")
+	for _, name := range []string{"top.txt", "data/a.txt", "data/sub/b.txt", "data/sub/deep/c.txt"} {
+		writeFile(t, filepath.Join(src, filepath.FromSlash(name)), name)
+	}
+	data := filepath.Join(src, "data")
+
+	tests := []struct {
+		entries []string
+		want    []string
+	}{
+		{[]string{data}, []string{"data/a.txt", "data/sub/b.txt", "data/sub/deep/c.txt"}},
+		{[]string{data + "/**"}, []string{"data/a.txt", "data/sub/b.txt", "data/sub/deep/c.txt"}},
+		{[]string{data + "/*"}, []string{"data/a.txt"}},
+		{[]string{filepath.Join(data, "sub") + "/*"}, []string{"data/sub/b.txt"}},
+		// A shallow entry and a deep one below it combine
+		{[]string{data + "/*", filepath.Join(data, "sub", "deep") + "/**"}, []string{"data/a.txt", "data/sub/deep/c.txt"}},
+	}
+	for _, test := range tests {
+		writeFile(t, filepath.Join(dir, "list.txt"), "[directories]\n"+strings.Join(test.entries, "\n")+"\n")
+		cfg := DefaultConfig()
+		cfg.Directories = []string{src}
+		cfg.ListFile = filepath.Join(dir, "list.txt")
+		cfg.Output = io.Discard
+
+		if got := matchNames(t, cfg, src); !slices.Equal(got, test.want) {
+			t.Errorf("[directories] %q matched %v, want %v", test.entries, got, test.want)
+		}
+	}
+}
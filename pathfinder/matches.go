@@ -0,0 +1,42 @@
+package pathfinder
+
+import (
+	"context"
+	"os"
+)
+
+// MatchedFile is a file selected by the list, as sent by Matches.
+type MatchedFile struct {
+	// Path is the path of the file as found by the walk.
+	Path string
+	// Info describes the file, or the directory for empty directories kept
+	// with IncludeEmptyDirs.
+	Info os.FileInfo
+	// Rule names what selected the file: "name", "path", "regex" or
+	// "directory".
+	Rule string
+}
+
+// Matches searches the configured directories like RunContext, but instead
+// of writing an archive it sends every matched file on the returned
+// channel, which is closed once the search is done. The error of the run,
+// or nil, is then sent on the error channel. Consumers that stop reading
+// early must cancel ctx, which ends the search.
+func Matches(ctx context.Context, cfg Config) (<-chan MatchedFile, <-chan error) {
+	matches := make(chan MatchedFile)
+	errc := make(chan error, 1)
+	cfg.DryRun = true
+
+	go func() {
+		_, err := run(ctx, cfg, func(match MatchedFile) {
+			select {
+			case matches <- match:
+			case <-ctx.Done():
+			}
+		})
+		close(matches)
+		errc <- err
+		close(errc)
+	}()
+	return matches, errc
+}
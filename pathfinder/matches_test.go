@@ -0,0 +1,103 @@
+package pathfinder
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestMatchesYieldsFiles(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "src")
+	writeFile(t, filepath.Join(src, "a.txt"), "alpha")
+	writeFile(t, filepath.Join(src, "conf", "b.ini"), "bravo!")
+	writeFile(t, filepath.Join(src, "logs", "c.log"), "charlie")
+	writeFile(t, filepath.Join(src, "other.md"), "other")
+	writeFile(t, filepath.Join(dir, "list.txt"), "[files]\na.txt\n[paths]\n"+
+		filepath.Join(src, "conf", "b.ini")+"\n[directories]\n"+filepath.Join(src, "logs")+"\n")
+
+	cfg := DefaultConfig()
+	cfg.Directories = []string{src}
+	cfg.ListFile = filepath.Join(dir, "list.txt")
+	cfg.OutputPath = dir
+	cfg.OutputName = "out.zip"
+	cfg.Output = io.Discard
+
+	got := make(map[string]MatchedFile)
+	results, errs := Matches(context.Background(), cfg)
+	for file := range results {
+		got[file.Path] = file
+	}
+	if err := <-errs; err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]struct {
+		rule string
+		size int64
+	}{
+		filepath.Join(src, "a.txt"):         {"name", 5},
+		filepath.Join(src, "conf", "b.ini"): {"path", 6},
+		filepath.Join(src, "logs", "c.log"): {"directory", 7},
+	}
+	if len(got) != len(want) {
+		t.Errorf("matched %d files, want %d", len(got), len(want))
+	}
+	for path, w := range want {
+		file, ok := got[path]
+		switch {
+		case !ok:
+			t.Errorf("%s was not matched", path)
+		case file.Rule != w.rule || file.Info.Size() != w.size:
+			t.Errorf("%s matched by %q with size %d, want %q and %d", path, file.Rule, file.Info.Size(), w.rule, w.size)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, "out.zip")); !os.IsNotExist(err) {
+		t.Errorf("Matches wrote an archive: %v", err)
+	}
+}
+
+func TestMatchesCancellation(t *testing.T) {
+	dir := t.TempDir()
+	for i := 0; i < 100; i++ {
+		writeFile(t, filepath.Join(dir, "src", fmt.Sprintf("f%03d.txt", i)), "content")
+	}
+	writeFile(t, filepath.Join(dir, "list.txt"), "[files]\n*.txt\n")
+
+	cfg := DefaultConfig()
+	cfg.Directories = []string{filepath.Join(dir, "src")}
+	cfg.ListFile = filepath.Join(dir, "list.txt")
+	cfg.Output = io.Discard
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	results, errs := Matches(ctx, cfg)
+	<-results
+	cancel()
+
+	// The search ends without anyone reading the rest of the matches
+	var err error
+	select {
+	case err = <-errs:
+	case <-time.After(10 * time.Second):
+		t.Fatal("the search did not end after cancelling")
+	}
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("error %v, want context.Canceled", err)
+	}
+	read := 1
+	for range results {
+		read++
+	}
+	if read == 100 {
+		t.Error("every match was sent after cancelling")
+	}
+	if _, ok := <-errs; ok {
+		t.Error("the error channel was not closed")
+	}
+}
@@ -0,0 +1,52 @@
+package pathfinder
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// readNullList reads NUL-separated paths from r, such as the output of
+// find -print0, into the [paths] section of list. The paths are taken
+// literally, so names may contain newlines, glob characters or a leading
+// "!".
+func readNullList(list *sections, r io.Reader) error {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return fmt.Errorf("error reading list from standard input: %w", err)
+	}
+
+	sizes := list.sectionSizes()
+	for _, entry := range bytes.Split(data, []byte{0}) {
+		if len(entry) == 0 {
+			continue
+		}
+		list.filePaths = append(list.filePaths, escapeGlob(filepath.Clean(string(entry))))
+	}
+	// The paths are literal, so resolveEntries must leave them alone
+	list.resolvedPaths = len(list.filePaths)
+	list.noteOrigins("-", sizes)
+	return nil
+}
+
+// escapeGlob returns a pattern matching exactly the literal path s. Each
+// glob character is put in a character class of its own, which works on
+// every platform, unlike escaping with "\". "!" is escaped as well, so that
+// it does not negate the entry.
+func escapeGlob(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		switch {
+		case r == '*' || r == '?' || r == '[' || r == '!':
+			b.WriteString("[" + string(r) + "]")
+		case r == '\\' && os.PathSeparator != '\\':
+			b.WriteString(`[\\]`)
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
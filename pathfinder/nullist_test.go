@@ -0,0 +1,67 @@
+package pathfinder
+
+import (
+	"io"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestEscapeGlob(t *testing.T) {
+	tests := []struct {
+		s, want string
+	}{
+		{"plain.txt", "plain.txt"},
+		{"a*b?.txt", "a[*]b[?].txt"},
+		{"[x].txt", "[[]x].txt"},
+		{"!keep", "[!]keep"},
+	}
+	for _, test := range tests {
+		if got := escapeGlob(test.s); got != test.want {
+			t.Errorf("escapeGlob(%q) = %q, want %q", test.s, got, test.want)
+		}
+		if matched, err := filepath.Match(escapeGlob(test.s), test.s); err != nil || !matched {
+			t.Errorf("escapeGlob(%q) does not match itself: %v", test.s, err)
+		}
+	}
+}
+
+func TestNullList(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "src")
+	names := []string{"two\nlines.txt", "star*.txt", "[x].txt", "!bang.txt", "sub/plain.txt"}
+	if runtime.GOOS == "windows" {
+		names = []string{"[x].txt", "!bang.txt", "sub/plain.txt"}
+	}
+	for _, name := range names {
+		writeFile(t, filepath.Join(src, filepath.FromSlash(name)), name)
+	}
+	// Taken as globs, the entries would match these as well
+	for _, name := range []string{"starry.txt", "x.txt"} {
+		writeFile(t, filepath.Join(src, name), name)
+	}
+
+	var input strings.Builder
+	for _, name := range names {
+		input.WriteString(filepath.Join(src, filepath.FromSlash(name)) + "\x00")
+	}
+	input.WriteString("\x00")
+
+	cfg := DefaultConfig()
+	cfg.Directories = []string{src}
+	cfg.ListFile = "-"
+	cfg.NullList = true
+	cfg.Output = io.Discard
+
+	var got []string
+	withStdin(t, input.String(), func() {
+		got = matchNames(t, cfg, src)
+	})
+	want := slices.Clone(names)
+	slices.Sort(want)
+	if !slices.Equal(got, want) {
+		t.Errorf("matched %q, want %q", got, want)
+	}
+}
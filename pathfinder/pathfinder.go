@@ -0,0 +1,1571 @@
+// Package pathfinder collects files described by a list file into an archive.
+package pathfinder
+
+import (
+	"compress/flate"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Config describes a single Pathfinder run.
+type Config struct {
+	// Directories are the roots searched for files. A root may also be a zip,
+	// tar or tgz archive, whose entries are searched as if it were a
+	// directory. With several roots, entries are nested under a name unique
+	// to their root, see rootPrefixes.
+	Directories []string
+	// FS, when set, is searched instead of the local disk, for example an
+	// embed.FS or an fstest.MapFS. Directories then name directories within
+	// it, using "." for its root, and matched files are read from it. The
+	// archive and the list files are still written and read on disk.
+	FS fs.FS
+	// ListFile is the text file describing which files to collect, or "-"
+	// to read it from standard input. A directory stands for the ".txt"
+	// files in it, merged in order of their names.
+	ListFile string
+	// ListFiles, when not empty, replaces ListFile with several list files
+	// whose sections are merged in order. [exclude] entries apply to every
+	// file regardless of which list they come from.
+	ListFiles []string
+	// OutputPath is the directory the archive is written to.
+	OutputPath string
+	// OutputName is the archive file name. When it is empty the name is
+	// built from OutputTemplate, or a timestamped name is generated.
+	OutputName string
+	// OutputTemplate is a file name with placeholders {date}, {time}, {host},
+	// {user} and {count}, the number of archived files. The archive
+	// extension is appended when missing. {count} cannot be used together
+	// with Append or SplitSize, since the archive is named before the files
+	// are counted.
+	OutputTemplate string
+	// TimeFormat is the Go time layout of the timestamp in the generated
+	// archive name, "2006-Jan-02-15-04" when empty.
+	TimeFormat string
+	// CreateOutputDir creates OutputPath if it does not exist yet.
+	CreateOutputDir bool
+	// Force overwrites an existing archive at the output path instead of
+	// failing.
+	Force bool
+	// MaxFiles, when positive, aborts the run with ErrLimitExceeded once more
+	// than MaxFiles files have matched.
+	MaxFiles int
+	// MaxTotalBytes, when positive, aborts the run with ErrLimitExceeded once
+	// the matched files add up to more than MaxTotalBytes. Files are matched
+	// before any is written, so the cap is checked before the archive grows.
+	MaxTotalBytes int64
+	// Reproducible makes the archive depend only on the matched files by
+	// giving all entries the same timestamp, taken from SOURCE_DATE_EPOCH or
+	// 1980-01-01 when it is unset. Entries are always sorted by name. Encrypted
+	// entries still differ between runs, as each gets a random salt.
+	Reproducible bool
+	// SplitSize, when positive, splits the archive into volumes named
+	// "name.part1.zip", "name.part2.zip" and so on, each a complete archive
+	// of roughly at most SplitSize bytes. Volumes are split between files.
+	SplitSize int64
+	// Append adds the matched files to the existing zip archive at the
+	// output path. Entries already in the archive are kept, and matched files
+	// whose names are taken are skipped with a warning. Together with Prefix
+	// the new entries go below a directory of their own. The archive is
+	// rebuilt in a temporary file like every other archive, see createTemp.
+	Append bool
+	// FailOnExisting makes a matched file whose name is already taken in the
+	// archive appended to an error, see ErrSkipped, instead of a warning.
+	FailOnExisting bool
+	// Format is the archive format: zip, tar or tgz.
+	Format string
+	// Level is the flate compression level; 0 stores entries uncompressed.
+	Level int
+	// Password encrypts zip entries with WinZip AES-256 when not empty.
+	Password string
+	// MaxDepth limits how far below each search directory the walk descends.
+	// A negative value means unlimited.
+	MaxDepth int
+	// Workers is the number of goroutines reading matched files
+	// concurrently. Values below 2 read files one at a time. However many
+	// workers run, they hold at most 64 MiB of file content in memory
+	// together; files that do not fit are streamed instead.
+	Workers int
+	// OpenRetries is how many times opening a matched file is retried after
+	// a transient error such as EINTR or EAGAIN, which network file systems
+	// report now and then. Permanent errors such as a missing file or a
+	// denied permission are never retried.
+	OpenRetries int
+	// RetryBackoff is the wait before the first retry of an open, doubled
+	// for each further one.
+	RetryBackoff time.Duration
+	// Progress periodically reports counts and bytes written on stderr.
+	Progress bool
+	// Verbose enables progress output on stdout.
+	Verbose bool
+	// RespectGitignore skips the paths under [directories] entries that are
+	// ignored by .gitignore files between the search directory and the path.
+	RespectGitignore bool
+	// PreserveAbsPaths names entries by the file's absolute path without its
+	// leading separator, instead of its path relative to the search
+	// directory. A Windows drive letter becomes the first path component.
+	PreserveAbsPaths bool
+	// RelativeBase, when set, is the directory entry names are relative to
+	// instead of the search directory. Matched files outside of it cannot be
+	// archived.
+	RelativeBase string
+	// Flatten names entries by the file's base name alone. Files sharing a
+	// base name are kept apart by appending "-1", "-2" and so on before the
+	// extension of the later ones.
+	Flatten bool
+	// StripPrefix removes a leading path from entry names that start with it,
+	// so "build/dist/app.js" is stored as "dist/app.js" with a StripPrefix of
+	// "build". Only whole path components are stripped.
+	StripPrefix string
+	// Prefix, when set, is a directory every entry is nested under, applied
+	// after StripPrefix. Backslashes are treated as separators.
+	Prefix string
+	// DedupContent stores the content of byte-identical files only once. The
+	// first file in entry order is stored as usual and every later copy
+	// refers to it: as a relative symbolic link in zip archives, which have
+	// no hard links, and as a hard link in tar archives. The manifest records
+	// the entry a copy refers to as duplicate_of. Copies are only linked
+	// within the same volume of a split archive.
+	DedupContent bool
+	// IncludeEmptyDirs stores empty directories found under [directories]
+	// entries as directory entries, which are dropped otherwise.
+	IncludeEmptyDirs bool
+	// Manifest writes a JSON manifest of the archived files next to the
+	// archive.
+	Manifest bool
+	// IncludeList stores the effective list, with all list files merged and
+	// includes expanded, in the archive as .pathfinder/list.txt.
+	IncludeList bool
+	// Metadata stores a .pathfinder/metadata.json entry in the archive that
+	// records how it was made: Flags, the start time, the host and user,
+	// ToolVersion and the file counts.
+	Metadata bool
+	// Flags are the command line flags recorded in the metadata entry, by
+	// name. Callers should leave out secrets such as the password.
+	Flags map[string]string
+	// ToolVersion is the version recorded in the metadata entry.
+	ToolVersion string
+	// Extensions, when not empty, restricts archived files to those with one
+	// of the given extensions. ExcludeExtensions skips files with one of the
+	// given extensions. Extensions may be given with or without a leading dot.
+	Extensions        []string
+	ExcludeExtensions []string
+	// StoreExtensions lists extensions of files that zip archives store
+	// uncompressed, since their content is compressed already. DefaultConfig
+	// fills in common media, archive and office formats.
+	StoreExtensions []string
+	// ExcludeRegexes skips matched files whose slash-separated path relative
+	// to the search directory matches one of the regular expressions, on top
+	// of the [exclude] section.
+	ExcludeRegexes []string
+	// ExcludeFrom names files holding further [exclude] patterns, one per
+	// line, which are merged with the section of the list files.
+	ExcludeFrom []string
+	// MinSize and MaxSize restrict archived files to the given size range in
+	// bytes. Zero disables the respective bound.
+	MinSize int64
+	MaxSize int64
+	// MaxDiskSize excludes files taking more than this many bytes on disk,
+	// which is less than their apparent size for sparse and compressed
+	// files. Platforms that do not report it fall back to the apparent size.
+	// Zero disables the bound.
+	MaxDiskSize int64
+	// ModifiedAfter and ModifiedBefore restrict archived files to the given
+	// modification time range. A zero time disables the respective bound.
+	ModifiedAfter  time.Time
+	ModifiedBefore time.Time
+	// CaseInsensitive compares names, patterns and paths ignoring case.
+	CaseInsensitive bool
+	// NoHidden skips hidden files and directories, those whose name starts
+	// with a ".", along with everything below them. Otherwise hidden files
+	// are matched like any other; "*" matches ".env" as well.
+	NoHidden bool
+	// SkipDirs are directory names, or globs matched against them, that the
+	// walk prunes wherever they occur, e.g. VCSDirs and BuildDirs.
+	SkipDirs []string
+	// FollowSymlinks descends into symlinked directories, which are skipped
+	// otherwise. Symlinked files are archived with their target's content
+	// either way.
+	FollowSymlinks bool
+	// PreserveSymlinks stores symlinks as link entries holding their target,
+	// so extracting the archive recreates the links, instead of archiving
+	// the target of file links and skipping directory links. Links to
+	// directories are stored without descending into them.
+	// It has no effect with FollowSymlinks or a file system source.
+	PreserveSymlinks bool
+	// DryRun prints the matched files instead of writing an archive.
+	DryRun bool
+	// Verify reopens the finished archive, reads every entry back and checks
+	// that every [files] entry is present in it, returning ErrVerifyFailed
+	// when something is wrong. The CRC-32 of every zip entry is recomputed
+	// and compared with the stored one.
+	Verify bool
+	// ListSections prints the entries of the list files by section and
+	// returns without searching, to check how the lists were understood.
+	ListSections bool
+	// Strict makes Run return ErrUnmatched when a list entry matched nothing.
+	Strict bool
+	// ContinueOnWalkError logs errors met while searching the directories,
+	// such as an unreadable subdirectory, and carries on with the rest of
+	// the tree instead of aborting the run. They are recorded in
+	// Result.WalkErrors.
+	ContinueOnWalkError bool
+	// IgnoreErrors keeps Run from returning ErrSkipped when some files could
+	// not be archived. They are still reported in Result.Skipped.
+	IgnoreErrors bool
+	// Output receives informational output: verbose messages, the dry-run
+	// listing and the closing summary. It defaults to os.Stdout.
+	Output io.Writer
+	// ErrOutput receives errors about individual files and warnings. It
+	// defaults to os.Stderr.
+	ErrOutput io.Writer
+	// Quiet discards the informational output and progress reports, leaving
+	// only errors and warnings.
+	Quiet bool
+	// NoSummary leaves out the summary line printed once the archive is
+	// written, for callers that report the Result themselves.
+	NoSummary bool
+	// OnFileAdded, OnSkip and OnError, when set, are called for every file
+	// stored in the archive, every matched file left out on purpose (the
+	// output archive itself, or a name already present when appending) and
+	// every matched file that could not be archived. They are never called
+	// concurrently, but with Workers above 1 OnFileAdded and OnError are
+	// called from the goroutine writing the archive, not the caller's.
+	OnFileAdded func(name string, info os.FileInfo, rule string)
+	OnSkip      func(path, reason string)
+	OnError     func(path string, err error)
+	// Logger, when set, receives a structured record for every archived,
+	// skipped and failed file and one when the run completes. The message
+	// names the event, e.g. "file_added", and attributes such as path,
+	// size, rule and error describe it.
+	Logger *slog.Logger
+	// RelToList resolves relative [paths] and [directories] entries against
+	// the directory of the list file instead of the working directory.
+	// Absolute entries are used as they are. The search directories are made
+	// absolute so that walked paths compare with the resolved entries.
+	RelToList bool
+	// NullList reads the list given as "-" as NUL-separated [paths]
+	// entries, such as the output of find -print0, instead of in the list
+	// format. The paths are taken literally: glob characters, "!" and "$"
+	// have no special meaning, and names may contain newlines.
+	NullList bool
+}
+
+// ErrSkipped is returned by Run when some matched files could not be added
+// to the archive, unless IgnoreErrors is set. Result.Skipped lists them.
+var ErrSkipped = errors.New("some files could not be archived")
+
+// ErrLimitExceeded is returned by Run when the matched files exceed MaxFiles
+// or MaxTotalBytes. No archive is left behind in that case.
+var ErrLimitExceeded = errors.New("limit exceeded")
+
+// ErrUnmatched is returned by Run in strict mode when at least one entry of
+// the list file did not match any file.
+var ErrUnmatched = errors.New("some requested entries matched no files")
+
+// DefaultConfig returns a Config populated with the CLI defaults.
+func DefaultConfig() Config {
+	return Config{
+		ListFile:        "pathfinder.txt",
+		OutputPath:      ".",
+		Format:          "zip",
+		Level:           flate.DefaultCompression,
+		MaxDepth:        -1,
+		Workers:         runtime.NumCPU(),
+		OpenRetries:     3,
+		RetryBackoff:    100 * time.Millisecond,
+		StoreExtensions: append([]string(nil), defaultStoreExtensions...),
+	}
+}
+
+// Result summarizes a completed run.
+type Result struct {
+	// OutputPath is the path of the archive that was written, or of its
+	// first volume when splitting. It is empty in dry-run mode.
+	OutputPath string
+	// Volumes lists the paths of all volumes of a split archive.
+	Volumes []string
+	// FilesAdded is the number of files stored in the archive, or that would
+	// have been stored in dry-run mode.
+	FilesAdded int
+	// BytesUncompressed is the total size of the archived files, or of the
+	// files that would have been archived in dry-run mode. BytesCompressed
+	// is the size of the finished archive, summed over all volumes, and
+	// zero in dry-run mode.
+	BytesUncompressed int64
+	BytesCompressed   int64
+	// Skipped lists the matched files that could not be archived.
+	Skipped []SkippedFile
+	// WalkErrors lists the paths that could not be searched and were left
+	// out with ContinueOnWalkError.
+	WalkErrors []SkippedFile
+	// Unmatched lists the list entries that matched no file, formatted as
+	// "[section] entry".
+	Unmatched []string
+	// VerifyProblems describes what Verify found wrong with the archive.
+	VerifyProblems []string
+}
+
+// SkippedFile is a path that was left out of the archive because of an
+// error.
+type SkippedFile struct {
+	Path string
+	Err  error
+}
+
+// ruleKey identifies a single entry of the list file.
+type ruleKey struct {
+	section string
+	entry   string
+}
+
+// finder holds the state of a single run, so independent runs never share
+// mutable data.
+type finder struct {
+	ctx context.Context
+	cfg Config
+
+	// directory is the search directory currently being walked and
+	// entryPrefix the name entries found under it are nested in.
+	directory   string
+	entryPrefix string
+	// leftOutDir is the directory below which the current [directories]
+	// walk adds no files, see addDirectoryEntry.
+	leftOutDir string
+	// fsys is the file system holding the current search directory when it
+	// is not searched on disk: Config.FS or an archive given as a search
+	// directory. sourceClosers are the archives to close once the run is
+	// done.
+	fsys          fs.FS
+	sourceClosers []io.Closer
+
+	sections
+	// regexps are the compiled entries of the [regex] section.
+	regexps []listRegex
+	// excludeRegexps are the compiled ExcludeRegexes.
+	excludeRegexps []*regexp.Regexp
+
+	archiver Archiver
+
+	// pipeline reads matched files concurrently when several workers are
+	// configured.
+	pipeline *pipeline
+	// onMatch receives the matched files of a dry run, see Matches.
+	onMatch func(MatchedFile)
+	// openFile opens matched files on disk. It is os.Open unless replaced,
+	// for example to inject errors.
+	openFile func(name string) (*os.File, error)
+
+	// outputAbsPath is the absolute path of the archive being written, so the
+	// walk never adds the archive to itself.
+	outputAbsPath string
+	// tempPath is the temporary file the archive is written to until it is
+	// complete; see createTemp.
+	tempPath string
+	// outputInfos describe the archive being replaced and the temporary
+	// files written, so isOutput recognizes them under any path.
+	outputInfos []os.FileInfo
+	// splitPath is the archive path that volumes are named after when
+	// splitting, and volumeFiles the number of files in the current volume.
+	splitPath   string
+	volumeFiles int
+	// queued holds the matched files until the walk is done.
+	queued []archiveJob
+	// entryTime is the timestamp given to the entries of a reproducible
+	// archive.
+	entryTime time.Time
+	// gitignores caches the patterns of the .gitignore file of each
+	// directory, and ignoredDirs whether a directory is ignored.
+	gitignores  map[string][]gitignorePattern
+	ignoredDirs map[string]bool
+	// stopErr, once set, aborts the walk.
+	stopErr error
+	// matchedBytes is the total size of the matched files, kept when
+	// MaxTotalBytes is set.
+	matchedBytes int64
+	// flatNames holds the entry names given out when flattening.
+	flatNames map[string]struct{}
+	// existingNames holds the entries copied from the archive appended to.
+	existingNames map[string]struct{}
+	// output counts the bytes written to the archive.
+	output *countingWriter
+
+	// addedFiles tracks the absolute paths already written to the archive so
+	// a file matched by several sections is only stored once.
+	addedFiles map[string]struct{}
+
+	// contentNames maps the SHA-256 of every stored file to its entry name
+	// when DedupContent is set. Only the archive writer uses it.
+	contentNames map[string]string
+
+	// manifest collects an entry for every archived file when a manifest
+	// was requested.
+	manifest []manifestEntry
+
+	// progress reports the run's progress when enabled.
+	progress *progressReporter
+
+	// matched records the list entries that matched at least one file.
+	matched map[ruleKey]struct{}
+
+	// skippedMu guards result.Skipped, which the pipeline's writer appends
+	// to concurrently with the walk.
+	skippedMu sync.Mutex
+
+	result Result
+}
+
+// Run searches the configured directories for the files described by the
+// list file and writes them into a new archive. The returned Result
+// describes the run; when an error is returned it covers the files handled
+// up to that point.
+func Run(cfg Config) (Result, error) {
+	return RunContext(context.Background(), cfg)
+}
+
+// RunContext is like Run but stops when ctx is done, returning ctx.Err().
+// The partial archive is removed in that case.
+func RunContext(ctx context.Context, cfg Config) (Result, error) {
+	return run(ctx, cfg, nil)
+}
+
+// run implements RunContext. In dry-run mode, matched files are passed to
+// onMatch instead of being listed on the output when it is not nil.
+func run(ctx context.Context, cfg Config, onMatch func(MatchedFile)) (result Result, err error) {
+	if cfg.Format == "" {
+		cfg.Format = "zip"
+	}
+	if cfg.Output == nil {
+		cfg.Output = os.Stdout
+	}
+	if cfg.ErrOutput == nil {
+		cfg.ErrOutput = os.Stderr
+	}
+	archiveToStdout := cfg.OutputName == "-" && !cfg.DryRun && !cfg.ListSections
+	if cfg.Quiet || (archiveToStdout && cfg.Output == os.Stdout) {
+		// Informational output would corrupt an archive written to stdout
+		cfg.Output = io.Discard
+		cfg.Progress = false
+	}
+
+	// Check if the specified directories exist, unless they are not searched
+	for _, dir := range cfg.Directories {
+		if cfg.ListSections {
+			break
+		}
+		if _, err := statDirectory(cfg.FS, dir); os.IsNotExist(err) {
+			return Result{}, fmt.Errorf("the specified directory %s does not exist", dir)
+		}
+	}
+
+	// Check if the specified list files exist
+	listFiles := cfg.ListFiles
+	if len(listFiles) == 0 {
+		listFiles = []string{cfg.ListFile}
+	}
+	for _, listFile := range listFiles {
+		if _, err := os.Stat(listFile); listFile != "-" && os.IsNotExist(err) {
+			return Result{}, fmt.Errorf("the specified list file %s does not exist", listFile)
+		}
+	}
+
+	if cfg.NullList && !slices.Contains(listFiles, "-") {
+		return Result{}, fmt.Errorf("NUL-separated lists are only read from standard input")
+	}
+
+	// Check if the specified archive format is supported
+	if cfg.Format != "zip" && cfg.Format != "tar" && cfg.Format != "tgz" {
+		return Result{}, fmt.Errorf("the archive format %q is not supported", cfg.Format)
+	}
+
+	// Check if encryption was requested for a format that cannot carry it
+	if cfg.Password != "" && cfg.Format != "zip" {
+		return Result{}, fmt.Errorf("password protection is only supported for zip archives")
+	}
+
+	// Check if appending was requested for an archive that cannot take it
+	toStdout := cfg.OutputName == "-"
+	if cfg.Append && (cfg.Format != "zip" || toStdout) {
+		return Result{}, fmt.Errorf("appending is only supported for zip archive files")
+	}
+
+	// Check if splitting was requested for an archive that cannot take it
+	if cfg.SplitSize > 0 && (cfg.Append || toStdout) {
+		return Result{}, fmt.Errorf("splitting is not supported when appending or writing to stdout")
+	}
+
+	// Check if a manifest was requested next to an archive that has no path
+	if toStdout && cfg.Manifest {
+		return Result{}, fmt.Errorf("a manifest cannot be written when the archive goes to stdout")
+	}
+	if toStdout && cfg.Verify {
+		return Result{}, fmt.Errorf("an archive written to stdout cannot be verified")
+	}
+	if cfg.OutputName == "" && strings.Contains(cfg.OutputTemplate, countPlaceholder) && (cfg.Append || cfg.SplitSize > 0) {
+		return Result{}, fmt.Errorf("the output template cannot use %s when appending or splitting", countPlaceholder)
+	}
+	if cfg.TimeFormat != "" {
+		if err := checkTimeFormat(cfg.TimeFormat); err != nil {
+			return Result{}, err
+		}
+	}
+	if cfg.RelativeBase != "" {
+		if cfg.RelativeBase, err = filepath.Abs(cfg.RelativeBase); err != nil {
+			return Result{}, fmt.Errorf("error resolving relative base: %w", err)
+		}
+	}
+	if cfg.FS != nil && cfg.RelToList {
+		return Result{}, fmt.Errorf("list-relative entries cannot be used when searching a file system other than the disk")
+	}
+	if cfg.Flatten && cfg.PreserveAbsPaths {
+		return Result{}, fmt.Errorf("flattened entry names cannot preserve absolute paths")
+	}
+
+	// Check if the specified compression level is valid
+	if cfg.Level < flate.DefaultCompression || cfg.Level > flate.BestCompression {
+		return Result{}, fmt.Errorf("the compression level must be between -1 and 9")
+	}
+
+	// Read the text file
+	list, err := readTextFile(listFiles, cfg.RelToList, cfg.NullList)
+	if err != nil {
+		return Result{}, err
+	}
+	for _, excludeFile := range cfg.ExcludeFrom {
+		if err := readExcludeFile(&list, excludeFile); err != nil {
+			return Result{}, err
+		}
+	}
+
+	if cfg.RelToList {
+		directories := make([]string, len(cfg.Directories))
+		for i, dir := range cfg.Directories {
+			if directories[i], err = filepath.Abs(dir); err != nil {
+				return Result{}, fmt.Errorf("error resolving directory %s: %w", dir, err)
+			}
+		}
+		cfg.Directories = directories
+	}
+
+	regexps, err := compileRegexes(list.regexes, cfg.CaseInsensitive)
+	if err != nil {
+		return Result{}, err
+	}
+	excludeRegexps, err := compileExcludeRegexes(cfg.ExcludeRegexes, cfg.CaseInsensitive)
+	if err != nil {
+		return Result{}, err
+	}
+
+	// Warn about sections whose lines were dropped, which usually means a
+	// misspelled header
+	for _, name := range list.unknownSections {
+		fmt.Fprintf(cfg.ErrOutput, "Warning: ignoring lines under unknown section [%s] in the list file\n", name)
+	}
+
+	if cfg.ListSections {
+		printSections(cfg.Output, &list)
+		return Result{}, nil
+	}
+
+	f := &finder{
+		ctx:            ctx,
+		cfg:            cfg,
+		onMatch:        onMatch,
+		sections:       list,
+		regexps:        regexps,
+		excludeRegexps: excludeRegexps,
+		addedFiles:     make(map[string]struct{}),
+		matched:        make(map[ruleKey]struct{}),
+	}
+	if cfg.Progress {
+		f.progress = newProgressReporter(cfg.ErrOutput)
+	}
+	if cfg.Reproducible {
+		if f.entryTime, err = entryTime(); err != nil {
+			return Result{}, err
+		}
+	}
+
+	// Check if the output directory exists, creating it if requested
+	if !cfg.DryRun && !toStdout {
+		if err := ensureOutputDir(cfg.OutputPath, cfg.CreateOutputDir); err != nil {
+			return Result{}, err
+		}
+	}
+
+	// Create a new archive unless we are only previewing the matches. A name
+	// depending on the number of files is settled once they are written.
+	started := time.Now()
+	outputFilename := generateOutputFilename(cfg.OutputName, cfg.OutputTemplate, cfg.TimeFormat, cfg.Format, started, -1)
+	outputPathAndName := filepath.Join(cfg.OutputPath, outputFilename)
+	countInName := cfg.OutputName == "" && strings.Contains(cfg.OutputTemplate, countPlaceholder)
+	if toStdout {
+		outputPathAndName = "-"
+	}
+
+	if !cfg.DryRun {
+		if cfg.SplitSize > 0 {
+			f.splitPath = outputPathAndName
+			err = f.openVolume()
+		} else {
+			err = f.createZipArchive(outputPathAndName)
+		}
+		if err != nil {
+			return f.result, fmt.Errorf("error creating archive: %w", err)
+		}
+
+		defer func() {
+			if err != nil {
+				// Leave the output path as it was
+				f.discardTemp()
+			}
+			if closeErr := f.closeResources(); closeErr != nil && err == nil {
+				err = closeErr
+			}
+		}()
+	}
+
+	if !cfg.DryRun && cfg.Workers > 1 {
+		f.startPipeline(cfg.Workers)
+		defer f.stopPipeline()
+	}
+	defer f.closeSources()
+
+	// Search for files in each of the specified directories. With more than
+	// one root, entries are nested under a name unique to the root so files
+	// from different roots cannot collide.
+	var prefixes []string
+	if len(cfg.Directories) > 1 {
+		prefixes = rootPrefixes(cfg.Directories)
+	}
+	for i, dir := range cfg.Directories {
+		f.directory = dir
+		if prefixes != nil {
+			f.entryPrefix = prefixes[i]
+		}
+		if err := f.openSource(dir); err != nil {
+			return f.result, err
+		}
+		if err := f.searchFiles(f.directory); err != nil {
+			return f.result, fmt.Errorf("error searching %s: %w", dir, err)
+		}
+	}
+	f.writeQueued()
+
+	// Wait for queued files to be written before reporting on them
+	f.stopPipeline()
+	f.progress.finish()
+	if err := ctx.Err(); err != nil {
+		return f.result, err
+	}
+
+	if !cfg.DryRun {
+		if cfg.IncludeList {
+			if err := f.addListEntry(); err != nil {
+				return f.result, err
+			}
+		}
+		if cfg.Metadata {
+			if err := f.addMetadataEntry(started); err != nil {
+				return f.result, err
+			}
+		}
+		if countInName && !toStdout {
+			outputFilename = generateOutputFilename("", cfg.OutputTemplate, cfg.TimeFormat, cfg.Format, started, f.result.FilesAdded)
+			outputPathAndName = filepath.Join(cfg.OutputPath, outputFilename)
+			if err := f.renameOutput(outputPathAndName); err != nil {
+				return f.result, err
+			}
+		}
+
+		// Close the archive now so that its final size is known
+		if err := f.closeResources(); err != nil {
+			return f.result, err
+		}
+
+		if cfg.Verbose {
+			fmt.Fprintf(cfg.Output, "New archive created: %s\n", outputFilename)
+		}
+		if !cfg.NoSummary {
+			fmt.Fprintln(cfg.Output, summary(f.result))
+		}
+		f.result.OutputPath = outputPathAndName
+		if cfg.SplitSize > 0 {
+			f.result.OutputPath = f.result.Volumes[0]
+		}
+
+		if cfg.Manifest {
+			manifestPath := manifestFilename(outputPathAndName, cfg.Format)
+			if err := writeManifest(manifestPath, f.manifest); err != nil {
+				return f.result, err
+			}
+		}
+
+		if cfg.Verify {
+			archives := []string{outputPathAndName}
+			if cfg.SplitSize > 0 {
+				archives = f.result.Volumes
+			}
+			f.result.VerifyProblems = f.verifyArchive(archives)
+			if len(f.result.VerifyProblems) > 0 {
+				f.result.Unmatched = f.unmatchedEntries()
+				return f.result, ErrVerifyFailed
+			}
+			if cfg.Verbose {
+				fmt.Fprintln(cfg.Output, "Archive verified")
+			}
+		}
+	}
+
+	f.result.Unmatched = f.unmatchedEntries()
+	f.log(slog.LevelInfo, eventRunComplete,
+		slog.String("output", f.result.OutputPath),
+		slog.Int("files", f.result.FilesAdded),
+		slog.Int64("bytes_uncompressed", f.result.BytesUncompressed),
+		slog.Int64("bytes_compressed", f.result.BytesCompressed),
+		slog.Int("skipped", len(f.result.Skipped)),
+		slog.Int("unmatched", len(f.result.Unmatched)))
+	if len(f.result.Skipped) > 0 && !cfg.IgnoreErrors {
+		return f.result, ErrSkipped
+	}
+	if cfg.Strict && len(f.result.Unmatched) > 0 {
+		return f.result, ErrUnmatched
+	}
+	return f.result, nil
+}
+
+func (f *finder) searchFiles(dir string) error {
+	return f.walk(dir, func(path string, d fs.DirEntry, err error) error {
+		if err := f.ctx.Err(); err != nil {
+			return err
+		}
+		if err != nil {
+			return f.walkFailed(path, err)
+		}
+
+		if d.IsDir() && f.exceedsDepth(path) {
+			return filepath.SkipDir
+		}
+		if f.pruned(path, dir, d) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		f.handleFileByNames(path, d)
+		f.handleFileByPaths(path, d)
+		f.handleFileByRegex(path, d)
+		if err := f.handleDirectories(path, d); err != nil {
+			return err
+		}
+		return f.stopErr
+	})
+}
+
+func (f *finder) handleFileByNames(path string, d fs.DirEntry) {
+	if d.IsDir() || f.shouldExclude(path, d) || !f.passesFilters(d) {
+		return
+	}
+
+	name := f.fold(d.Name())
+	matched, err := matchesAnyPattern(name, f.foldAll(f.fileNames))
+	if err != nil && f.cfg.Verbose {
+		fmt.Fprintln(f.cfg.ErrOutput, "Error matching file name pattern:", err)
+	}
+	if matched {
+		f.markMatched("files", f.fileNames, func(pattern string) bool {
+			ok, _ := filepath.Match(f.fold(pattern), name)
+			return ok
+		})
+		if f.cfg.Verbose {
+			fmt.Fprintf(f.cfg.Output, "Found by name: %s\n", path)
+		}
+
+		// Add the file to the new zip archive
+		if err := f.addFile(path, "name"); err != nil {
+			f.fileFailed(path, err)
+		}
+	}
+}
+
+func (f *finder) handleFileByPaths(path string, d fs.DirEntry) {
+	if d.IsDir() || f.shouldExclude(path, d) || !f.passesFilters(d) {
+		return
+	}
+
+	// Check if the path lies under the specified paths
+	matches := func(spec string) bool {
+		return pathMatches(f.fold(path), f.fold(spec))
+	}
+	if evaluateRules(f.filePaths, matches) {
+		f.markMatched("paths", f.filePaths, matches)
+		f.handleFoundPath(path)
+	}
+}
+
+func (f *finder) handleFoundPath(path string) {
+	if f.cfg.Verbose {
+		fmt.Fprintf(f.cfg.Output, "Found by path: %s\n", path)
+	}
+
+	// Add the file to the new zip archive
+	if err := f.addFile(path, "path"); err != nil {
+		f.fileFailed(path, err)
+	}
+}
+
+// handleDirectories collects the files below path when the [directories]
+// section selects it. That walk applies the other sections too, so it returns
+// filepath.SkipDir for the search walk not to visit the subtree again.
+func (f *finder) handleDirectories(path string, d fs.DirEntry) error {
+	if !d.IsDir() || !isUnderDirectory(f.fold(path), true, f.foldAll(f.directories)) {
+		return nil
+	}
+	if f.cfg.Verbose {
+		fmt.Fprintf(f.cfg.Output, "Found under directory: %s\n", path)
+	}
+
+	// Add all files under the directory to the new zip archive
+	f.leftOutDir = ""
+	if err := f.walk(path, f.addFilesToZip); err != nil {
+		return fmt.Errorf("error walking through directory %s: %w", path, err)
+	}
+	if f.stopErr != nil {
+		return f.stopErr
+	}
+	return filepath.SkipDir
+}
+
+// addFilesToZip handles an entry below a directory selected by the
+// [directories] section. Directories that section leaves out, being
+// excluded, ignored or below a shallow entry, are still walked for the
+// [files], [paths] and [regex] sections, unless those are empty.
+func (f *finder) addFilesToZip(subPath string, subEntry fs.DirEntry, subErr error) error {
+	if err := f.ctx.Err(); err != nil {
+		return err
+	}
+	if subErr != nil {
+		return f.walkFailed(subPath, subErr)
+	}
+	if subEntry.IsDir() && f.exceedsDepth(subPath) {
+		return filepath.SkipDir
+	}
+	if f.pruned(subPath, f.directory, subEntry) {
+		if subEntry.IsDir() {
+			return filepath.SkipDir
+		}
+		return nil
+	}
+
+	if f.leftOutDir == "" || !isWithin(subPath, f.leftOutDir) {
+		f.leftOutDir = ""
+		if err := f.addDirectoryEntry(subPath, subEntry); err != nil {
+			return err
+		}
+	}
+
+	f.handleFileByNames(subPath, subEntry)
+	f.handleFileByPaths(subPath, subEntry)
+	f.handleFileByRegex(subPath, subEntry)
+	return f.stopErr
+}
+
+// addDirectoryEntry applies the [directories] section to an entry below a
+// selected directory. A directory the section leaves out is recorded in
+// leftOutDir, or skipped when no other section could match below it.
+func (f *finder) addDirectoryEntry(subPath string, subEntry fs.DirEntry) error {
+	leaveOut := f.shouldExclude(subPath, subEntry) ||
+		(f.cfg.RespectGitignore && f.gitignored(subPath, subEntry.IsDir())) ||
+		// Shallow [directories] entries leave their subdirectories alone
+		(subEntry.IsDir() && !descendsInto(f.fold(subPath), f.foldAll(f.directories)))
+	if leaveOut {
+		if subEntry.IsDir() {
+			if len(f.fileNames) == 0 && len(f.filePaths) == 0 && len(f.regexps) == 0 {
+				return filepath.SkipDir
+			}
+			f.leftOutDir = subPath
+		}
+		return nil
+	}
+
+	if subEntry.IsDir() {
+		if !isUnderDirectory(f.fold(subPath), true, f.foldAll(f.directories)) {
+			return nil
+		}
+		f.markMatched("directories", f.directories, func(entry string) bool {
+			return directoryMatches(f.fold(subPath), true, f.fold(entry))
+		})
+		if f.cfg.IncludeEmptyDirs && f.isEmptyDir(subPath) {
+			if err := f.addEmptyDir(subPath, "directory"); err != nil {
+				f.fileFailed(subPath, err)
+			}
+		}
+		return nil
+	}
+
+	// Files under a matched directory may still be removed by a later "!"
+	// entry of the [directories] section
+	if f.passesFilters(subEntry) && isUnderDirectory(f.fold(subPath), false, f.foldAll(f.directories)) {
+		// Add the file to the new zip archive
+		if err := f.addFile(subPath, "directory"); err != nil {
+			f.fileFailed(subPath, err)
+		}
+	}
+	return nil
+}
+
+// fileFailed reports that the matched file at path could not be archived and
+// records it in the result.
+func (f *finder) fileFailed(path string, err error) {
+	fmt.Fprintln(f.cfg.ErrOutput, "Error adding file to archive:", err)
+
+	f.skippedMu.Lock()
+	defer f.skippedMu.Unlock()
+	f.result.Skipped = append(f.result.Skipped, SkippedFile{Path: path, Err: err})
+	f.log(slog.LevelError, eventFileFailed, slog.String("path", path), slog.String("error", err.Error()))
+	if f.cfg.OnError != nil {
+		f.cfg.OnError(path, err)
+	}
+}
+
+// walkFailed handles an error met while walking path. It is returned to abort
+// the walk unless ContinueOnWalkError is set, in which case it is logged and
+// recorded once per path, and the walk goes on without path.
+func (f *finder) walkFailed(path string, err error) error {
+	if !f.cfg.ContinueOnWalkError {
+		return err
+	}
+	for _, failed := range f.result.WalkErrors {
+		if failed.Path == path {
+			return nil
+		}
+	}
+	fmt.Fprintln(f.cfg.ErrOutput, "Error searching path:", err)
+	f.result.WalkErrors = append(f.result.WalkErrors, SkippedFile{Path: path, Err: err})
+	f.log(slog.LevelWarn, eventWalkError, slog.String("path", path), slog.String("error", err.Error()))
+	return nil
+}
+
+// markMatched records every entry of section for which match returns true.
+func (f *finder) markMatched(section string, entries []string, match func(entry string) bool) {
+	for _, entry := range entries {
+		if match(entry) {
+			f.matched[ruleKey{section, entry}] = struct{}{}
+		}
+	}
+}
+
+// unmatchedEntries returns the list entries that matched no file. When the
+// entries were read from several list files, each names the file it came
+// from.
+func (f *finder) unmatchedEntries() []string {
+	var unmatched []string
+	for _, group := range f.sectionEntries() {
+		if group.section == "exclude" {
+			continue
+		}
+		for _, entry := range group.entries {
+			if strings.HasPrefix(entry, "!") {
+				continue
+			}
+			key := ruleKey{group.section, entry}
+			if _, ok := f.matched[key]; ok {
+				continue
+			}
+			description := fmt.Sprintf("[%s] %s", group.section, printableName(entry))
+			if origin, ok := f.origins[key]; ok && f.listFiles > 1 {
+				description += fmt.Sprintf(" (from %s)", origin)
+			}
+			unmatched = append(unmatched, description)
+		}
+	}
+	return unmatched
+}
+
+// defaultTimeFormat is the layout of the timestamp in generated archive
+// names.
+const defaultTimeFormat = "2006-Jan-02-15-04"
+
+// generateOutputFilename returns the archive file name for the run: the
+// name given by the user, the expanded template, or a default name
+// timestamped with the layout timeFormat. count is the number of archived
+// files, or negative while it is not known.
+func generateOutputFilename(userProvidedName, template, timeFormat, format string, now time.Time, count int) string {
+	if userProvidedName != "" {
+		return userProvidedName
+	}
+	if template != "" {
+		return expandOutputTemplate(template, format, now, count)
+	}
+	if timeFormat == "" {
+		timeFormat = defaultTimeFormat
+	}
+	return fmt.Sprintf("request-%s%s", now.Format(timeFormat), archiveExtension(format))
+}
+
+// checkTimeFormat rejects layouts that contain no date or time fields, which
+// would give every archive the same name, and layouts that produce a path
+// separator.
+func checkTimeFormat(layout string) error {
+	formatted := reproducibleTime.Format(layout)
+	if formatted == layout {
+		return fmt.Errorf("the time format %q contains no date or time fields", layout)
+	}
+	if strings.ContainsAny(formatted, `/\`) {
+		return fmt.Errorf("the time format %q produces a path separator", layout)
+	}
+	return nil
+}
+
+// ensureOutputDir checks that dir exists and is a directory. A missing
+// directory is created when create is set.
+func ensureOutputDir(dir string, create bool) error {
+	info, err := os.Stat(dir)
+	if os.IsNotExist(err) {
+		if !create {
+			return fmt.Errorf("output directory %s does not exist (use -mkdir to create it)", dir)
+		}
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return fmt.Errorf("failed to create output directory: %w", err)
+		}
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("output path %s is not a directory", dir)
+	}
+	return nil
+}
+
+// isOutput reports whether the file at absPath is the archive being written,
+// either by its path or, for paths reaching it through symlinks or other
+// aliases, by its device and inode.
+func (f *finder) isOutput(absPath string) bool {
+	if f.cfg.SplitSize > 0 && f.isVolume(absPath) {
+		return true
+	}
+	if f.cfg.SplitSize <= 0 && (absPath == f.outputAbsPath || absPath == f.tempPath) {
+		return true
+	}
+	if len(f.outputInfos) == 0 {
+		return false
+	}
+	info, err := os.Stat(absPath)
+	if err != nil {
+		return false
+	}
+	for _, output := range f.outputInfos {
+		if os.SameFile(info, output) {
+			return true
+		}
+	}
+	return false
+}
+
+// createZipArchive opens the output archive at outputPathAndName, or on
+// standard output when it is "-".
+func (f *finder) createZipArchive(outputPathAndName string) error {
+	if outputPathAndName == "-" {
+		return f.openArchiver(newStdoutWriter())
+	}
+
+	var err error
+	f.outputAbsPath, err = filepath.Abs(outputPathAndName)
+	if err != nil {
+		return err
+	}
+	if f.cfg.Append {
+		return f.appendArchive(f.outputAbsPath)
+	}
+
+	// Refuse to clobber an existing archive unless overwriting was requested
+	existing, err := os.Stat(outputPathAndName)
+	if err == nil && !f.cfg.Force {
+		return fmt.Errorf("output file %s already exists (use -force to overwrite)", outputPathAndName)
+	}
+	mode := os.FileMode(0o644)
+	if err == nil {
+		mode = existing.Mode().Perm()
+		f.outputInfos = append(f.outputInfos, existing)
+	}
+
+	archiveFile, err := f.createTemp(mode)
+	if err != nil {
+		return err
+	}
+	if err := f.openArchiver(archiveFile); err != nil {
+		archiveFile.Close()
+		f.discardTemp()
+		return err
+	}
+	return nil
+}
+
+// renameOutput changes the path the archive is moved to once it is complete,
+// checking it like createZipArchive checks the original one.
+func (f *finder) renameOutput(outputPathAndName string) error {
+	absPath, err := filepath.Abs(outputPathAndName)
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(absPath); err == nil && !f.cfg.Force {
+		return fmt.Errorf("output file %s already exists (use -force to overwrite)", outputPathAndName)
+	}
+	f.outputAbsPath = absPath
+	return nil
+}
+
+// createTemp creates the temporary file the archive is written to, next to
+// the output path so that it can be renamed into place once complete. This
+// way the output path only ever holds a complete archive.
+func (f *finder) createTemp(mode os.FileMode) (*os.File, error) {
+	temp, err := os.CreateTemp(filepath.Dir(f.outputAbsPath), "."+filepath.Base(f.outputAbsPath)+".tmp-*")
+	if err != nil {
+		return nil, err
+	}
+	f.tempPath = temp.Name()
+	if err := temp.Chmod(mode); err != nil {
+		temp.Close()
+		f.discardTemp()
+		return nil, err
+	}
+	if info, err := temp.Stat(); err == nil {
+		f.outputInfos = append(f.outputInfos, info)
+	}
+	return temp, nil
+}
+
+// discardTemp closes the archive being written to the temporary file and
+// removes that file, leaving the output path untouched.
+func (f *finder) discardTemp() {
+	if f.tempPath == "" {
+		return
+	}
+	if f.archiver != nil {
+		f.archiver.Close()
+		f.archiver = nil
+	}
+	os.Remove(f.tempPath)
+	f.tempPath = ""
+}
+
+// openArchiver creates the archive writer for the requested format on out.
+func (f *finder) openArchiver(out io.WriteCloser) error {
+	f.output = &countingWriter{WriteCloser: out}
+
+	var err error
+	f.archiver, err = newArchiver(f.cfg.Format, f.output, f.cfg.Level, f.cfg.Password, f.cfg.StoreExtensions)
+	return err
+}
+
+// addFile queues a file matched by rule for the archive, skipping files that
+// were already added and the output archive itself. Queued files are written
+// by writeQueued once the walk is done. In dry-run mode the match is printed
+// instead.
+func (f *finder) addFile(filePath, rule string) error {
+	return f.addEntry(filePath, rule, false)
+}
+
+// addEmptyDir queues an entry for the empty directory dirPath, see addFile.
+func (f *finder) addEmptyDir(dirPath, rule string) error {
+	return f.addEntry(dirPath, rule, true)
+}
+
+// addEntry queues a file, or an empty directory when dir is set.
+func (f *finder) addEntry(filePath, rule string, dir bool) error {
+	absPath, err := filepath.Abs(filePath)
+	if err != nil {
+		return fmt.Errorf("failed to resolve absolute path: %w", err)
+	}
+	if _, ok := f.addedFiles[absPath]; ok {
+		return nil
+	}
+	if f.fsys == nil && f.isOutput(absPath) {
+		if f.cfg.Verbose {
+			fmt.Fprintf(f.cfg.Output, "Skipping output archive: %s\n", filePath)
+		}
+		f.log(slog.LevelInfo, eventFileSkipped, slog.String("path", filePath), slog.String("reason", "output archive"))
+		if f.cfg.OnSkip != nil {
+			f.cfg.OnSkip(filePath, "output archive")
+		}
+		return nil
+	}
+	f.addedFiles[absPath] = struct{}{}
+	f.progress.fileMatched()
+
+	// Fail fast when a list entry matches far more than intended
+	if f.cfg.MaxFiles > 0 && len(f.addedFiles) > f.cfg.MaxFiles {
+		f.stopErr = fmt.Errorf("%w: more than %d files matched", ErrLimitExceeded, f.cfg.MaxFiles)
+		return nil
+	}
+	if f.cfg.MaxTotalBytes > 0 && !dir {
+		info, err := f.stat(filePath)
+		if err != nil {
+			return err
+		}
+		f.matchedBytes += info.Size()
+		if f.matchedBytes > f.cfg.MaxTotalBytes {
+			f.stopErr = fmt.Errorf("%w: matched files exceed %s", ErrLimitExceeded, formatBytes(f.cfg.MaxTotalBytes))
+			return nil
+		}
+	}
+
+	if f.cfg.DryRun {
+		info, err := f.stat(filePath)
+		if f.onMatch != nil {
+			if err != nil {
+				return err
+			}
+			f.onMatch(MatchedFile{Path: filePath, Info: info, Rule: rule})
+		} else if dir {
+			fmt.Fprintf(f.cfg.Output, "%s\t%s\n", rule, printableName(filePath+string(filepath.Separator)))
+		} else {
+			fmt.Fprintf(f.cfg.Output, "%s\t%s\n", rule, printableName(filePath))
+		}
+		f.result.FilesAdded++
+		if err == nil && !dir {
+			f.result.BytesUncompressed += info.Size()
+		}
+		return nil
+	}
+
+	name := entryName(filePath, f.directory)
+	switch {
+	case f.cfg.Flatten:
+		name = f.flatName(filePath)
+	case f.cfg.PreserveAbsPaths:
+		name = absEntryName(absPath)
+	case f.cfg.RelativeBase != "":
+		rel, err := filepath.Rel(f.cfg.RelativeBase, absPath)
+		if err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return fmt.Errorf("file is not under the relative base %s", f.cfg.RelativeBase)
+		}
+		name = filepath.ToSlash(rel)
+	case f.entryPrefix != "":
+		name = f.entryPrefix + "/" + name
+	}
+	name = stripEntryPrefix(name, f.cfg.StripPrefix)
+	if prefix := strings.Trim(strings.ReplaceAll(f.cfg.Prefix, "\\", "/"), "/"); prefix != "" {
+		name = path.Join(prefix, name)
+	}
+	if dir {
+		name += "/"
+	}
+	if _, ok := f.existingNames[name]; ok {
+		if f.cfg.FailOnExisting {
+			return fmt.Errorf("%s is already in the archive", name)
+		}
+		fmt.Fprintf(f.cfg.ErrOutput, "Warning: skipping %s, already in archive\n", name)
+		f.log(slog.LevelInfo, eventFileSkipped, slog.String("path", filePath), slog.String("reason", "already in archive"))
+		if f.cfg.OnSkip != nil {
+			f.cfg.OnSkip(filePath, "already in archive")
+		}
+		return nil
+	}
+
+	job := archiveJob{path: filePath, absPath: absPath, name: name, rule: rule, dir: dir}
+	if f.fsys != nil {
+		job.fsys, job.fsPath = f.fsys, f.fsPath(filePath)
+	}
+	f.queued = append(f.queued, job)
+	return nil
+}
+
+// writeQueued writes the files queued during the walk sorted by their name in
+// the archive, so the order of entries does not depend on the walk.
+func (f *finder) writeQueued() {
+	sort.Slice(f.queued, func(i, j int) bool {
+		return f.queued[i].name < f.queued[j].name
+	})
+	for _, job := range f.queued {
+		if f.ctx.Err() != nil {
+			break
+		}
+		if err := f.dispatch(job); err != nil {
+			f.fileFailed(job.path, err)
+		}
+	}
+	f.queued = nil
+}
+
+// dispatch stores the file of job in the archive, or queues it with the
+// pipeline when one is running.
+func (f *finder) dispatch(job archiveJob) error {
+	if f.pipeline != nil {
+		f.pipeline.enqueue(job)
+		return nil
+	}
+	return f.addToZipArchive(f.prepareFile(job, nil))
+}
+
+// addToZipArchive writes a prepared file into the archive and records it in
+// the result and manifest.
+func (f *finder) addToZipArchive(prepared preparedFile) error {
+	if prepared.err != nil {
+		return prepared.err
+	}
+
+	job := prepared.job
+	reader := prepared.reader()
+	if prepared.file != nil {
+		defer prepared.file.Close()
+	}
+
+	// Nothing more is written once the run is cancelled; Run reports it
+	if f.ctx.Err() != nil {
+		return nil
+	}
+
+	if err := f.prepareVolume(job.name, prepared.info.Size()); err != nil {
+		return err
+	}
+	info := prepared.info
+	if f.cfg.Reproducible {
+		info = fixedTimeInfo{FileInfo: info, modTime: f.entryTime}
+	}
+
+	// Refer to an earlier copy of the content instead of storing it again
+	duplicateOf := ""
+	if f.cfg.DedupContent && !job.dir && prepared.link == "" {
+		duplicateOf = f.contentNames[prepared.checksum()]
+	}
+	if prepared.link != "" {
+		if err := f.archiver.(symlinker).addSymlink(job.name, prepared.link, info); err != nil {
+			return err
+		}
+	} else if duplicateOf != "" {
+		if err := f.archiver.(linker).addLink(job.name, duplicateOf, info); err != nil {
+			return err
+		}
+	} else if err := f.archiver.AddFile(job.name, reader, info); err != nil {
+		return err
+	}
+
+	checksum := prepared.checksum()
+	if f.cfg.DedupContent && !job.dir && prepared.link == "" && duplicateOf == "" {
+		if f.contentNames == nil {
+			f.contentNames = make(map[string]string)
+		}
+		f.contentNames[checksum] = job.name
+	}
+	if f.cfg.Verbose {
+		if prepared.link != "" {
+			fmt.Fprintf(f.cfg.Output, "Added %s as a symlink to %s\n", job.name, prepared.link)
+		} else if duplicateOf != "" {
+			fmt.Fprintf(f.cfg.Output, "Added %s as a link to %s (sha256 %s)\n", job.name, duplicateOf, checksum)
+		} else {
+			fmt.Fprintf(f.cfg.Output, "Added %s (sha256 %s)\n", job.name, checksum)
+		}
+	}
+
+	if f.cfg.Manifest {
+		f.manifest = append(f.manifest, manifestEntry{
+			Name:        job.name,
+			Path:        job.absPath,
+			Size:        prepared.info.Size(),
+			Modified:    prepared.info.ModTime(),
+			Rule:        job.rule,
+			SHA256:      checksum,
+			DuplicateOf: duplicateOf,
+		})
+	}
+
+	f.result.FilesAdded++
+	f.result.BytesUncompressed += prepared.info.Size()
+	f.progress.fileAdded(prepared.info.Size())
+	f.log(slog.LevelDebug, eventFileAdded,
+		slog.String("path", job.path),
+		slog.String("name", job.name),
+		slog.Int64("size", prepared.info.Size()),
+		slog.String("rule", job.rule),
+		slog.String("sha256", checksum))
+	if f.cfg.OnFileAdded != nil {
+		f.cfg.OnFileAdded(job.name, prepared.info, job.rule)
+	}
+	return nil
+}
+
+// entryName returns the name under which filePath is stored in the archive.
+// It is relative to baseDir and always uses forward slashes, as zip requires.
+// Files outside of baseDir fall back to their base name.
+func entryName(filePath, baseDir string) string {
+	rel, err := filepath.Rel(baseDir, filePath)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return filepath.Base(filePath)
+	}
+	return filepath.ToSlash(rel)
+}
+
+// rootPrefixes returns the names the entries found under each of dirs are
+// nested in: the base name of the directory, extended by as many parent
+// directories as it takes to tell apart roots with the same base name, so
+// that x/data and y/data give "x/data" and "y/data". A directory given more
+// than once is numbered from the second time on.
+func rootPrefixes(dirs []string) []string {
+	parts := make([][]string, len(dirs))
+	depths := make([]int, len(dirs))
+	for i, dir := range dirs {
+		if abs, err := filepath.Abs(dir); err == nil {
+			dir = abs
+		}
+		parts[i] = strings.FieldsFunc(filepath.ToSlash(dir), func(r rune) bool { return r == '/' })
+		depths[i] = 1
+	}
+	prefix := func(i int) string {
+		n := min(depths[i], len(parts[i]))
+		return strings.Join(parts[i][len(parts[i])-n:], "/")
+	}
+
+	for extended := true; extended; {
+		extended = false
+		roots := make(map[string][]int)
+		for i := range dirs {
+			roots[prefix(i)] = append(roots[prefix(i)], i)
+		}
+		for _, same := range roots {
+			// The same directory given twice cannot be told apart
+			distinct := false
+			for _, i := range same[1:] {
+				distinct = distinct || !slices.Equal(parts[i], parts[same[0]])
+			}
+			if !distinct {
+				continue
+			}
+			for _, i := range same {
+				if depths[i] < len(parts[i]) {
+					depths[i]++
+					extended = true
+				}
+			}
+		}
+	}
+
+	prefixes := make([]string, len(dirs))
+	taken := make(map[string]bool)
+	for i := range dirs {
+		name := prefix(i)
+		for n := 2; taken[name]; n++ {
+			name = fmt.Sprintf("%s-%d", prefix(i), n)
+		}
+		taken[name] = true
+		prefixes[i] = name
+	}
+	return prefixes
+}
+
+// printableName returns name for line based output: as it is, or quoted in
+// Go syntax when it holds control characters such as newlines and tabs or
+// is not valid UTF-8. Entry names in the archive are never altered.
+func printableName(name string) string {
+	if utf8.ValidString(name) && strings.IndexFunc(name, unicode.IsControl) < 0 {
+		return name
+	}
+	return strconv.Quote(name)
+}
+
+// flatName returns the base name of filePath as an entry name, numbering it
+// when an earlier file was given the same name.
+func (f *finder) flatName(filePath string) string {
+	if f.flatNames == nil {
+		f.flatNames = make(map[string]struct{})
+	}
+	base := filepath.Base(filePath)
+	name := base
+	ext := filepath.Ext(base)
+	for i := 1; ; i++ {
+		if _, taken := f.flatNames[name]; !taken {
+			break
+		}
+		name = fmt.Sprintf("%s-%d%s", strings.TrimSuffix(base, ext), i, ext)
+	}
+	f.flatNames[name] = struct{}{}
+
+	if name != base {
+		fmt.Fprintf(f.cfg.Output, "Renamed %s to %s to avoid a name collision\n", filePath, name)
+	}
+	return name
+}
+
+// stripEntryPrefix removes prefix from the front of the entry name when the
+// name lies below it. Names that do not start with the whole prefix are
+// returned unchanged.
+func stripEntryPrefix(name, prefix string) string {
+	prefix = strings.Trim(filepath.ToSlash(prefix), "/")
+	if prefix == "" {
+		return name
+	}
+	if rest, ok := strings.CutPrefix(name, prefix+"/"); ok {
+		return rest
+	}
+	return name
+}
+
+// absEntryName turns the cleaned absolute path absPath into an entry name by
+// dropping the leading separator. A volume name such as "C:" or
+// `\\server\share` becomes the leading component, e.g. "C/Users/x.txt".
+func absEntryName(absPath string) string {
+	volume := filepath.VolumeName(absPath)
+	name := strings.TrimLeft(filepath.ToSlash(absPath[len(volume):]), "/")
+	volume = strings.Trim(strings.TrimSuffix(filepath.ToSlash(volume), ":"), "/")
+	if volume != "" {
+		return volume + "/" + name
+	}
+	return name
+}
+
+func (f *finder) closeResources() error {
+	if f.archiver == nil {
+		return nil
+	}
+
+	// Close the archive writer and the underlying file. The archiver is
+	// dropped so that closing again is a no-op.
+	archiver := f.archiver
+	f.archiver = nil
+	if err := archiver.Close(); err != nil {
+		f.discardTemp()
+		return fmt.Errorf("error closing archive: %w", err)
+	}
+	f.result.BytesCompressed += f.output.written
+
+	// Move the complete archive into place
+	if f.tempPath != "" {
+		if err := os.Rename(f.tempPath, f.outputAbsPath); err != nil {
+			f.discardTemp()
+			return fmt.Errorf("error replacing archive: %w", err)
+		}
+		f.tempPath = ""
+	}
+	return nil
+}
+
+// summary describes the archive written by a run, e.g.
+// "Archived 132 files, 45.2 MiB -> 12.1 MiB (73% saved)".
+func summary(result Result) string {
+	line := fmt.Sprintf("Archived %d files, %s -> %s", result.FilesAdded,
+		formatBytes(result.BytesUncompressed), formatBytes(result.BytesCompressed))
+	if result.BytesCompressed < result.BytesUncompressed {
+		saved := 100 - result.BytesCompressed*100/result.BytesUncompressed
+		line += fmt.Sprintf(" (%d%% saved)", saved)
+	}
+	return line
+}
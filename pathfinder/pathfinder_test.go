@@ -0,0 +1,1497 @@
+package pathfinder
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"maps"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+// writeFile creates the file at path with content, along with its parent
+// directories.
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// readZip returns the content of every entry of the zip archive at path by
+// name.
+func readZip(t *testing.T, path string) map[string]string {
+	t.Helper()
+	reader, err := zip.OpenReader(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+
+	entries := make(map[string]string)
+	for _, file := range reader.File {
+		r, err := file.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		content, err := io.ReadAll(r)
+		r.Close()
+		if err != nil {
+			t.Fatalf("reading %s: %v", file.Name, err)
+		}
+		entries[file.Name] = string(content)
+	}
+	return entries
+}
+
+// archiveNames runs cfg and returns the sorted entry names of the archive.
+func archiveNames(t *testing.T, cfg Config) []string {
+	t.Helper()
+	result, err := Run(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for name := range readZip(t, result.OutputPath) {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+// openFiles returns the number of file descriptors the process holds, or
+// skips the test where /proc does not list them.
+func openFiles(t *testing.T) int {
+	t.Helper()
+	fds, err := os.ReadDir("/proc/self/fd")
+	if err != nil {
+		t.Skip("open file descriptors cannot be listed:", err)
+	}
+	return len(fds)
+}
+
+func TestRunWritesCompleteArchive(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "src", "a.txt"), "alpha")
+	writeFile(t, filepath.Join(dir, "src", "sub", "b.txt"), "bravo")
+	writeFile(t, filepath.Join(dir, "list.txt"), "[files]\n*.txt\n")
+
+	cfg := DefaultConfig()
+	cfg.Directories = []string{filepath.Join(dir, "src")}
+	cfg.ListFile = filepath.Join(dir, "list.txt")
+	cfg.OutputPath = dir
+	cfg.OutputName = "out.zip"
+	cfg.Workers = 1
+	cfg.Output = io.Discard
+
+	before := openFiles(t)
+	result, err := Run(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if after := openFiles(t); after != before {
+		t.Errorf("%d file descriptors open after the run, want %d", after, before)
+	}
+
+	info, err := os.Stat(result.OutputPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Size() != result.BytesCompressed {
+		t.Errorf("archive is %d bytes on disk, result reports %d", info.Size(), result.BytesCompressed)
+	}
+	entries := readZip(t, result.OutputPath)
+	want := map[string]string{"a.txt": "alpha", "sub/b.txt": "bravo"}
+	if len(entries) != len(want) {
+		t.Errorf("archive holds %v, want %v", entries, want)
+	}
+	for name, content := range want {
+		if entries[name] != content {
+			t.Errorf("entry %s = %q, want %q", name, entries[name], content)
+		}
+	}
+}
+
+func TestConcurrentRunsDoNotShareState(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "one", "a.txt"), "alpha")
+	writeFile(t, filepath.Join(dir, "one", "b.log"), "bravo")
+	writeFile(t, filepath.Join(dir, "two", "c.txt"), "charlie")
+	writeFile(t, filepath.Join(dir, "two", "d.log"), "delta")
+	writeFile(t, filepath.Join(dir, "one.txt"), "[files]\n*.txt\n")
+	writeFile(t, filepath.Join(dir, "two.txt"), "[files]\n*.log\n")
+
+	configs := make([]Config, 2)
+	outputs := make([]bytes.Buffer, 2)
+	for i, name := range []string{"one", "two"} {
+		cfg := DefaultConfig()
+		cfg.Directories = []string{filepath.Join(dir, name)}
+		cfg.ListFile = filepath.Join(dir, name+".txt")
+		cfg.OutputPath = dir
+		cfg.OutputName = name + ".zip"
+		cfg.Force = true
+		cfg.Workers = 2
+		cfg.Verbose = true
+		cfg.Output = &outputs[i]
+		configs[i] = cfg
+	}
+
+	for round := 0; round < 20; round++ {
+		results := make([]Result, 2)
+		errs := make([]error, 2)
+		var wg sync.WaitGroup
+		for i := range configs {
+			outputs[i].Reset()
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				results[i], errs[i] = Run(configs[i])
+			}(i)
+		}
+		wg.Wait()
+
+		for i, want := range []map[string]string{{"a.txt": "alpha"}, {"d.log": "delta"}} {
+			if errs[i] != nil {
+				t.Fatal(errs[i])
+			}
+			if results[i].FilesAdded != 1 {
+				t.Errorf("run %d added %d files, want 1", i, results[i].FilesAdded)
+			}
+			entries := readZip(t, results[i].OutputPath)
+			if len(entries) != len(want) {
+				t.Errorf("run %d archived %v, want %v", i, entries, want)
+			}
+			for name, content := range want {
+				if entries[name] != content {
+					t.Errorf("run %d: entry %s = %q, want %q", i, name, entries[name], content)
+				}
+			}
+		}
+		if strings.Contains(outputs[0].String(), "d.log") || strings.Contains(outputs[1].String(), "a.txt") {
+			t.Errorf("output of one run mentions the files of the other:\n%s\n%s", &outputs[0], &outputs[1])
+		}
+	}
+}
+
+// captureStdout runs fn with os.Stdout redirected to a file and returns
+// what was written to it.
+func captureStdout(t *testing.T, fn func()) []byte {
+	t.Helper()
+	file, err := os.Create(filepath.Join(t.TempDir(), "stdout"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	stdout := os.Stdout
+	os.Stdout = file
+	defer func() { os.Stdout = stdout }()
+	fn()
+
+	data, err := os.ReadFile(file.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestArchiveToStdout(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "src", "a.txt"), "alpha")
+	writeFile(t, filepath.Join(dir, "src", "b.txt"), "bravo")
+	writeFile(t, filepath.Join(dir, "list.txt"), "[files]\n*.txt\n")
+
+	cfg := DefaultConfig()
+	cfg.Directories = []string{filepath.Join(dir, "src")}
+	cfg.ListFile = filepath.Join(dir, "list.txt")
+	cfg.OutputName = "-"
+	cfg.Workers = 1
+	cfg.Verbose = true
+
+	var runErr error
+	data := captureStdout(t, func() {
+		_, runErr = Run(cfg)
+	})
+	if runErr != nil {
+		t.Fatal(runErr)
+	}
+
+	// Verbose output must not end up in the archive
+	reader, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatalf("stdout is not a zip archive: %v", err)
+	}
+	want := map[string]string{"a.txt": "alpha", "b.txt": "bravo"}
+	if len(reader.File) != len(want) {
+		t.Errorf("archive holds %d entries, want %d", len(reader.File), len(want))
+	}
+	for _, file := range reader.File {
+		r, err := file.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		content, err := io.ReadAll(r)
+		r.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(content) != want[file.Name] {
+			t.Errorf("entry %s = %q, want %q", file.Name, content, want[file.Name])
+		}
+	}
+
+	// Without an archive to write, the dry-run listing goes to stdout
+	cfg.DryRun = true
+	data = captureStdout(t, func() {
+		_, runErr = Run(cfg)
+	})
+	if runErr != nil {
+		t.Fatal(runErr)
+	}
+	if !strings.Contains(string(data), "name\t"+filepath.Join(dir, "src", "a.txt")) {
+		t.Errorf("dry run printed %q, want the matched files", data)
+	}
+}
+
+func TestSummaryMatchesArchive(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "src", "a.txt"), strings.Repeat("alpha ", 1000))
+	writeFile(t, filepath.Join(dir, "src", "b.txt"), "bravo")
+	writeFile(t, filepath.Join(dir, "src", "sub", "c.txt"), "charlie")
+	writeFile(t, filepath.Join(dir, "src", "d.log"), "delta")
+	writeFile(t, filepath.Join(dir, "list.txt"), "[files]\n*.txt\n")
+
+	var output bytes.Buffer
+	cfg := DefaultConfig()
+	cfg.Directories = []string{filepath.Join(dir, "src")}
+	cfg.ListFile = filepath.Join(dir, "list.txt")
+	cfg.OutputPath = dir
+	cfg.OutputName = "out.zip"
+	cfg.Output = &output
+
+	result, err := Run(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries := readZip(t, result.OutputPath)
+	if result.FilesAdded != len(entries) {
+		t.Errorf("reported %d files, archive holds %d", result.FilesAdded, len(entries))
+	}
+	var size int64
+	for _, content := range entries {
+		size += int64(len(content))
+	}
+	if result.BytesUncompressed != size {
+		t.Errorf("reported %d bytes, archive entries hold %d", result.BytesUncompressed, size)
+	}
+	info, err := os.Stat(result.OutputPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.BytesCompressed != info.Size() {
+		t.Errorf("reported an archive of %d bytes, it is %d", result.BytesCompressed, info.Size())
+	}
+	if want := summary(result); !strings.Contains(output.String(), want) || !strings.Contains(want, "Archived 3 files") || !strings.Contains(want, "saved") {
+		t.Errorf("output %q, want the summary %q of 3 files with savings", output.String(), want)
+	}
+
+	// An archive larger than its content claims no savings
+	if line := summary(Result{FilesAdded: 1, BytesUncompressed: 5, BytesCompressed: 120}); strings.Contains(line, "saved") {
+		t.Errorf("summary %q reports savings for a larger archive", line)
+	}
+}
+
+func TestNestedDirectoriesAreWalkedOnce(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "src")
+	files := []string{
+		filepath.Join(src, "a", "x.txt"),
+		filepath.Join(src, "a", "b", "y.txt"),
+		filepath.Join(src, "a", "b", "c", "z.txt"),
+		filepath.Join(src, "d", "w.txt"),
+	}
+	for _, file := range files {
+		writeFile(t, file, filepath.Base(file))
+	}
+	list := "[files]\n*.txt\n[directories]\n" +
+		filepath.Join(src, "a") + "\n" +
+		filepath.Join(src, "a", "b") + "\n" +
+		filepath.Join(src, "a", "b", "c") + "\n"
+	writeFile(t, filepath.Join(dir, "list.txt"), list)
+
+	var output bytes.Buffer
+	added := make(map[string]int)
+	cfg := DefaultConfig()
+	cfg.Directories = []string{src}
+	cfg.ListFile = filepath.Join(dir, "list.txt")
+	cfg.OutputPath = dir
+	cfg.OutputName = "out.zip"
+	cfg.Workers = 1
+	cfg.Verbose = true
+	cfg.Output = &output
+	cfg.OnFileAdded = func(name string, info os.FileInfo, rule string) {
+		added[name]++
+	}
+
+	result, err := Run(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.FilesAdded != len(files) {
+		t.Errorf("added %d files, want %d", result.FilesAdded, len(files))
+	}
+
+	// The nested entries are covered by the walk of "a", and the outer walk
+	// does not descend into it again
+	if n := strings.Count(output.String(), "Found under directory: "); n != 1 {
+		t.Errorf("%d directory walks, want 1:\n%s", n, &output)
+	}
+	for _, file := range files {
+		if n := strings.Count(output.String(), "Found by name: "+file+"\n"); n != 1 {
+			t.Errorf("%s was evaluated %d times, want once", file, n)
+		}
+	}
+	for name, n := range added {
+		if n != 1 {
+			t.Errorf("%s was added %d times", name, n)
+		}
+	}
+	if len(added) != len(files) {
+		t.Errorf("added %v, want the %d files", added, len(files))
+	}
+}
+
+func TestCancelledRunLeavesNoFiles(t *testing.T) {
+	for _, workers := range []int{1, 4} {
+		t.Run(fmt.Sprint("workers=", workers), func(t *testing.T) {
+			dir := t.TempDir()
+			for i := 0; i < 100; i++ {
+				writeFile(t, filepath.Join(dir, "src", fmt.Sprintf("d%d", i%10), fmt.Sprintf("f%02d.txt", i)), "content")
+			}
+			writeFile(t, filepath.Join(dir, "list.txt"), "[files]\n*.txt\n")
+			out := filepath.Join(dir, "out")
+			if err := os.Mkdir(out, 0o755); err != nil {
+				t.Fatal(err)
+			}
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			cfg := DefaultConfig()
+			cfg.Directories = []string{filepath.Join(dir, "src")}
+			cfg.ListFile = filepath.Join(dir, "list.txt")
+			cfg.OutputPath = out
+			cfg.OutputName = "out.zip"
+			cfg.Workers = workers
+			cfg.Output = io.Discard
+			cfg.OnFileAdded = func(string, os.FileInfo, string) { cancel() }
+
+			if _, err := RunContext(ctx, cfg); !errors.Is(err, context.Canceled) {
+				t.Fatalf("cancelled run returned %v, want %v", err, context.Canceled)
+			}
+			entries, err := os.ReadDir(out)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, entry := range entries {
+				t.Errorf("cancelled run left %s behind", entry.Name())
+			}
+		})
+	}
+}
+
+func TestMultipleRoots(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "x", "data", "a.txt"), "x alpha")
+	writeFile(t, filepath.Join(dir, "y", "data", "a.txt"), "y alpha")
+	writeFile(t, filepath.Join(dir, "other", "sub", "b.txt"), "bravo")
+	writeFile(t, filepath.Join(dir, "list.txt"), "[files]\n*.txt\n")
+
+	cfg := DefaultConfig()
+	cfg.Directories = []string{
+		filepath.Join(dir, "x", "data"),
+		filepath.Join(dir, "y", "data"),
+		filepath.Join(dir, "other"),
+	}
+	cfg.ListFile = filepath.Join(dir, "list.txt")
+	cfg.OutputPath = dir
+	cfg.OutputName = "out.zip"
+	cfg.Output = io.Discard
+
+	result, err := Run(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries := readZip(t, result.OutputPath)
+	want := map[string]string{"x/data/a.txt": "x alpha", "y/data/a.txt": "y alpha", "other/sub/b.txt": "bravo"}
+	if len(entries) != len(want) {
+		t.Errorf("archive holds %v, want %v", entries, want)
+	}
+	for name, content := range want {
+		if entries[name] != content {
+			t.Errorf("entry %s = %q, want %q", name, entries[name], content)
+		}
+	}
+}
+
+func TestRootPrefixes(t *testing.T) {
+	tests := []struct {
+		dirs, want []string
+	}{
+		{[]string{"/srv/app", "/var/data"}, []string{"app", "data"}},
+		{[]string{"/x/data", "/y/data", "/z/logs"}, []string{"x/data", "y/data", "logs"}},
+		{[]string{"/a/x/data", "/b/x/data"}, []string{"a/x/data", "b/x/data"}},
+		{[]string{"/data", "/x/data"}, []string{"data", "x/data"}},
+		{[]string{"/srv/app", "/srv/app/"}, []string{"app", "app-2"}},
+	}
+	for _, test := range tests {
+		dirs := make([]string, len(test.dirs))
+		for i, dir := range test.dirs {
+			dirs[i] = filepath.FromSlash(dir)
+		}
+		if got := rootPrefixes(dirs); !slices.Equal(got, test.want) {
+			t.Errorf("rootPrefixes(%q) = %q, want %q", test.dirs, got, test.want)
+		}
+	}
+}
+
+func TestMatchedDirectoryIsSearchedOnce(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "src")
+	writeFile(t, filepath.Join(src, "m", "a.txt"), "alpha")
+	writeFile(t, filepath.Join(src, "m", "deep", "b.txt"), "bravo")
+	writeFile(t, filepath.Join(src, "c.txt"), "charlie")
+	writeFile(t, filepath.Join(dir, "list.txt"), "[files]\n*.txt\n[paths]\n"+
+		filepath.Join(src, "m", "a.txt")+"\n[directories]\n"+filepath.Join(src, "m")+"\n")
+
+	var output bytes.Buffer
+	cfg := DefaultConfig()
+	cfg.Directories = []string{src}
+	cfg.ListFile = filepath.Join(dir, "list.txt")
+	cfg.Verbose = true
+	cfg.Output = &output
+
+	matched := make(map[string][]string)
+	results, errs := Matches(context.Background(), cfg)
+	for file := range results {
+		matched[file.Path] = append(matched[file.Path], file.Rule)
+	}
+	if err := <-errs; err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]string{
+		filepath.Join(src, "m", "a.txt"):         "directory",
+		filepath.Join(src, "m", "deep", "b.txt"): "directory",
+		filepath.Join(src, "c.txt"):              "name",
+	}
+	for path, rule := range want {
+		if rules := matched[path]; len(rules) != 1 || rules[0] != rule {
+			t.Errorf("%s matched by %v, want once by %s", path, rules, rule)
+		}
+	}
+	if len(matched) != len(want) {
+		t.Errorf("matched %v, want %v", matched, want)
+	}
+
+	// The search walk leaves the matched directory to its own walk, so each
+	// section looks at the files below it once
+	for _, line := range []string{
+		"Found by name: " + filepath.Join(src, "m", "a.txt"),
+		"Found by path: " + filepath.Join(src, "m", "a.txt"),
+		"Found by name: " + filepath.Join(src, "m", "deep", "b.txt"),
+	} {
+		if n := strings.Count(output.String(), line+"\n"); n != 1 {
+			t.Errorf("%q printed %d times, want once:\n%s", line, n, &output)
+		}
+	}
+}
+
+func TestSameNamesInSubfoldersAreKept(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "src", "one", "config.txt"), "first")
+	writeFile(t, filepath.Join(dir, "src", "two", "config.txt"), "second")
+	writeFile(t, filepath.Join(dir, "list.txt"), "[files]\nconfig.txt\n")
+
+	cfg := DefaultConfig()
+	cfg.Directories = []string{filepath.Join(dir, "src")}
+	cfg.ListFile = filepath.Join(dir, "list.txt")
+	cfg.OutputPath = dir
+	cfg.OutputName = "out.zip"
+	cfg.Output = io.Discard
+
+	result, err := Run(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries := readZip(t, result.OutputPath)
+	want := map[string]string{"one/config.txt": "first", "two/config.txt": "second"}
+	if len(entries) != len(want) {
+		t.Errorf("archive holds %v, want %v", entries, want)
+	}
+	for name, content := range want {
+		if entries[name] != content {
+			t.Errorf("entry %s = %q, want %q", name, entries[name], content)
+		}
+	}
+}
+
+func TestFileMatchedBySeveralSectionsIsAddedOnce(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "src")
+	writeFile(t, filepath.Join(src, "data", "report.txt"), "report")
+	writeFile(t, filepath.Join(dir, "list.txt"), "[files]\nreport.txt\n[paths]\n"+
+		filepath.Join(src, "data", "report.txt")+"\n[directories]\n"+filepath.Join(src, "data")+"\n")
+
+	var added []string
+	cfg := DefaultConfig()
+	cfg.Directories = []string{src}
+	cfg.ListFile = filepath.Join(dir, "list.txt")
+	cfg.OutputPath = dir
+	cfg.OutputName = "out.zip"
+	cfg.Workers = 1
+	cfg.Output = io.Discard
+	cfg.OnFileAdded = func(name string, info os.FileInfo, rule string) {
+		added = append(added, name)
+	}
+
+	result, err := Run(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.FilesAdded != 1 || len(added) != 1 {
+		t.Errorf("added %d files (%v), want 1", result.FilesAdded, added)
+	}
+	if entries := readZip(t, result.OutputPath); len(entries) != 1 || entries["data/report.txt"] != "report" {
+		t.Errorf("archive holds %v, want data/report.txt once", entries)
+	}
+	if len(result.Unmatched) > 0 {
+		t.Errorf("unmatched entries %v, every section matched the file", result.Unmatched)
+	}
+}
+
+// failingFS is a file system whose directory at fail cannot be opened.
+type failingFS struct {
+	fs.FS
+	fail string
+}
+
+func (fsys failingFS) Open(name string) (fs.File, error) {
+	if name == fsys.fail {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrPermission}
+	}
+	return fsys.FS.Open(name)
+}
+
+func TestWalkErrorsStopTheRun(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "list.txt"), "[files]\n*.txt\n")
+	out := filepath.Join(dir, "out")
+	if err := os.Mkdir(out, 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := DefaultConfig()
+	cfg.Directories = []string{"."}
+	cfg.ListFile = filepath.Join(dir, "list.txt")
+	cfg.OutputPath = out
+	cfg.OutputName = "out.zip"
+	cfg.Output = io.Discard
+	cfg.FS = failingFS{
+		FS: fstest.MapFS{
+			"a.txt":        {Data: []byte("alpha")},
+			"locked/b.txt": {Data: []byte("bravo")},
+		},
+		fail: "locked",
+	}
+	_, err := Run(cfg)
+	if !errors.Is(err, fs.ErrPermission) || !strings.Contains(err.Error(), "error searching") {
+		t.Errorf("searching an unreadable directory returned %v, want a search error wrapping %v", err, fs.ErrPermission)
+	}
+	if entries, err := os.ReadDir(out); err != nil || len(entries) > 0 {
+		t.Errorf("failed run left %v behind (%v)", entries, err)
+	}
+
+	// searchFiles itself hands the error up rather than reporting it
+	f := &finder{ctx: context.Background(), cfg: cfg, fsys: cfg.FS, directory: "."}
+	if err := f.searchFiles("."); !errors.Is(err, fs.ErrPermission) {
+		t.Errorf("searchFiles returned %v, want %v", err, fs.ErrPermission)
+	}
+}
+
+func TestDryRunListsMatchesWithoutArchive(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "src")
+	writeFile(t, filepath.Join(src, "a.txt"), "alpha")
+	writeFile(t, filepath.Join(src, "logs", "b.log"), "bravo")
+	writeFile(t, filepath.Join(src, "c.csv"), "charlie")
+	writeFile(t, filepath.Join(dir, "list.txt"), "[files]\na.txt\n[directories]\n"+filepath.Join(src, "logs")+"\n")
+	out := filepath.Join(dir, "out")
+	if err := os.Mkdir(out, 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	var output bytes.Buffer
+	cfg := DefaultConfig()
+	cfg.Directories = []string{src}
+	cfg.ListFile = filepath.Join(dir, "list.txt")
+	cfg.OutputPath = out
+	cfg.DryRun = true
+	cfg.NoSummary = true
+	cfg.Output = &output
+
+	result, err := Run(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "name\t" + filepath.Join(src, "a.txt") + "\n" +
+		"directory\t" + filepath.Join(src, "logs", "b.log") + "\n"
+	if output.String() != want {
+		t.Errorf("dry run printed\n%s\nwant\n%s", &output, want)
+	}
+	if result.FilesAdded != 2 || result.OutputPath != "" {
+		t.Errorf("dry run reported %d files and archive %q, want 2 files and no archive", result.FilesAdded, result.OutputPath)
+	}
+	if entries, err := os.ReadDir(out); err != nil || len(entries) > 0 {
+		t.Errorf("dry run wrote %v (%v)", entries, err)
+	}
+}
+
+func TestExistingArchiveNeedsForce(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "src", "a.txt"), "alpha")
+	writeFile(t, filepath.Join(dir, "list.txt"), "[files]\na.txt\n")
+	output := filepath.Join(dir, "out.zip")
+	writeFile(t, output, "not an archive")
+
+	cfg := DefaultConfig()
+	cfg.Directories = []string{filepath.Join(dir, "src")}
+	cfg.ListFile = filepath.Join(dir, "list.txt")
+	cfg.OutputPath = dir
+	cfg.OutputName = "out.zip"
+	cfg.Output = io.Discard
+
+	if _, err := Run(cfg); err == nil || !strings.Contains(err.Error(), "already exists") {
+		t.Fatalf("Run without Force = %v, want an already exists error", err)
+	}
+	if content, err := os.ReadFile(output); err != nil || string(content) != "not an archive" {
+		t.Fatalf("the existing file was changed: %q, %v", content, err)
+	}
+
+	cfg.Force = true
+	if _, err := Run(cfg); err != nil {
+		t.Fatal(err)
+	}
+	if files := readZip(t, output); files["a.txt"] != "alpha" || len(files) != 1 {
+		t.Errorf("overwritten archive holds %v, want a.txt only", files)
+	}
+}
+
+func TestMissingOutputDirectory(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "src", "a.txt"), "alpha")
+	writeFile(t, filepath.Join(dir, "list.txt"), "[files]\na.txt\n")
+	outputDir := filepath.Join(dir, "out", "nested")
+
+	cfg := DefaultConfig()
+	cfg.Directories = []string{filepath.Join(dir, "src")}
+	cfg.ListFile = filepath.Join(dir, "list.txt")
+	cfg.OutputPath = outputDir
+	cfg.OutputName = "out.zip"
+	cfg.Output = io.Discard
+
+	if _, err := Run(cfg); err == nil || !strings.Contains(err.Error(), "does not exist") {
+		t.Fatalf("Run without CreateOutputDir = %v, want a does not exist error", err)
+	}
+	if _, err := os.Stat(outputDir); !os.IsNotExist(err) {
+		t.Fatalf("the output directory was created anyway: %v", err)
+	}
+
+	cfg.CreateOutputDir = true
+	result, err := Run(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := filepath.Join(outputDir, "out.zip"); result.OutputPath != want {
+		t.Errorf("archive written to %s, want %s", result.OutputPath, want)
+	}
+	if files := readZip(t, result.OutputPath); files["a.txt"] != "alpha" {
+		t.Errorf("archive holds %v, want a.txt", files)
+	}
+}
+
+func TestQuietLeavesOnlyWarnings(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "src", "a.txt"), "alpha")
+	writeFile(t, filepath.Join(dir, "list.txt"), "[files]\na.txt\n[fils]\nb.txt\n")
+
+	for _, quiet := range []bool{false, true} {
+		var output, errOutput bytes.Buffer
+		cfg := DefaultConfig()
+		cfg.Directories = []string{filepath.Join(dir, "src")}
+		cfg.ListFile = filepath.Join(dir, "list.txt")
+		cfg.OutputPath = dir
+		cfg.OutputName = fmt.Sprintf("quiet-%v.zip", quiet)
+		cfg.Verbose = true
+		cfg.Progress = true
+		cfg.Quiet = quiet
+		cfg.Output = &output
+		cfg.ErrOutput = &errOutput
+
+		result, err := Run(cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result.FilesAdded != 1 {
+			t.Errorf("quiet %v added %d files, want 1", quiet, result.FilesAdded)
+		}
+		if quiet && output.Len() != 0 {
+			t.Errorf("quiet run wrote %q", output.String())
+		}
+		if !quiet && output.Len() == 0 {
+			t.Error("verbose run wrote nothing")
+		}
+		if got := strings.Contains(errOutput.String(), "Progress:"); got == quiet {
+			t.Errorf("quiet %v: progress reported %v", quiet, got)
+		}
+		if !strings.Contains(errOutput.String(), "unknown section [fils]") {
+			t.Errorf("quiet %v: warning missing from %q", quiet, errOutput.String())
+		}
+	}
+}
+
+func TestUnreadableFileIsSkipped(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "list.txt"), "[files]\n*.txt\n")
+
+	for _, ignoreErrors := range []bool{false, true} {
+		var errOutput bytes.Buffer
+		cfg := DefaultConfig()
+		cfg.Directories = []string{"."}
+		cfg.ListFile = filepath.Join(dir, "list.txt")
+		cfg.OutputPath = dir
+		cfg.OutputName = fmt.Sprintf("ignore-%v.zip", ignoreErrors)
+		cfg.IgnoreErrors = ignoreErrors
+		cfg.Output = io.Discard
+		cfg.ErrOutput = &errOutput
+		cfg.FS = failingFS{
+			FS: fstest.MapFS{
+				"a.txt":      {Data: []byte("alpha")},
+				"locked.txt": {Data: []byte("locked")},
+				"sub/c.txt":  {Data: []byte("charlie")},
+			},
+			fail: "locked.txt",
+		}
+
+		result, err := Run(cfg)
+		if ignoreErrors && err != nil {
+			t.Errorf("with IgnoreErrors Run returned %v", err)
+		}
+		if !ignoreErrors && !errors.Is(err, ErrSkipped) {
+			t.Errorf("Run returned %v, want %v", err, ErrSkipped)
+		}
+		if len(result.Skipped) != 1 || filepath.Base(result.Skipped[0].Path) != "locked.txt" || !errors.Is(result.Skipped[0].Err, fs.ErrPermission) {
+			t.Errorf("skipped %v, want locked.txt with a permission error", result.Skipped)
+		}
+		if !strings.Contains(errOutput.String(), "Error adding file to archive") || !strings.Contains(errOutput.String(), "locked.txt") {
+			t.Errorf("the failure was not reported: %q", errOutput.String())
+		}
+		if result.FilesAdded != 2 {
+			t.Errorf("added %d files, want 2", result.FilesAdded)
+		}
+		if files := readZip(t, result.OutputPath); len(files) != 2 || files["a.txt"] != "alpha" || files["sub/c.txt"] != "charlie" {
+			t.Errorf("archive holds %v, want a.txt and sub/c.txt", files)
+		}
+	}
+}
+
+func TestContinueOnWalkError(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "list.txt"), "[files]\n*.txt\n")
+
+	var errOutput bytes.Buffer
+	cfg := DefaultConfig()
+	cfg.Directories = []string{"."}
+	cfg.ListFile = filepath.Join(dir, "list.txt")
+	cfg.OutputPath = dir
+	cfg.OutputName = "out.zip"
+	cfg.ContinueOnWalkError = true
+	cfg.Output = io.Discard
+	cfg.ErrOutput = &errOutput
+	cfg.FS = failingFS{
+		FS: fstest.MapFS{
+			"a.txt":           {Data: []byte("alpha")},
+			"locked/b.txt":    {Data: []byte("bravo")},
+			"open/c.txt":      {Data: []byte("charlie")},
+			"open/deep/d.txt": {Data: []byte("delta")},
+		},
+		fail: "locked",
+	}
+
+	result, err := Run(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.WalkErrors) != 1 || filepath.Base(result.WalkErrors[0].Path) != "locked" || !errors.Is(result.WalkErrors[0].Err, fs.ErrPermission) {
+		t.Errorf("walk errors %v, want one for locked", result.WalkErrors)
+	}
+	if !strings.Contains(errOutput.String(), "Error searching path") {
+		t.Errorf("the walk error was not logged: %q", errOutput.String())
+	}
+	files := readZip(t, result.OutputPath)
+	if len(files) != 3 || files["a.txt"] != "alpha" || files["open/c.txt"] != "charlie" || files["open/deep/d.txt"] != "delta" {
+		t.Errorf("archive holds %v, want every file outside locked", files)
+	}
+}
+
+func TestFailedRunLeavesOutputUntouched(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "list.txt"), "[files]\n*.txt\n")
+	out := filepath.Join(dir, "out")
+	writeFile(t, filepath.Join(out, "out.zip"), "previous archive")
+
+	cfg := DefaultConfig()
+	cfg.Directories = []string{"first", "second"}
+	cfg.ListFile = filepath.Join(dir, "list.txt")
+	cfg.OutputPath = out
+	cfg.OutputName = "out.zip"
+	cfg.Force = true
+	cfg.Workers = 1
+	cfg.Output = io.Discard
+	// The files of the first root are written before the walk of the
+	// second one fails
+	cfg.FS = failingFS{
+		FS: fstest.MapFS{
+			"first/a.txt":    {Data: []byte("alpha")},
+			"second/z/b.txt": {Data: []byte("bravo")},
+		},
+		fail: "second/z",
+	}
+
+	if _, err := Run(cfg); err == nil {
+		t.Fatal("Run succeeded despite the walk error")
+	}
+	if content, err := os.ReadFile(filepath.Join(out, "out.zip")); err != nil || string(content) != "previous archive" {
+		t.Errorf("the existing archive was changed: %q, %v", content, err)
+	}
+	entries, err := os.ReadDir(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("failed run left %v behind, want out.zip only", entries)
+	}
+}
+
+func TestEntriesAreSorted(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "src")
+	for _, name := range []string{"zeta.txt", "b/y.txt", "a.txt", "b/a.txt", "B.txt", "a-b/c.txt"} {
+		writeFile(t, filepath.Join(src, filepath.FromSlash(name)), name)
+	}
+	writeFile(t, filepath.Join(dir, "list.txt"), "[files]\n*.txt\n")
+
+	for _, workers := range []int{1, 4} {
+		cfg := DefaultConfig()
+		cfg.Directories = []string{src}
+		cfg.ListFile = filepath.Join(dir, "list.txt")
+		cfg.OutputPath = dir
+		cfg.OutputName = fmt.Sprintf("sorted%d.zip", workers)
+		cfg.Workers = workers
+		cfg.Output = io.Discard
+
+		result, err := Run(cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		reader, err := zip.OpenReader(result.OutputPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var names []string
+		for _, file := range reader.File {
+			names = append(names, file.Name)
+		}
+		reader.Close()
+		if want := []string{"B.txt", "a-b/c.txt", "a.txt", "b/a.txt", "b/y.txt", "zeta.txt"}; !slices.Equal(names, want) {
+			t.Errorf("%d workers wrote %v, want %v", workers, names, want)
+		}
+	}
+}
+
+func TestEmptyDirectories(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "src")
+	writeFile(t, filepath.Join(src, "data", "a.txt"), "alpha")
+	for _, empty := range []string{filepath.Join(src, "data", "empty", "nested"), filepath.Join(src, "outside")} {
+		if err := os.MkdirAll(empty, 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writeFile(t, filepath.Join(dir, "list.txt"), "[directories]\n"+filepath.Join(src, "data")+"\n")
+
+	tests := []struct {
+		include bool
+		want    []string
+	}{
+		{false, []string{"data/a.txt"}},
+		// Only directories with no entries at all are stored
+		{true, []string{"data/a.txt", "data/empty/nested/"}},
+	}
+	for _, test := range tests {
+		cfg := DefaultConfig()
+		cfg.Directories = []string{src}
+		cfg.ListFile = filepath.Join(dir, "list.txt")
+		cfg.OutputPath = dir
+		cfg.OutputName = fmt.Sprintf("empty-%v.zip", test.include)
+		cfg.IncludeEmptyDirs = test.include
+		cfg.Output = io.Discard
+
+		result, err := Run(cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var names []string
+		for name := range readZip(t, result.OutputPath) {
+			names = append(names, name)
+		}
+		slices.Sort(names)
+		if !slices.Equal(names, test.want) {
+			t.Errorf("include empty directories %v: archive holds %v, want %v", test.include, names, test.want)
+		}
+	}
+}
+
+func TestMaxFiles(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "src")
+	for i := 0; i < 5; i++ {
+		writeFile(t, filepath.Join(src, fmt.Sprintf("f%d.txt", i)), "x")
+	}
+	writeFile(t, filepath.Join(dir, "list.txt"), "[files]\n*.txt\n")
+	out := filepath.Join(dir, "out")
+	if err := os.Mkdir(out, 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := DefaultConfig()
+	cfg.Directories = []string{src}
+	cfg.ListFile = filepath.Join(dir, "list.txt")
+	cfg.OutputPath = out
+	cfg.OutputName = "out.zip"
+	cfg.MaxFiles = 3
+	cfg.Output = io.Discard
+
+	_, err := Run(cfg)
+	if !errors.Is(err, ErrLimitExceeded) || !strings.Contains(err.Error(), "more than 3 files") {
+		t.Errorf("Run returned %v, want %v for more than 3 files", err, ErrLimitExceeded)
+	}
+	if entries, err := os.ReadDir(out); err != nil || len(entries) > 0 {
+		t.Errorf("aborted run left %v behind (%v)", entries, err)
+	}
+
+	// Exactly at the limit is fine
+	cfg.MaxFiles = 5
+	if result, err := Run(cfg); err != nil || result.FilesAdded != 5 {
+		t.Errorf("Run at the limit = %d files, %v, want 5 files", result.FilesAdded, err)
+	}
+}
+
+func TestMaxTotalBytes(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "src")
+	writeFile(t, filepath.Join(src, "a.txt"), strings.Repeat("a", 100))
+	writeFile(t, filepath.Join(src, "b.txt"), strings.Repeat("b", 100))
+	writeFile(t, filepath.Join(src, "large.txt"), strings.Repeat("l", 4<<20))
+	writeFile(t, filepath.Join(dir, "list.txt"), "[files]\n*.txt\n")
+	out := filepath.Join(dir, "out")
+	if err := os.Mkdir(out, 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := DefaultConfig()
+	cfg.Directories = []string{src}
+	cfg.ListFile = filepath.Join(dir, "list.txt")
+	cfg.OutputPath = out
+	cfg.OutputName = "out.zip"
+	cfg.MaxTotalBytes = 1024
+	cfg.Output = io.Discard
+
+	result, err := Run(cfg)
+	if !errors.Is(err, ErrLimitExceeded) || !strings.Contains(err.Error(), "exceed 1.0 KiB") {
+		t.Errorf("Run returned %v, want %v for 1.0 KiB", err, ErrLimitExceeded)
+	}
+	// The cap is checked before anything is written
+	if result.BytesUncompressed > cfg.MaxTotalBytes {
+		t.Errorf("%d bytes were archived before the run stopped", result.BytesUncompressed)
+	}
+	if entries, err := os.ReadDir(out); err != nil || len(entries) > 0 {
+		t.Errorf("aborted run left %v behind (%v)", entries, err)
+	}
+
+	cfg.MaxTotalBytes = 5 << 20
+	if result, err := Run(cfg); err != nil || result.FilesAdded != 3 {
+		t.Errorf("Run within the limit = %d files, %v, want 3 files", result.FilesAdded, err)
+	}
+}
+
+func TestResultFields(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "list.txt"), "[files]\n*.txt\nmissing.md\n[paths]\nnowhere/x.txt\n")
+
+	// A dry run does not read the files, so only the real run fails on
+	// an unreadable one
+	tests := []struct {
+		dryRun  bool
+		fail    string
+		added   int
+		bytes   int64
+		skipped []string
+	}{
+		{false, "locked.txt", 2, 12, []string{"locked.txt"}},
+		{true, "", 3, 18, nil},
+	}
+	for _, test := range tests {
+		dryRun := test.dryRun
+		cfg := DefaultConfig()
+		cfg.Directories = []string{"."}
+		cfg.ListFile = filepath.Join(dir, "list.txt")
+		cfg.OutputPath = dir
+		cfg.OutputName = fmt.Sprintf("result-%v.zip", dryRun)
+		cfg.DryRun = dryRun
+		cfg.IgnoreErrors = true
+		cfg.Workers = 1
+		cfg.Output = io.Discard
+		cfg.ErrOutput = io.Discard
+		cfg.FS = failingFS{
+			FS: fstest.MapFS{
+				"a.txt":      {Data: []byte("alpha")},
+				"sub/b.txt":  {Data: []byte("bravo!!")},
+				"locked.txt": {Data: []byte("locked")},
+				"c.log":      {Data: []byte("charlie")},
+			},
+			fail: test.fail,
+		}
+
+		result, err := Run(cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result.FilesAdded != test.added {
+			t.Errorf("dry run %v: FilesAdded = %d, want %d", dryRun, result.FilesAdded, test.added)
+		}
+		if result.BytesUncompressed != test.bytes {
+			t.Errorf("dry run %v: BytesUncompressed = %d, want %d", dryRun, result.BytesUncompressed, test.bytes)
+		}
+		var skipped []string
+		for _, file := range result.Skipped {
+			if !errors.Is(file.Err, fs.ErrPermission) {
+				t.Errorf("dry run %v: %s skipped for %v", dryRun, file.Path, file.Err)
+			}
+			skipped = append(skipped, file.Path)
+		}
+		if !slices.Equal(skipped, test.skipped) {
+			t.Errorf("dry run %v: Skipped = %v, want %v", dryRun, skipped, test.skipped)
+		}
+		if want := []string{"[files] missing.md", "[paths] nowhere/x.txt"}; !slices.Equal(result.Unmatched, want) {
+			t.Errorf("dry run %v: Unmatched = %q, want %q", dryRun, result.Unmatched, want)
+		}
+		if result.Volumes != nil || result.WalkErrors != nil || result.VerifyProblems != nil {
+			t.Errorf("dry run %v: unexpected volumes %v, walk errors %v or problems %v", dryRun, result.Volumes, result.WalkErrors, result.VerifyProblems)
+		}
+
+		if dryRun {
+			if result.OutputPath != "" || result.BytesCompressed != 0 {
+				t.Errorf("dry run: OutputPath = %q, BytesCompressed = %d, want neither", result.OutputPath, result.BytesCompressed)
+			}
+			continue
+		}
+		if want := filepath.Join(dir, cfg.OutputName); result.OutputPath != want {
+			t.Errorf("OutputPath = %q, want %q", result.OutputPath, want)
+		}
+		info, err := os.Stat(result.OutputPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result.BytesCompressed != info.Size() {
+			t.Errorf("BytesCompressed = %d, the archive has %d", result.BytesCompressed, info.Size())
+		}
+	}
+}
+
+func TestCallbacks(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "src")
+	writeFile(t, filepath.Join(src, "a.txt"), "alpha")
+	writeFile(t, filepath.Join(src, "b.txt"), "bravo")
+	writeFile(t, filepath.Join(src, "sub", "c.txt"), "charlie")
+	writeZip(t, filepath.Join(src, "backup.zip"), map[string]string{"a.txt": "old alpha"})
+	writeFile(t, filepath.Join(dir, "list.txt"), "[files]\n*\n")
+
+	var inCall atomic.Bool
+	enter := func() {
+		if !inCall.CompareAndSwap(false, true) {
+			t.Error("callbacks were called concurrently")
+		}
+	}
+	added := make(map[string]string)
+	skipped := make(map[string]string)
+	var failed []string
+
+	cfg := DefaultConfig()
+	cfg.Directories = []string{src}
+	cfg.ListFile = filepath.Join(dir, "list.txt")
+	cfg.OutputPath = src
+	cfg.OutputName = "backup.zip"
+	cfg.Append = true
+	cfg.Workers = 4
+	cfg.Output = io.Discard
+	cfg.ErrOutput = io.Discard
+	cfg.OnFileAdded = func(name string, info os.FileInfo, rule string) {
+		enter()
+		defer inCall.Store(false)
+		if info == nil || info.Size() == 0 {
+			t.Errorf("%s added with info %v", name, info)
+		}
+		added[name] = rule
+	}
+	cfg.OnSkip = func(path, reason string) {
+		enter()
+		defer inCall.Store(false)
+		name := filepath.Base(path)
+		if strings.HasPrefix(name, ".backup.zip.tmp-") {
+			// The archive being written is skipped as well
+			name = ".backup.zip.tmp"
+		}
+		skipped[name] = reason
+	}
+	cfg.OnError = func(path string, err error) {
+		enter()
+		defer inCall.Store(false)
+		failed = append(failed, path)
+	}
+
+	if _, err := Run(cfg); err != nil {
+		t.Fatal(err)
+	}
+	if want := map[string]string{"b.txt": "name", "sub/c.txt": "name"}; !maps.Equal(added, want) {
+		t.Errorf("OnFileAdded saw %v, want %v", added, want)
+	}
+	if want := map[string]string{"a.txt": "already in archive", "backup.zip": "output archive", ".backup.zip.tmp": "output archive"}; !maps.Equal(skipped, want) {
+		t.Errorf("OnSkip saw %v, want %v", skipped, want)
+	}
+	if len(failed) > 0 {
+		t.Errorf("OnError saw %v, want nothing", failed)
+	}
+
+	// A file that cannot be read goes to OnError alone
+	clear(added)
+	clear(skipped)
+	cfg.Directories = []string{"."}
+	cfg.OutputPath = dir
+	cfg.OutputName = "out.zip"
+	cfg.Append = false
+	cfg.IgnoreErrors = true
+	cfg.FS = failingFS{
+		FS: fstest.MapFS{
+			"a.txt":      {Data: []byte("alpha")},
+			"locked.txt": {Data: []byte("locked")},
+		},
+		fail: "locked.txt",
+	}
+	if _, err := Run(cfg); err != nil {
+		t.Fatal(err)
+	}
+	if len(added) != 1 || len(skipped) != 0 || !slices.Equal(failed, []string{"locked.txt"}) {
+		t.Errorf("added %v, skipped %v, failed %v, want a.txt added and locked.txt failed", added, skipped, failed)
+	}
+}
+
+func TestPreserveAbsPaths(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "src")
+	writeFile(t, filepath.Join(src, "a.txt"), "alpha")
+	writeFile(t, filepath.Join(src, "sub", "b.txt"), "bravo")
+	writeFile(t, filepath.Join(dir, "list.txt"), "[files]\n*.txt\n")
+
+	cfg := DefaultConfig()
+	cfg.Directories = []string{src}
+	cfg.ListFile = filepath.Join(dir, "list.txt")
+	cfg.OutputPath = dir
+	cfg.OutputName = "out.zip"
+	cfg.PreserveAbsPaths = true
+	cfg.Output = io.Discard
+
+	abs := absEntryName(src)
+	if strings.HasPrefix(abs, "/") || strings.Contains(abs, "\\") {
+		t.Fatalf("absEntryName(%q) = %q, want a relative slash path", src, abs)
+	}
+	if got, want := archiveNames(t, cfg), []string{abs + "/a.txt", abs + "/sub/b.txt"}; !slices.Equal(got, want) {
+		t.Errorf("archive holds %v, want %v", got, want)
+	}
+}
+
+func TestAbsEntryName(t *testing.T) {
+	tests := map[string]string{
+		"/":              "",
+		"/a.txt":         "a.txt",
+		"/home/u/x.txt":  "home/u/x.txt",
+		"/srv/data/logs": "srv/data/logs",
+	}
+	if filepath.Separator == '\\' {
+		// Volume names become the leading component
+		tests = map[string]string{
+			`C:\`:                    "C/",
+			`C:\Users\x.txt`:         "C/Users/x.txt",
+			`\\server\share\d\y.txt`: "server/share/d/y.txt",
+		}
+	}
+	for path, want := range tests {
+		if got := absEntryName(path); got != want {
+			t.Errorf("absEntryName(%q) = %q, want %q", path, got, want)
+		}
+	}
+}
+
+func TestStripPrefix(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "src")
+	writeFile(t, filepath.Join(src, "build", "dist", "app.js"), "app")
+	writeFile(t, filepath.Join(src, "build", "dist", "css", "s.css"), "style")
+	writeFile(t, filepath.Join(src, "builder", "b.js"), "builder")
+	writeFile(t, filepath.Join(src, "other", "build", "o.js"), "other")
+	writeFile(t, filepath.Join(dir, "list.txt"), "[files]\n*\n")
+
+	tests := []struct {
+		prefix string
+		want   []string
+	}{
+		{"build", []string{"builder/b.js", "dist/app.js", "dist/css/s.css", "other/build/o.js"}},
+		{"/build/dist/", []string{"app.js", "builder/b.js", "css/s.css", "other/build/o.js"}},
+		{"missing", []string{"build/dist/app.js", "build/dist/css/s.css", "builder/b.js", "other/build/o.js"}},
+	}
+	for i, test := range tests {
+		cfg := DefaultConfig()
+		cfg.Directories = []string{src}
+		cfg.ListFile = filepath.Join(dir, "list.txt")
+		cfg.OutputPath = dir
+		cfg.OutputName = fmt.Sprintf("strip%d.zip", i)
+		cfg.StripPrefix = test.prefix
+		cfg.Output = io.Discard
+
+		if got := archiveNames(t, cfg); !slices.Equal(got, test.want) {
+			t.Errorf("strip prefix %q: archive holds %v, want %v", test.prefix, got, test.want)
+		}
+	}
+}
+
+func TestPrefix(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "src")
+	writeFile(t, filepath.Join(src, "a.txt"), "alpha")
+	writeFile(t, filepath.Join(src, "sub", "b.txt"), "bravo")
+	writeFile(t, filepath.Join(dir, "list.txt"), "[files]\n*.txt\n")
+
+	for i, prefix := range []string{"backup/2024", "/backup/2024/", `backup\2024`, "backup//2024"} {
+		cfg := DefaultConfig()
+		cfg.Directories = []string{src}
+		cfg.ListFile = filepath.Join(dir, "list.txt")
+		cfg.OutputPath = dir
+		cfg.OutputName = fmt.Sprintf("prefix%d.zip", i)
+		cfg.Prefix = prefix
+		cfg.Output = io.Discard
+
+		if got, want := archiveNames(t, cfg), []string{"backup/2024/a.txt", "backup/2024/sub/b.txt"}; !slices.Equal(got, want) {
+			t.Errorf("prefix %q: archive holds %v, want %v", prefix, got, want)
+		}
+	}
+}
+
+func TestFlattenRenamesCollisions(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "src")
+	writeFile(t, filepath.Join(src, "a", "x.txt"), "a")
+	writeFile(t, filepath.Join(src, "b", "x.txt"), "b")
+	writeFile(t, filepath.Join(src, "c", "x.txt"), "c")
+	writeFile(t, filepath.Join(src, "x-1.txt"), "root")
+	writeFile(t, filepath.Join(src, "d", "README"), "readme")
+	writeFile(t, filepath.Join(src, "e", "README"), "readme 2")
+	writeFile(t, filepath.Join(dir, "list.txt"), "[files]\n*\n")
+
+	var output bytes.Buffer
+	cfg := DefaultConfig()
+	cfg.Directories = []string{src}
+	cfg.ListFile = filepath.Join(dir, "list.txt")
+	cfg.OutputPath = dir
+	cfg.OutputName = "out.zip"
+	cfg.Flatten = true
+	cfg.Output = &output
+
+	result, err := Run(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Names are handed out in walk order, and a numbered name that a later
+	// file has already is numbered again
+	want := map[string]string{
+		"x.txt":     "a",
+		"x-1.txt":   "b",
+		"x-2.txt":   "c",
+		"x-1-1.txt": "root",
+		"README":    "readme",
+		"README-1":  "readme 2",
+	}
+	if files := readZip(t, result.OutputPath); !maps.Equal(files, want) {
+		t.Errorf("archive holds %v, want %v", files, want)
+	}
+	if !strings.Contains(output.String(), "Renamed "+filepath.Join(src, "b", "x.txt")+" to x-1.txt") {
+		t.Errorf("renaming was not reported: %q", output.String())
+	}
+}
+
+func TestGenerateOutputFilename(t *testing.T) {
+	now := time.Date(2024, time.March, 5, 6, 7, 8, 0, time.UTC)
+	tests := []struct {
+		name, template, layout, format string
+		want                           string
+	}{
+		{"", "", "", "zip", "request-2024-Mar-05-06-07.zip"},
+		{"", "", "20060102-150405", "zip", "request-20240305-060708.zip"},
+		{"", "", "20060102-150405", "tar", "request-20240305-060708.tar"},
+		// A given name and a template both win over the layout
+		{"mine.zip", "", "20060102-150405", "zip", "mine.zip"},
+		{"", "{date}", "20060102-150405", "zip", "2024-03-05.zip"},
+	}
+	for _, test := range tests {
+		if got := generateOutputFilename(test.name, test.template, test.layout, test.format, now, -1); got != test.want {
+			t.Errorf("generateOutputFilename(%q, %q, %q) = %q, want %q", test.name, test.template, test.layout, got, test.want)
+		}
+	}
+}
+
+func TestInvalidTimeFormat(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "src", "a.txt"), "alpha")
+	writeFile(t, filepath.Join(dir, "list.txt"), "[files]\na.txt\n")
+
+	tests := []struct {
+		layout, want string
+	}{
+		{"backup", "no date or time fields"},
+		{"2006/01/02", "path separator"},
+	}
+	for _, test := range tests {
+		cfg := DefaultConfig()
+		cfg.Directories = []string{filepath.Join(dir, "src")}
+		cfg.ListFile = filepath.Join(dir, "list.txt")
+		cfg.OutputPath = dir
+		cfg.TimeFormat = test.layout
+		cfg.Output = io.Discard
+
+		if _, err := Run(cfg); err == nil || !strings.Contains(err.Error(), test.want) {
+			t.Errorf("time format %q: error %v, want %q", test.layout, err, test.want)
+		}
+	}
+	if entries, err := os.ReadDir(dir); err != nil || len(entries) != 2 {
+		t.Errorf("output directory holds %d entries (%v), want only the fixture", len(entries), err)
+	}
+}
+
+func TestRelativeBase(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "project", "src")
+	writeFile(t, filepath.Join(src, "a.txt"), "alpha")
+	writeFile(t, filepath.Join(src, "sub", "b.txt"), "bravo")
+	writeFile(t, filepath.Join(dir, "list.txt"), "[files]\n*.txt\n")
+
+	cfg := DefaultConfig()
+	cfg.Directories = []string{src}
+	cfg.ListFile = filepath.Join(dir, "list.txt")
+	cfg.OutputPath = dir
+	cfg.OutputName = "out.zip"
+	cfg.RelativeBase = filepath.Join(dir, "project")
+	cfg.Output = io.Discard
+
+	if got, want := archiveNames(t, cfg), []string{"src/a.txt", "src/sub/b.txt"}; !slices.Equal(got, want) {
+		t.Errorf("archived %v, want %v", got, want)
+	}
+
+	// a.txt lies outside of a base below the search directory
+	cfg.RelativeBase = filepath.Join(src, "sub")
+	cfg.Force = true
+	cfg.ErrOutput = io.Discard
+	result, err := Run(cfg)
+	if !errors.Is(err, ErrSkipped) {
+		t.Errorf("file outside of the base: error %v, want ErrSkipped", err)
+	}
+	if len(result.Skipped) != 1 || result.Skipped[0].Path != filepath.Join(src, "a.txt") ||
+		!strings.Contains(result.Skipped[0].Err.Error(), "not under the relative base") {
+		t.Errorf("skipped %v, want a.txt as not under the relative base", result.Skipped)
+	}
+}
+
+func TestPrintableName(t *testing.T) {
+	tests := []struct {
+		name, want string
+	}{
+		{"plain.txt", "plain.txt"},
+		{"with space.txt", "with space.txt"},
+		{"résumé.txt", "résumé.txt"},
+		{"two\nlines.txt", `"two\nlines.txt"`},
+		{"tab\there", `"tab\there"`},
+		{"bad\xffbyte", `"bad\xffbyte"`},
+	}
+	for _, test := range tests {
+		if got := printableName(test.name); got != test.want {
+			t.Errorf("printableName(%q) = %s, want %s", test.name, got, test.want)
+		}
+	}
+}
+
+func TestUnusualNamesAreArchivedIntact(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("file names cannot hold newlines on Windows")
+	}
+	dir := t.TempDir()
+	src := filepath.Join(dir, "src")
+	name := "two\nlines\t.txt"
+	writeFile(t, filepath.Join(src, name), "content")
+	writeFile(t, filepath.Join(dir, "list.txt"), "[files]\n*.txt\n")
+
+	var out bytes.Buffer
+	cfg := DefaultConfig()
+	cfg.Directories = []string{src}
+	cfg.ListFile = filepath.Join(dir, "list.txt")
+	cfg.OutputPath = dir
+	cfg.OutputName = "out.zip"
+	cfg.DryRun = true
+	cfg.Output = &out
+	if _, err := Run(cfg); err != nil {
+		t.Fatal(err)
+	}
+	// The listing keeps one file per line
+	if want := strconv.Quote(filepath.Join(src, name)); !strings.Contains(out.String(), want+"\n") {
+		t.Errorf("dry run listed %q, want the quoted name %s", out.String(), want)
+	}
+
+	cfg.DryRun = false
+	cfg.Output = io.Discard
+	if got, want := archiveNames(t, cfg), []string{name}; !slices.Equal(got, want) {
+		t.Errorf("archive holds %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,291 @@
+package pathfinder
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"io/fs"
+	"os"
+	"sync"
+)
+
+// maxBufferedFileSize is the largest file a worker reads into memory, and
+// maxBufferedBytes the most content all workers together hold in memory
+// before it is written. Other files are streamed into the archive by the
+// writer instead.
+const (
+	maxBufferedFileSize = 16 << 20
+	maxBufferedBytes    = 64 << 20
+)
+
+// bufferBudget counts the bytes of file content the pipeline's workers may
+// still read into memory.
+type bufferBudget struct {
+	mu        sync.Mutex
+	remaining int64
+}
+
+// reserve takes size bytes from the budget and reports whether they were
+// available. A nil budget has none.
+func (b *bufferBudget) reserve(size int64) bool {
+	if b == nil || size > maxBufferedFileSize {
+		return false
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if size > b.remaining {
+		return false
+	}
+	b.remaining -= size
+	return true
+}
+
+// release returns size bytes to the budget.
+func (b *bufferBudget) release(size int64) {
+	b.mu.Lock()
+	b.remaining += size
+	b.mu.Unlock()
+}
+
+// archiveJob is a matched file waiting to be stored in the archive.
+type archiveJob struct {
+	path    string
+	absPath string
+	name    string
+	rule    string
+	// dir marks an empty directory, stored as an entry without content.
+	dir bool
+	// fsys is the file system source the file was found in, if any, and
+	// fsPath its name there.
+	fsys   fs.FS
+	fsPath string
+	// seq is the position of the job in the pipeline's queue.
+	seq int
+}
+
+// preparedFile is an opened source file ready to be written to the archive.
+// Its content is either buffered in data or streamed from file.
+type preparedFile struct {
+	job    archiveJob
+	info   os.FileInfo
+	data   []byte
+	file   io.ReadCloser
+	hasher hash.Hash
+	// hashed is set when a streamed file was hashed up front, see
+	// prepareFile.
+	hashed bool
+	// link is the target of a symlink stored as a link entry, see
+	// Config.PreserveSymlinks.
+	link string
+	// reserved is the part of the buffer budget taken for data.
+	reserved int64
+	err      error
+}
+
+// reader returns the content of the prepared file. Streamed content is
+// hashed as it is read.
+func (p preparedFile) reader() io.Reader {
+	if p.file == nil {
+		return bytes.NewReader(p.data)
+	}
+	if p.hashed {
+		return p.file
+	}
+	return io.TeeReader(p.file, p.hasher)
+}
+
+// checksum returns the hex encoded SHA-256 of the content. For streamed
+// files it is only complete once reader has been drained, unless the file
+// was hashed up front.
+func (p preparedFile) checksum() string {
+	return hex.EncodeToString(p.hasher.Sum(nil))
+}
+
+// prepareFile opens the source file of job. When the file is small enough
+// and budget has room for it, its content is read and hashed right away, so
+// the archive writer does not have to wait on the disk. A nil budget streams
+// every file.
+func (f *finder) prepareFile(job archiveJob, budget *bufferBudget) preparedFile {
+	prepared := preparedFile{job: job, hasher: sha256.New()}
+	if job.fsys != nil {
+		return f.prepareSourceEntry(prepared, budget)
+	}
+
+	if job.dir {
+		info, err := os.Stat(job.path)
+		if err != nil {
+			prepared.err = fmt.Errorf("failed to stat directory: %w", err)
+			return prepared
+		}
+		prepared.info = emptyDirInfo{info}
+		return prepared
+	}
+
+	if f.preservesSymlinks() {
+		info, err := os.Lstat(job.path)
+		if err != nil {
+			prepared.err = fmt.Errorf("failed to stat source file: %w", err)
+			return prepared
+		}
+		if info.Mode()&os.ModeSymlink != 0 {
+			return prepareSymlink(prepared, info)
+		}
+	}
+
+	sourceFile, err := f.openSourceFile(job.path)
+	if err != nil {
+		prepared.err = fmt.Errorf("failed to open source file: %w", err)
+		return prepared
+	}
+
+	prepared.info, err = sourceFile.Stat()
+	if err != nil {
+		sourceFile.Close()
+		prepared.err = fmt.Errorf("failed to stat source file: %w", err)
+		return prepared
+	}
+
+	if !budget.reserve(prepared.info.Size()) {
+		// Deduplication needs the checksum before the file is written, so
+		// read it once for the hash and again for the archive
+		if f.cfg.DedupContent {
+			if _, err := io.Copy(prepared.hasher, sourceFile); err != nil {
+				sourceFile.Close()
+				prepared.err = fmt.Errorf("failed to read source file: %w", err)
+				return prepared
+			}
+			if _, err := sourceFile.Seek(0, io.SeekStart); err != nil {
+				sourceFile.Close()
+				prepared.err = fmt.Errorf("failed to read source file: %w", err)
+				return prepared
+			}
+			prepared.hashed = true
+		}
+		prepared.file = sourceFile
+		return prepared
+	}
+	defer sourceFile.Close()
+	return bufferContent(prepared, sourceFile, budget, "failed to read source file")
+}
+
+// bufferContent reads the content of prepared from r into memory, within the
+// budget reserved for its size. A file that grew since it was stat'ed may
+// exceed the reservation; the difference is taken from the budget anyway,
+// and given back with the rest once the file was written.
+func bufferContent(prepared preparedFile, r io.Reader, budget *bufferBudget, failure string) preparedFile {
+	size := prepared.info.Size()
+	content := bytes.NewBuffer(make([]byte, 0, size))
+	_, err := io.Copy(io.MultiWriter(content, prepared.hasher), r)
+	if grown := int64(content.Len()) - size; grown > 0 {
+		budget.release(-grown)
+		size += grown
+	}
+	if err != nil {
+		budget.release(size)
+		prepared.err = fmt.Errorf("%s: %w", failure, err)
+		return prepared
+	}
+	prepared.data = content.Bytes()
+	prepared.reserved = size
+	return prepared
+}
+
+// emptyDirInfo reports a size of zero for a directory, which has no content
+// in the archive.
+type emptyDirInfo struct {
+	os.FileInfo
+}
+
+func (emptyDirInfo) Size() int64 {
+	return 0
+}
+
+// pipeline reads matched files with several workers while a single writer
+// goroutine owns the archive, since archive writers are not safe for
+// concurrent use. The writer stores files in the order they were queued, so
+// the archive matches the one a serial run writes.
+type pipeline struct {
+	jobs    chan archiveJob
+	results chan preparedFile
+	workers sync.WaitGroup
+	done    chan struct{}
+	// slots bounds the number of files queued but not yet written, which
+	// the writer may have to hold back to keep the order, and budget the
+	// bytes of their content held in memory.
+	slots  chan struct{}
+	budget *bufferBudget
+	next   int
+}
+
+// startPipeline starts the given number of reader workers and the writer.
+func (f *finder) startPipeline(workers int) {
+	p := &pipeline{
+		jobs:    make(chan archiveJob, workers*4),
+		results: make(chan preparedFile, workers*4),
+		done:    make(chan struct{}),
+		slots:   make(chan struct{}, workers*4),
+		budget:  &bufferBudget{remaining: maxBufferedBytes},
+	}
+
+	for i := 0; i < workers; i++ {
+		p.workers.Add(1)
+		go func() {
+			defer p.workers.Done()
+			for job := range p.jobs {
+				p.results <- f.prepareFile(job, p.budget)
+			}
+		}()
+	}
+
+	go func() {
+		defer close(p.done)
+		pending := make(map[int]preparedFile)
+		written := 0
+		for prepared := range p.results {
+			pending[prepared.job.seq] = prepared
+			for {
+				prepared, ok := pending[written]
+				if !ok {
+					break
+				}
+				delete(pending, written)
+				written++
+
+				if err := f.addToZipArchive(prepared); err != nil {
+					f.fileFailed(prepared.job.path, err)
+				}
+				p.budget.release(prepared.reserved)
+				<-p.slots
+			}
+		}
+	}()
+
+	f.pipeline = p
+}
+
+// enqueue hands job to the workers, waiting while too many files are
+// queued.
+func (p *pipeline) enqueue(job archiveJob) {
+	p.slots <- struct{}{}
+	job.seq = p.next
+	p.next++
+	p.jobs <- job
+}
+
+// stopPipeline waits until every queued file has been written. It is safe
+// to call more than once.
+func (f *finder) stopPipeline() {
+	p := f.pipeline
+	if p == nil {
+		return
+	}
+	f.pipeline = nil
+
+	close(p.jobs)
+	p.workers.Wait()
+	close(p.results)
+	<-p.done
+}
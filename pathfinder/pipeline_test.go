@@ -0,0 +1,149 @@
+package pathfinder
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestPipelineMatchesSerialArchive(t *testing.T) {
+	dir := t.TempDir()
+	for i := 0; i < 50; i++ {
+		content := strings.Repeat(fmt.Sprintf("file %d ", i), i*40)
+		writeFile(t, filepath.Join(dir, "src", fmt.Sprintf("d%d", i%5), fmt.Sprintf("f%02d.txt", i)), content)
+	}
+	writeFile(t, filepath.Join(dir, "list.txt"), "[files]\n*.txt\n")
+
+	archives := make(map[int][]byte)
+	for _, workers := range []int{1, 8} {
+		cfg := DefaultConfig()
+		cfg.Directories = []string{filepath.Join(dir, "src")}
+		cfg.ListFile = filepath.Join(dir, "list.txt")
+		cfg.OutputPath = dir
+		cfg.OutputName = fmt.Sprintf("out%d.zip", workers)
+		cfg.Reproducible = true
+		cfg.Workers = workers
+		cfg.Output = io.Discard
+
+		result, err := Run(cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result.FilesAdded != 50 {
+			t.Errorf("%d workers added %d files, want 50", workers, result.FilesAdded)
+		}
+		if archives[workers], err = os.ReadFile(result.OutputPath); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if !bytes.Equal(archives[1], archives[8]) {
+		t.Error("the archive written by 8 workers differs from the serial one")
+	}
+}
+
+// TestPipelineSplitDedup runs the writer goroutine through every path that
+// updates the result, the manifest and the dedup index; run it with -race.
+func TestPipelineSplitDedup(t *testing.T) {
+	dir := t.TempDir()
+	for i := 0; i < 40; i++ {
+		// Each content is shared by four files
+		content := strings.Repeat(fmt.Sprintf("content %d ", i%10), 200)
+		writeFile(t, filepath.Join(dir, "src", fmt.Sprintf("f%02d.txt", i)), content)
+	}
+	writeFile(t, filepath.Join(dir, "list.txt"), "[files]\n*.txt\n")
+
+	cfg := DefaultConfig()
+	cfg.Directories = []string{filepath.Join(dir, "src")}
+	cfg.ListFile = filepath.Join(dir, "list.txt")
+	cfg.OutputPath = filepath.Join(dir, "out")
+	cfg.CreateOutputDir = true
+	cfg.OutputName = "out.zip"
+	cfg.SplitSize = 2048
+	cfg.DedupContent = true
+	cfg.Manifest = true
+	cfg.Workers = 8
+	cfg.Output = io.Discard
+	cfg.ErrOutput = io.Discard
+
+	result, err := Run(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.FilesAdded != 40 {
+		t.Errorf("added %d files, want 40", result.FilesAdded)
+	}
+	if len(result.Volumes) < 2 {
+		t.Errorf("archive was split into %d volumes, want several", len(result.Volumes))
+	}
+
+	entries := 0
+	for _, volume := range result.Volumes {
+		entries += len(readZip(t, volume))
+	}
+	if entries != 40 {
+		t.Errorf("volumes hold %d entries, want 40", entries)
+	}
+}
+
+func BenchmarkRun(b *testing.B) {
+	dir := b.TempDir()
+	content := bytes.Repeat([]byte("benchmark content "), 4096)
+	for i := 0; i < 200; i++ {
+		path := filepath.Join(dir, "src", fmt.Sprintf("d%d", i%10), fmt.Sprintf("f%03d.txt", i))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			b.Fatal(err)
+		}
+		if err := os.WriteFile(path, content, 0o644); err != nil {
+			b.Fatal(err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(dir, "list.txt"), []byte("[files]\n*.txt\n"), 0o644); err != nil {
+		b.Fatal(err)
+	}
+
+	for _, workers := range []int{1, 4, 8} {
+		b.Run(fmt.Sprint("workers=", workers), func(b *testing.B) {
+			cfg := DefaultConfig()
+			cfg.Directories = []string{filepath.Join(dir, "src")}
+			cfg.ListFile = filepath.Join(dir, "list.txt")
+			cfg.OutputPath = b.TempDir()
+			cfg.OutputName = "out.zip"
+			cfg.Force = true
+			cfg.Workers = workers
+			cfg.Output = io.Discard
+			b.SetBytes(int64(200 * len(content)))
+
+			for i := 0; i < b.N; i++ {
+				if _, err := Run(cfg); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func TestBufferBudget(t *testing.T) {
+	var none *bufferBudget
+	if none.reserve(1) {
+		t.Error("a nil budget reserved bytes")
+	}
+
+	budget := &bufferBudget{remaining: 2 * maxBufferedFileSize}
+	if budget.reserve(maxBufferedFileSize + 1) {
+		t.Error("reserved more than maxBufferedFileSize for one file")
+	}
+	if !budget.reserve(maxBufferedFileSize) || !budget.reserve(maxBufferedFileSize) {
+		t.Fatal("could not reserve the whole budget")
+	}
+	if budget.reserve(1) {
+		t.Error("reserved beyond the budget")
+	}
+	budget.release(maxBufferedFileSize)
+	if !budget.reserve(10) {
+		t.Error("released bytes could not be reserved again")
+	}
+}
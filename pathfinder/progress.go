@@ -0,0 +1,109 @@
+package pathfinder
+
+import (
+	"fmt"
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// progressInterval is the longest time between two progress reports.
+	progressInterval = time.Second
+	// progressEvery reports progress after this many added files even when
+	// progressInterval has not elapsed yet.
+	progressEvery = 1000
+)
+
+// progressReporter periodically writes the number of matched and added files
+// and the bytes written so far. Its methods are safe for concurrent use and
+// do nothing on a nil receiver.
+type progressReporter struct {
+	out      io.Writer
+	interval time.Duration
+	every    int64
+	now      func() time.Time
+
+	matched atomic.Int64
+	added   atomic.Int64
+	bytes   atomic.Int64
+
+	mu            sync.Mutex
+	lastReport    time.Time
+	lastReportedN int64
+}
+
+func newProgressReporter(out io.Writer) *progressReporter {
+	return &progressReporter{
+		out:        out,
+		interval:   progressInterval,
+		every:      progressEvery,
+		now:        time.Now,
+		lastReport: time.Now(),
+	}
+}
+
+// fileMatched counts a file selected for the archive.
+func (p *progressReporter) fileMatched() {
+	if p == nil {
+		return
+	}
+	p.matched.Add(1)
+	p.maybeReport()
+}
+
+// fileAdded counts a file written to the archive with its size in bytes.
+func (p *progressReporter) fileAdded(size int64) {
+	if p == nil {
+		return
+	}
+	p.added.Add(1)
+	p.bytes.Add(size)
+	p.maybeReport()
+}
+
+// maybeReport writes a report when the interval has elapsed or enough files
+// were added since the last one.
+func (p *progressReporter) maybeReport() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := p.now()
+	added := p.added.Load()
+	if now.Sub(p.lastReport) < p.interval && added-p.lastReportedN < p.every {
+		return
+	}
+	p.report()
+	p.lastReport = now
+	p.lastReportedN = added
+}
+
+// finish writes a final report.
+func (p *progressReporter) finish() {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.report()
+}
+
+func (p *progressReporter) report() {
+	fmt.Fprintf(p.out, "Progress: %d matched, %d added, %s written\n",
+		p.matched.Load(), p.added.Load(), formatBytes(p.bytes.Load()))
+}
+
+// formatBytes formats a byte count using binary units, e.g. "45.2 MiB".
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
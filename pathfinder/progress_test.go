@@ -0,0 +1,61 @@
+package pathfinder
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestProgressReportsAreThrottled(t *testing.T) {
+	var out strings.Builder
+	clock := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	p := newProgressReporter(&out)
+	p.now = func() time.Time { return clock }
+	p.lastReport = clock
+	p.every = 3
+
+	reports := func() int { return strings.Count(out.String(), "Progress: ") }
+
+	// Neither the interval nor enough files have passed
+	p.fileMatched()
+	p.fileAdded(100)
+	if n := reports(); n != 0 {
+		t.Fatalf("%d reports before the interval elapsed, want 0", n)
+	}
+
+	// The interval elapsed
+	clock = clock.Add(progressInterval)
+	p.fileMatched()
+	if n := reports(); n != 1 {
+		t.Fatalf("%d reports after the interval elapsed, want 1", n)
+	}
+	if !strings.Contains(out.String(), "Progress: 2 matched, 1 added, 100 B written\n") {
+		t.Errorf("unexpected report %q", out.String())
+	}
+
+	// Enough files were added since the last report, without time passing
+	p.fileAdded(1024)
+	p.fileAdded(1024)
+	if n := reports(); n != 1 {
+		t.Fatalf("%d reports after two more files, want 1", n)
+	}
+	p.fileAdded(1024)
+	if n := reports(); n != 2 {
+		t.Fatalf("%d reports after three added files, want 2", n)
+	}
+
+	p.finish()
+	if n := reports(); n != 3 {
+		t.Fatalf("%d reports after finish, want 3", n)
+	}
+	if !strings.HasSuffix(out.String(), "Progress: 2 matched, 4 added, 3.1 KiB written\n") {
+		t.Errorf("unexpected final report %q", out.String())
+	}
+}
+
+func TestNilProgressReporter(t *testing.T) {
+	var p *progressReporter
+	p.fileMatched()
+	p.fileAdded(1)
+	p.finish()
+}
@@ -0,0 +1,129 @@
+package pathfinder
+
+import (
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// regexPathPrefix marks a [regex] entry that is matched against the file's
+// slash-separated path relative to the search directory instead of its base
+// name.
+const regexPathPrefix = "path:"
+
+// listRegex is a compiled entry of the [regex] section.
+type listRegex struct {
+	// entry is the line as written in the list file.
+	entry    string
+	negate   bool
+	fullPath bool
+	re       *regexp.Regexp
+}
+
+// compileRegexes compiles the entries of the [regex] section. Like the other
+// sections an entry starting with "!" removes the files that earlier entries
+// matched.
+func compileRegexes(entries []string, caseInsensitive bool) ([]listRegex, error) {
+	compiled := make([]listRegex, 0, len(entries))
+	for _, entry := range entries {
+		pattern, negate := strings.CutPrefix(entry, "!")
+		pattern, fullPath := strings.CutPrefix(pattern, regexPathPrefix)
+		if caseInsensitive {
+			pattern = "(?i)" + pattern
+		}
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid regular expression %q in the list file: %w", entry, err)
+		}
+		compiled = append(compiled, listRegex{entry: entry, negate: negate, fullPath: fullPath, re: re})
+	}
+	return compiled, nil
+}
+
+// compileExcludeRegexes compiles the regular expressions of ExcludeRegexes.
+func compileExcludeRegexes(patterns []string, caseInsensitive bool) ([]*regexp.Regexp, error) {
+	compiled := make([]*regexp.Regexp, 0, len(patterns))
+	for _, pattern := range patterns {
+		expr := pattern
+		if caseInsensitive {
+			expr = "(?i)" + expr
+		}
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid exclude regular expression %q: %w", pattern, err)
+		}
+		compiled = append(compiled, re)
+	}
+	return compiled, nil
+}
+
+// relPath returns path relative to the current search directory with slash
+// separators, which is what regular expressions are matched against.
+func (f *finder) relPath(path string) string {
+	rel, err := filepath.Rel(f.directory, path)
+	if err != nil {
+		rel = path
+	}
+	return filepath.ToSlash(rel)
+}
+
+// excludedByRegex reports whether path matches one of ExcludeRegexes.
+func (f *finder) excludedByRegex(path string) bool {
+	if len(f.excludeRegexps) == 0 {
+		return false
+	}
+	rel := f.relPath(path)
+	for _, re := range f.excludeRegexps {
+		if re.MatchString(rel) {
+			return true
+		}
+	}
+	return false
+}
+
+// matches reports whether the regex selects the file with the given base name
+// and path relative to the search directory.
+func (r listRegex) matches(name, relPath string) bool {
+	if r.fullPath {
+		return r.re.MatchString(relPath)
+	}
+	return r.re.MatchString(name)
+}
+
+func (f *finder) handleFileByRegex(path string, d fs.DirEntry) {
+	if len(f.regexps) == 0 || d.IsDir() || f.shouldExclude(path, d) || !f.passesFilters(d) {
+		return
+	}
+
+	relPath := f.relPath(path)
+
+	// The last matching entry decides, as in evaluateRules
+	included := false
+	for _, r := range f.regexps {
+		if included != r.negate {
+			continue
+		}
+		if r.matches(d.Name(), relPath) {
+			included = !r.negate
+		}
+	}
+	if !included {
+		return
+	}
+
+	for _, r := range f.regexps {
+		if !r.negate && r.matches(d.Name(), relPath) {
+			f.matched[ruleKey{"regex", r.entry}] = struct{}{}
+		}
+	}
+	if f.cfg.Verbose {
+		fmt.Fprintf(f.cfg.Output, "Found by regex: %s\n", path)
+	}
+
+	// Add the file to the new zip archive
+	if err := f.addFile(path, "regex"); err != nil {
+		f.fileFailed(path, err)
+	}
+}
@@ -0,0 +1,96 @@
+package pathfinder
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestRegexSection(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "src")
+	for _, name := range []string{"report-2024-01.csv", "report-2024-1.csv", "old/report-2023-12.csv", "logs/app/x.log", "app/y.log"} {
+		writeFile(t, filepath.Join(src, filepath.FromSlash(name)), name)
+	}
+
+	tests := []struct {
+		regexes []string
+		want    []string
+	}{
+		// Without a prefix the base name is matched, in any directory
+		{[]string{`^report-\d{4}-\d{2}\.csv$`}, []string{"old/report-2023-12.csv", "report-2024-01.csv"}},
+		// With path: the slash-separated relative path is
+		{[]string{`path:^logs/.*\.log$`}, []string{"logs/app/x.log"}},
+		{[]string{`^logs/.*\.log$`}, nil},
+		{[]string{`\.csv$`, `!path:^old/`}, []string{"report-2024-01.csv", "report-2024-1.csv"}},
+	}
+	for _, test := range tests {
+		writeFile(t, filepath.Join(dir, "list.txt"), "[regex]\n"+strings.Join(test.regexes, "\n")+"\n")
+		cfg := DefaultConfig()
+		cfg.Directories = []string{src}
+		cfg.ListFile = filepath.Join(dir, "list.txt")
+		cfg.Output = io.Discard
+
+		if got := matchNames(t, cfg, src); !slices.Equal(got, test.want) {
+			t.Errorf("[regex] %q matched %v, want %v", test.regexes, got, test.want)
+		}
+	}
+}
+
+func TestInvalidRegexFailsBeforeSearching(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "src", "a.txt"), "alpha")
+	writeFile(t, filepath.Join(dir, "list.txt"), "[files]\na.txt\n[regex]\npath:^a(\n")
+	out := filepath.Join(dir, "out")
+	if err := os.Mkdir(out, 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	var added int
+	cfg := DefaultConfig()
+	cfg.Directories = []string{filepath.Join(dir, "src")}
+	cfg.ListFile = filepath.Join(dir, "list.txt")
+	cfg.OutputPath = out
+	cfg.OutputName = "out.zip"
+	cfg.Output = io.Discard
+	cfg.OnFileAdded = func(string, os.FileInfo, string) { added++ }
+
+	_, err := Run(cfg)
+	if err == nil || !strings.Contains(err.Error(), `invalid regular expression "path:^a("`) {
+		t.Errorf("Run returned %v, want an invalid regular expression error", err)
+	}
+	if added > 0 {
+		t.Errorf("%d files were added before the error", added)
+	}
+	if entries, err := os.ReadDir(out); err != nil || len(entries) > 0 {
+		t.Errorf("failed run left %v behind (%v)", entries, err)
+	}
+}
+
+func TestExcludeRegexes(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "src")
+	for _, name := range []string{"a.txt", "a.txt.bak", "data/b.bak", "data/c.txt", "cache/d.txt", "e.tmp"} {
+		writeFile(t, filepath.Join(src, filepath.FromSlash(name)), name)
+	}
+	writeFile(t, filepath.Join(dir, "list.txt"), "[files]\n*\n[exclude]\n*.tmp\n")
+
+	cfg := DefaultConfig()
+	cfg.Directories = []string{src}
+	cfg.ListFile = filepath.Join(dir, "list.txt")
+	cfg.Output = io.Discard
+	cfg.ExcludeRegexes = []string{`.*\.bak$`, `^cache/`}
+
+	// The flag and the [exclude] section both apply
+	if got, want := matchNames(t, cfg, src), []string{"a.txt", "data/c.txt"}; !slices.Equal(got, want) {
+		t.Errorf("matched %v, want %v", got, want)
+	}
+
+	cfg.ExcludeRegexes = []string{`(`}
+	if _, err := Run(cfg); err == nil || !strings.Contains(err.Error(), "invalid exclude regular expression") {
+		t.Errorf("Run with an invalid exclude regex returned %v", err)
+	}
+}
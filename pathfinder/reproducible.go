@@ -0,0 +1,36 @@
+package pathfinder
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+)
+
+// reproducibleTime is the entry timestamp of reproducible archives when
+// SOURCE_DATE_EPOCH is not set. It is the earliest time zip can store.
+var reproducibleTime = time.Date(1980, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+// entryTime returns the timestamp stored for every entry of a reproducible
+// archive, taken from the SOURCE_DATE_EPOCH environment variable if set.
+func entryTime() (time.Time, error) {
+	epoch := os.Getenv("SOURCE_DATE_EPOCH")
+	if epoch == "" {
+		return reproducibleTime, nil
+	}
+	seconds, err := strconv.ParseInt(epoch, 10, 64)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid SOURCE_DATE_EPOCH %q: %w", epoch, err)
+	}
+	return time.Unix(seconds, 0).UTC(), nil
+}
+
+// fixedTimeInfo reports a fixed modification time for a file.
+type fixedTimeInfo struct {
+	os.FileInfo
+	modTime time.Time
+}
+
+func (i fixedTimeInfo) ModTime() time.Time {
+	return i.modTime
+}
@@ -0,0 +1,80 @@
+package pathfinder
+
+import (
+	"archive/zip"
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestReproducibleArchivesAreIdentical(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "src")
+	names := []string{"a.txt", "b/c.txt", "b/d.txt"}
+	for _, name := range names {
+		writeFile(t, filepath.Join(src, filepath.FromSlash(name)), name)
+	}
+	writeFile(t, filepath.Join(dir, "list.txt"), "[files]\n*.txt\n")
+
+	run := func(name string, modTime time.Time) []byte {
+		t.Helper()
+		for _, file := range names {
+			if err := os.Chtimes(filepath.Join(src, filepath.FromSlash(file)), modTime, modTime); err != nil {
+				t.Fatal(err)
+			}
+		}
+		cfg := DefaultConfig()
+		cfg.Directories = []string{src}
+		cfg.ListFile = filepath.Join(dir, "list.txt")
+		cfg.OutputPath = dir
+		cfg.OutputName = name
+		cfg.Reproducible = true
+		cfg.Output = io.Discard
+		result, err := Run(cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := os.ReadFile(result.OutputPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return data
+	}
+
+	first := run("first.zip", time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC))
+	second := run("second.zip", time.Date(2023, 6, 7, 8, 9, 10, 0, time.UTC))
+	if !bytes.Equal(first, second) {
+		t.Fatal("archives of files with different modification times differ")
+	}
+
+	reader, err := zip.NewReader(bytes.NewReader(first), int64(len(first)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, file := range reader.File {
+		if !file.Modified.Equal(reproducibleTime) {
+			t.Errorf("%s is dated %v, want %v", file.Name, file.Modified, reproducibleTime)
+		}
+	}
+
+	// SOURCE_DATE_EPOCH sets the timestamp instead
+	t.Setenv("SOURCE_DATE_EPOCH", "1700000000")
+	epoch := run("epoch.zip", time.Now())
+	reader, err = zip.NewReader(bytes.NewReader(epoch), int64(len(epoch)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := time.Unix(1700000000, 0); !reader.File[0].Modified.Equal(want) {
+		t.Errorf("entry dated %v, want %v", reader.File[0].Modified, want)
+	}
+}
+
+func TestInvalidSourceDateEpoch(t *testing.T) {
+	t.Setenv("SOURCE_DATE_EPOCH", "yesterday")
+	if _, err := entryTime(); err == nil {
+		t.Error("entryTime accepted an invalid SOURCE_DATE_EPOCH")
+	}
+}
@@ -0,0 +1,43 @@
+package pathfinder
+
+import (
+	"errors"
+	"os"
+	"syscall"
+	"time"
+)
+
+// openSourceFile opens the matched file at path. Transient errors are
+// retried up to OpenRetries times, waiting RetryBackoff before the first
+// retry and twice as long before each further one.
+func (f *finder) openSourceFile(path string) (*os.File, error) {
+	open := f.openFile
+	if open == nil {
+		open = os.Open
+	}
+
+	backoff := f.cfg.RetryBackoff
+	for attempt := 0; ; attempt++ {
+		file, err := open(path)
+		if err == nil || attempt >= f.cfg.OpenRetries || !isTransient(err) {
+			return file, err
+		}
+
+		timer := time.NewTimer(backoff)
+		select {
+		case <-f.ctx.Done():
+			timer.Stop()
+			return nil, err
+		case <-timer.C:
+		}
+		backoff *= 2
+	}
+}
+
+// isTransient reports whether err may go away when the operation is simply
+// tried again, as interrupted calls and busy resources on network file
+// systems do. Missing files and denied permissions are permanent.
+func isTransient(err error) bool {
+	return errors.Is(err, syscall.EINTR) || errors.Is(err, syscall.EAGAIN) ||
+		errors.Is(err, syscall.EBUSY) || errors.Is(err, syscall.ETIMEDOUT)
+}
@@ -0,0 +1,57 @@
+package pathfinder
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestOpenRetriesTransientErrors(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "a.txt"), "alpha")
+
+	tests := []struct {
+		name  string
+		err   error
+		fails int
+		calls int
+	}{
+		{"EAGAIN", syscall.EAGAIN, 2, 3},
+		{"ENOENT", syscall.ENOENT, 1, 1},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cfg := DefaultConfig()
+			cfg.OpenRetries = 3
+			cfg.RetryBackoff = time.Millisecond
+			f := &finder{ctx: context.Background(), cfg: cfg}
+
+			calls := 0
+			f.openFile = func(path string) (*os.File, error) {
+				calls++
+				if calls <= test.fails {
+					return nil, &fs.PathError{Op: "open", Path: path, Err: test.err}
+				}
+				return os.Open(path)
+			}
+
+			file, err := f.openSourceFile(filepath.Join(dir, "a.txt"))
+			if calls != test.calls {
+				t.Errorf("opened %d times, want %d", calls, test.calls)
+			}
+			if test.fails < test.calls {
+				if err != nil {
+					t.Fatalf("open failed after retries: %v", err)
+				}
+				file.Close()
+			} else if !errors.Is(err, test.err) {
+				t.Errorf("open returned %v, want %v", err, test.err)
+			}
+		})
+	}
+}
@@ -0,0 +1,254 @@
+package pathfinder
+
+import (
+	"archive/zip"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// openSource prepares the search directory dir for walking. With Config.FS,
+// dir is searched within that file system. Otherwise a directory is
+// searched on disk, while a zip or tar archive is searched through its
+// entries, which are named as if the archive were a directory: "src.zip"
+// holding "docs/a.txt" yields the path "src.zip/docs/a.txt".
+func (f *finder) openSource(dir string) error {
+	f.fsys = nil
+	if f.cfg.FS != nil {
+		fsys, err := fs.Sub(f.cfg.FS, fsName(dir))
+		if err != nil {
+			return fmt.Errorf("error opening directory %s: %w", dir, err)
+		}
+		f.fsys = fsys
+		return nil
+	}
+
+	info, err := os.Stat(dir)
+	if err != nil || info.IsDir() {
+		return nil
+	}
+
+	fsys, closer, err := openArchiveFS(dir)
+	if err != nil {
+		return fmt.Errorf("error opening archive %s: %w", dir, err)
+	}
+	if closer != nil {
+		f.sourceClosers = append(f.sourceClosers, closer)
+	}
+	f.fsys = fsys
+	return nil
+}
+
+// openArchiveFS opens the archive at path, chosen by its extension, as a
+// file system. Entries are read from the file, which stays open until closer
+// is called. A compressed tar archive is decompressed into a temporary file
+// first, as its entries cannot be read at random otherwise.
+func openArchiveFS(path string) (fsys fs.FS, closer io.Closer, err error) {
+	lower := strings.ToLower(path)
+	if strings.HasSuffix(lower, ".zip") {
+		reader, err := zip.OpenReader(path)
+		if err != nil {
+			return nil, nil, err
+		}
+		return reader, reader, nil
+	}
+
+	compressed := strings.HasSuffix(lower, ".tar.gz") || strings.HasSuffix(lower, ".tgz")
+	if !compressed && !strings.HasSuffix(lower, ".tar") {
+		return nil, nil, fmt.Errorf("not a directory or a zip, tar or tgz archive")
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	var archive tarSource = file
+	closer = file
+	if compressed {
+		temp, err := decompressToTemp(file)
+		file.Close()
+		if err != nil {
+			return nil, nil, err
+		}
+		archive, closer = temp, temp
+	}
+
+	tarFS, err := readTarFS(archive)
+	if err != nil {
+		closer.Close()
+		return nil, nil, err
+	}
+	return tarFS, closer, nil
+}
+
+// decompressToTemp decompresses the gzip stream r into a temporary file,
+// which is removed when it is closed.
+func decompressToTemp(r io.Reader) (*tempFile, error) {
+	gzipReader, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+	defer gzipReader.Close()
+
+	file, err := os.CreateTemp("", "pathfinder-*.tar")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temporary file: %w", err)
+	}
+	temp := &tempFile{file}
+	if _, err := io.Copy(temp, gzipReader); err != nil {
+		temp.Close()
+		return nil, fmt.Errorf("failed to decompress archive: %w", err)
+	}
+	if _, err := temp.Seek(0, io.SeekStart); err != nil {
+		temp.Close()
+		return nil, err
+	}
+	return temp, nil
+}
+
+// tempFile is a temporary file that is removed when it is closed.
+type tempFile struct {
+	*os.File
+}
+
+func (t *tempFile) Close() error {
+	err := t.File.Close()
+	os.Remove(t.Name())
+	return err
+}
+
+// statDirectory returns the info of the search directory dir, within fsys
+// when it is not nil and on disk otherwise.
+func statDirectory(fsys fs.FS, dir string) (os.FileInfo, error) {
+	if fsys != nil {
+		return fs.Stat(fsys, fsName(dir))
+	}
+	return os.Stat(dir)
+}
+
+// fsName turns dir into a name valid within an fs.FS.
+func fsName(dir string) string {
+	return path.Clean(filepath.ToSlash(dir))
+}
+
+// closeSources closes the archives opened as search directories.
+func (f *finder) closeSources() {
+	for _, closer := range f.sourceClosers {
+		closer.Close()
+	}
+	f.sourceClosers = nil
+}
+
+// fsPath returns the name within the file system source of path, a path
+// below the current search directory.
+func (f *finder) fsPath(path string) string {
+	rel, err := filepath.Rel(f.directory, path)
+	if err != nil {
+		return path
+	}
+	return filepath.ToSlash(rel)
+}
+
+// walkFS calls fn for every entry under root within the file system source,
+// like walk does on disk. Symlinks there cannot be followed and are skipped.
+func (f *finder) walkFS(root string, fn fs.WalkDirFunc) error {
+	return fs.WalkDir(f.fsys, f.fsPath(root), func(name string, d fs.DirEntry, err error) error {
+		path := filepath.Join(f.directory, filepath.FromSlash(name))
+		if err == nil && d.Type()&fs.ModeSymlink != 0 {
+			if f.cfg.Verbose {
+				fmt.Fprintf(f.cfg.Output, "Skipping symlink: %s\n", path)
+			}
+			return nil
+		}
+		if err == nil && f.special(path, d.Type()) {
+			return nil
+		}
+		return fn(path, d, err)
+	})
+}
+
+// stat returns the info of path, on disk or within the file system source.
+// Preserved symlinks are described themselves rather than by their target.
+func (f *finder) stat(path string) (os.FileInfo, error) {
+	if f.fsys != nil {
+		return fs.Stat(f.fsys, f.fsPath(path))
+	}
+	if f.preservesSymlinks() {
+		return os.Lstat(path)
+	}
+	return os.Stat(path)
+}
+
+// open opens path for reading, on disk or within the file system source.
+func (f *finder) open(path string) (fs.File, error) {
+	if f.fsys != nil {
+		return f.fsys.Open(f.fsPath(path))
+	}
+	return os.Open(path)
+}
+
+// isEmptyDir reports whether the directory at path has no entries.
+func (f *finder) isEmptyDir(path string) bool {
+	if f.fsys != nil {
+		entries, err := fs.ReadDir(f.fsys, f.fsPath(path))
+		return err == nil && len(entries) == 0
+	}
+	dir, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer dir.Close()
+	_, err = dir.Readdirnames(1)
+	return err == io.EOF
+}
+
+// prepareSourceEntry opens a job found in a file system source, like
+// prepareFile does for files on disk.
+func (f *finder) prepareSourceEntry(prepared preparedFile, budget *bufferBudget) preparedFile {
+	job := prepared.job
+	file, err := job.fsys.Open(job.fsPath)
+	if err != nil {
+		prepared.err = fmt.Errorf("failed to open source entry: %w", err)
+		return prepared
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		prepared.err = fmt.Errorf("failed to stat source entry: %w", err)
+		return prepared
+	}
+	if job.dir {
+		file.Close()
+		prepared.info = emptyDirInfo{info}
+		return prepared
+	}
+	prepared.info = info
+
+	if !budget.reserve(info.Size()) {
+		// Entries cannot be seeked back, so deduplication reads the entry
+		// once for the hash and opens it again for the archive
+		if f.cfg.DedupContent {
+			_, err := io.Copy(prepared.hasher, file)
+			file.Close()
+			if err != nil {
+				prepared.err = fmt.Errorf("failed to read source entry: %w", err)
+				return prepared
+			}
+			if file, err = job.fsys.Open(job.fsPath); err != nil {
+				prepared.err = fmt.Errorf("failed to open source entry: %w", err)
+				return prepared
+			}
+			prepared.hashed = true
+		}
+		prepared.file = file
+		return prepared
+	}
+	defer file.Close()
+	return bufferContent(prepared, file, budget, "failed to read source entry")
+}
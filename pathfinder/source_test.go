@@ -0,0 +1,185 @@
+package pathfinder
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+)
+
+func TestTarFSReadsEntriesFromArchive(t *testing.T) {
+	var archive bytes.Buffer
+	writer := tar.NewWriter(&archive)
+	files := []struct {
+		header  tar.Header
+		content string
+	}{
+		{tar.Header{Name: "docs/", Typeflag: tar.TypeDir, Mode: 0o755}, ""},
+		{tar.Header{Name: "docs/a.txt", Typeflag: tar.TypeReg, Mode: 0o644}, "alpha"},
+		{tar.Header{Name: "docs/sub/b.txt", Typeflag: tar.TypeReg, Mode: 0o644}, "bravo"},
+		{tar.Header{Name: "c.txt", Typeflag: tar.TypeLink, Linkname: "docs/a.txt"}, ""},
+		{tar.Header{Name: "link", Typeflag: tar.TypeSymlink, Linkname: "c.txt"}, ""},
+	}
+	for _, file := range files {
+		file.header.Size = int64(len(file.content))
+		if err := writer.WriteHeader(&file.header); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := writer.Write([]byte(file.content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	fsys, err := readTarFS(bytes.NewReader(archive.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := fstest.TestFS(fsys, "docs/a.txt", "docs/sub/b.txt", "c.txt"); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, want := range map[string]string{"docs/a.txt": "alpha", "docs/sub/b.txt": "bravo", "c.txt": "alpha"} {
+		if fsys.entries[name].data != nil {
+			t.Errorf("content of %s is held in memory", name)
+		}
+		got, err := fs.ReadFile(fsys, name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != want {
+			t.Errorf("%s = %q, want %q", name, got, want)
+		}
+	}
+}
+
+func TestArchiveSourceEntries(t *testing.T) {
+	dir := t.TempDir()
+	content := map[string]string{
+		"docs/a.txt":     "alpha",
+		"docs/sub/b.txt": "bravo",
+		"docs/copy.txt":  "alpha",
+		"other.bin":      "binary",
+	}
+
+	zipFile, err := os.Create(filepath.Join(dir, "src.zip"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	zipWriter := zip.NewWriter(zipFile)
+	for name, data := range content {
+		w, err := zipWriter.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		io.WriteString(w, data)
+	}
+	if err := zipWriter.Close(); err != nil {
+		t.Fatal(err)
+	}
+	zipFile.Close()
+
+	tgzFile, err := os.Create(filepath.Join(dir, "src.tgz"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	gzipWriter := gzip.NewWriter(tgzFile)
+	tarWriter := tar.NewWriter(gzipWriter)
+	for name, data := range content {
+		header := &tar.Header{Name: name, Typeflag: tar.TypeReg, Mode: 0o644, Size: int64(len(data))}
+		if err := tarWriter.WriteHeader(header); err != nil {
+			t.Fatal(err)
+		}
+		io.WriteString(tarWriter, data)
+	}
+	tarWriter.Close()
+	gzipWriter.Close()
+	tgzFile.Close()
+
+	writeFile(t, filepath.Join(dir, "list.txt"), "[files]\n*.txt\n")
+
+	for _, workers := range []int{1, 4} {
+		t.Run(fmt.Sprint("workers=", workers), func(t *testing.T) {
+			cfg := DefaultConfig()
+			cfg.Directories = []string{filepath.Join(dir, "src.zip"), filepath.Join(dir, "src.tgz")}
+			cfg.ListFile = filepath.Join(dir, "list.txt")
+			cfg.OutputPath = t.TempDir()
+			cfg.OutputName = "out.zip"
+			cfg.DedupContent = true
+			cfg.Workers = workers
+			cfg.Output = io.Discard
+
+			result, err := Run(cfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			// Copies are stored as links to the first entry with the content
+			entries := readZip(t, result.OutputPath)
+			links := zipLinks(t, result.OutputPath)
+			resolve := func(name string) string {
+				if target, ok := links[name]; ok {
+					name = path.Join(path.Dir(name), target)
+				}
+				return entries[name]
+			}
+			want := map[string]string{
+				"src.zip/docs/a.txt":     "alpha",
+				"src.zip/docs/copy.txt":  "alpha",
+				"src.zip/docs/sub/b.txt": "bravo",
+				"src.tgz/docs/a.txt":     "alpha",
+				"src.tgz/docs/copy.txt":  "alpha",
+				"src.tgz/docs/sub/b.txt": "bravo",
+			}
+			if len(entries) != len(want) {
+				t.Errorf("archive holds %v, want %d entries", entries, len(want))
+			}
+			for name, data := range want {
+				if got := resolve(name); got != data {
+					t.Errorf("entry %s = %q, want %q", name, got, data)
+				}
+			}
+			if _, ok := entries["src.zip/other.bin"]; ok {
+				t.Error("unmatched entry was archived")
+			}
+		})
+	}
+}
+
+// zipLinks returns the targets of the symlink entries of the zip archive at
+// path by name.
+func zipLinks(t *testing.T, path string) map[string]string {
+	t.Helper()
+	reader, err := zip.OpenReader(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+
+	links := make(map[string]string)
+	for _, file := range reader.File {
+		if file.Mode()&fs.ModeSymlink == 0 {
+			continue
+		}
+		r, err := file.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		target, err := io.ReadAll(r)
+		r.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		links[file.Name] = string(target)
+	}
+	return links
+}
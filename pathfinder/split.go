@@ -0,0 +1,98 @@
+package pathfinder
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// volumePath returns the path of the given 1-based volume of the archive at
+// archivePath, e.g. "request.part2.zip" for "request.zip".
+func volumePath(archivePath string, volume int, format string) string {
+	stem, ext := splitArchiveExtension(archivePath, format)
+	return fmt.Sprintf("%s.part%d%s", stem, volume, ext)
+}
+
+// splitArchiveExtension separates the extension of the given format from
+// archivePath, keeping the one the name uses: a tgz archive may be named
+// ".tgz" or ".tar.gz". A name without it gets the default extension.
+func splitArchiveExtension(archivePath, format string) (stem, ext string) {
+	extensions := []string{archiveExtension(format)}
+	if format == "tgz" {
+		extensions = append(extensions, ".tgz")
+	}
+	for _, candidate := range extensions {
+		cut := len(archivePath) - len(candidate)
+		if cut > 0 && strings.EqualFold(archivePath[cut:], candidate) {
+			return archivePath[:cut], archivePath[cut:]
+		}
+	}
+	return archivePath, extensions[0]
+}
+
+// flusher is implemented by the archivers to push buffered output to the
+// underlying writer between entries.
+type flusher interface {
+	flush() error
+}
+
+// openVolume starts the next volume of a split archive.
+func (f *finder) openVolume() error {
+	path := volumePath(f.splitPath, len(f.result.Volumes)+1, f.cfg.Format)
+	if err := f.createZipArchive(path); err != nil {
+		return err
+	}
+	f.volumeFiles = 0
+	// Links cannot refer to entries in other volumes
+	f.contentNames = nil
+	f.result.Volumes = append(f.result.Volumes, path)
+	return nil
+}
+
+// prepareVolume makes room for a file of the given size in a split archive.
+// It finishes the current volume and opens the next one when the file would
+// push the volume past SplitSize. Volumes are split between files, so a file
+// larger than SplitSize gets a volume of its own that exceeds the limit.
+func (f *finder) prepareVolume(name string, size int64) error {
+	if f.cfg.SplitSize <= 0 {
+		return nil
+	}
+	// Push out what the archiver buffers so the volume's size is exact. A
+	// volume that failed to open is retried for the next file.
+	if f.archiver != nil {
+		if err := f.archiver.(flusher).flush(); err != nil {
+			return err
+		}
+	}
+	if f.archiver == nil || (f.volumeFiles > 0 && f.output.written+size > f.cfg.SplitSize) {
+		if err := f.closeResources(); err != nil {
+			return err
+		}
+		if err := f.openVolume(); err != nil {
+			return fmt.Errorf("error creating archive volume: %w", err)
+		}
+	}
+	if size > f.cfg.SplitSize {
+		fmt.Fprintf(f.cfg.ErrOutput, "Warning: %s is larger than the split size, its volume will exceed it\n", name)
+	}
+	f.volumeFiles++
+	return nil
+}
+
+// isVolume reports whether absPath is a volume of the split archive, or the
+// temporary file of one. It only looks at the name, so it is safe to call
+// while the pipeline's writer opens new volumes.
+func (f *finder) isVolume(absPath string) bool {
+	if f.cfg.SplitSize <= 0 {
+		return false
+	}
+	splitAbsPath, err := filepath.Abs(f.splitPath)
+	if err != nil {
+		return false
+	}
+	stem, _ := splitArchiveExtension(filepath.Base(splitAbsPath), f.cfg.Format)
+	stem += ".part"
+	base := filepath.Base(absPath)
+	return filepath.Dir(absPath) == filepath.Dir(splitAbsPath) &&
+		(strings.HasPrefix(base, stem) || strings.HasPrefix(base, "."+stem))
+}
@@ -0,0 +1,140 @@
+package pathfinder
+
+import (
+	"fmt"
+	"io"
+	"maps"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestSplitMixesStoredAndDeflatedEntries(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "src")
+	writeFile(t, filepath.Join(src, "b.txt"), "bravo bravo bravo")
+	writeFile(t, filepath.Join(src, "bb.jpg"), "not really a jpeg")
+	writeFile(t, filepath.Join(src, "c.txt"), "charlie")
+	writeFile(t, filepath.Join(src, "d.txt"), "charlie")
+	writeFile(t, filepath.Join(src, "e.txt"), "echo")
+	if err := os.Mkdir(filepath.Join(src, "empty"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("e.txt", filepath.Join(src, "link")); err != nil {
+		t.Skip("symlinks are not supported:", err)
+	}
+	writeFile(t, filepath.Join(dir, "list.txt"), "[directories]\n"+src+"\n")
+
+	cfg := DefaultConfig()
+	cfg.Directories = []string{dir}
+	cfg.ListFile = filepath.Join(dir, "list.txt")
+	cfg.OutputPath = filepath.Join(dir, "out")
+	cfg.CreateOutputDir = true
+	cfg.OutputName = "out.zip"
+	cfg.SplitSize = 1 << 20
+	cfg.StoreExtensions = []string{"jpg"}
+	cfg.IncludeEmptyDirs = true
+	cfg.PreserveSymlinks = true
+	cfg.DedupContent = true
+	cfg.Workers = 1
+	cfg.Output = io.Discard
+
+	result, err := Run(cfg)
+	if err != nil {
+		t.Fatalf("Run failed: %v (skipped %v)", err, result.Skipped)
+	}
+
+	entries := make(map[string]string)
+	for _, volume := range result.Volumes {
+		for name, content := range readZip(t, volume) {
+			entries[name] = content
+		}
+	}
+	want := map[string]string{
+		"src/b.txt":  "bravo bravo bravo",
+		"src/bb.jpg": "not really a jpeg",
+		"src/c.txt":  "charlie",
+		"src/d.txt":  "c.txt",
+		"src/e.txt":  "echo",
+		"src/empty/": "",
+		"src/link":   "e.txt",
+	}
+	if len(entries) != len(want) {
+		t.Errorf("volumes hold %v, want %v", entries, want)
+	}
+	for name, content := range want {
+		if got, ok := entries[name]; !ok || got != content {
+			t.Errorf("entry %s = %q, want %q", name, got, content)
+		}
+	}
+}
+
+func TestSplitProducesVolumes(t *testing.T) {
+	dir := t.TempDir()
+	content := make(map[string]string)
+	for i := 0; i < 6; i++ {
+		name := fmt.Sprintf("f%d.bin", i)
+		// Random content does not compress, so every file fills its volume
+		data := make([]byte, 600)
+		rand.New(rand.NewSource(int64(i))).Read(data)
+		content[name] = string(data)
+		writeFile(t, filepath.Join(dir, "src", name), string(data))
+	}
+	writeFile(t, filepath.Join(dir, "list.txt"), "[files]\n*.bin\n")
+
+	tests := []struct {
+		format, name string
+		want         []string
+	}{
+		{"zip", "out.zip", []string{"out.part1.zip", "out.part2.zip", "out.part3.zip"}},
+		{"tgz", "out.tgz", []string{"out.part1.tgz", "out.part2.tgz", "out.part3.tgz"}},
+		{"tgz", "out.tar.gz", []string{"out.part1.tar.gz", "out.part2.tar.gz", "out.part3.tar.gz"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cfg := DefaultConfig()
+			cfg.Directories = []string{filepath.Join(dir, "src")}
+			cfg.ListFile = filepath.Join(dir, "list.txt")
+			cfg.OutputPath = t.TempDir()
+			cfg.OutputName = test.name
+			cfg.Format = test.format
+			cfg.SplitSize = 1500
+			cfg.Workers = 1
+			cfg.Output = io.Discard
+
+			result, err := Run(cfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var names []string
+			for _, volume := range result.Volumes {
+				names = append(names, filepath.Base(volume))
+			}
+			if !slices.Equal(names, test.want) {
+				t.Fatalf("volumes = %v, want %v", names, test.want)
+			}
+
+			entries := make(map[string]string)
+			for _, volume := range result.Volumes {
+				info, err := os.Stat(volume)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if info.Size() > cfg.SplitSize {
+					t.Errorf("volume %s is %d bytes, more than %d", volume, info.Size(), cfg.SplitSize)
+				}
+				if test.format != "zip" {
+					continue
+				}
+				for name, data := range readZip(t, volume) {
+					entries[name] = data
+				}
+			}
+			if test.format == "zip" && !maps.Equal(entries, content) {
+				t.Errorf("volumes hold %d entries, want the %d files", len(entries), len(content))
+			}
+		})
+	}
+}
@@ -0,0 +1,71 @@
+package pathfinder
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"fmt"
+	"os"
+)
+
+// symlinker is implemented by the archivers to store a symlink found on disk
+// as a link entry, see Config.PreserveSymlinks.
+type symlinker interface {
+	addSymlink(name, target string, info os.FileInfo) error
+}
+
+// addSymlink stores name as a symbolic link to target the way Info-ZIP does:
+// the entry has the symlink mode and the target as its content. Links are
+// never compressed or encrypted.
+func (a *zipArchiver) addSymlink(name, target string, info os.FileInfo) error {
+	header := &zip.FileHeader{
+		Name:     name,
+		Method:   zip.Store,
+		Modified: info.ModTime(),
+	}
+	header.SetMode(os.ModeSymlink | 0o777)
+	a.compressor = nil
+
+	entry, err := a.writer.CreateHeader(header)
+	if err != nil {
+		return fmt.Errorf("failed to create entry in zip file: %w", err)
+	}
+	if _, err := entry.Write([]byte(target)); err != nil {
+		return fmt.Errorf("failed to write link to zip archive: %w", err)
+	}
+	return nil
+}
+
+// addSymlink stores name as a symbolic link to target.
+func (a *tarArchiver) addSymlink(name, target string, info os.FileInfo) error {
+	header, err := tar.FileInfoHeader(info, target)
+	if err != nil {
+		return fmt.Errorf("failed to create tar header: %w", err)
+	}
+	header.Name = name
+
+	if err := a.writer.WriteHeader(header); err != nil {
+		return fmt.Errorf("failed to write tar header: %w", err)
+	}
+	return nil
+}
+
+// preservesSymlinks reports whether symlinks on disk are stored as links
+// rather than skipped or followed.
+func (f *finder) preservesSymlinks() bool {
+	return f.cfg.PreserveSymlinks && !f.cfg.FollowSymlinks && f.fsys == nil
+}
+
+// prepareSymlink reads the target of the symlink described by info. The
+// target is the content of the entry, so it is also what gets hashed.
+func prepareSymlink(prepared preparedFile, info os.FileInfo) preparedFile {
+	target, err := os.Readlink(prepared.job.path)
+	if err != nil {
+		prepared.err = fmt.Errorf("failed to read symlink: %w", err)
+		return prepared
+	}
+	prepared.info = info
+	prepared.link = target
+	prepared.data = []byte(target)
+	prepared.hasher.Write(prepared.data)
+	return prepared
+}
@@ -0,0 +1,181 @@
+package pathfinder
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestSymlinkedFilesAreArchived(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "target", "real.txt"), "alpha")
+	writeFile(t, filepath.Join(dir, "elsewhere", "x.txt"), "x-ray")
+	if err := os.Mkdir(filepath.Join(dir, "src"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(filepath.Join(dir, "target", "real.txt"), filepath.Join(dir, "src", "link.txt")); err != nil {
+		t.Skip("symlinks are not supported:", err)
+	}
+	if err := os.Symlink(filepath.Join(dir, "elsewhere"), filepath.Join(dir, "src", "linkdir")); err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, filepath.Join(dir, "list.txt"), "[files]\nlink.txt\nx.txt\n")
+
+	tests := []struct {
+		follow bool
+		want   map[string]string
+	}{
+		// Without following, only the directory link is left alone
+		{false, map[string]string{"link.txt": "alpha"}},
+		{true, map[string]string{"link.txt": "alpha", "linkdir/x.txt": "x-ray"}},
+	}
+	for _, test := range tests {
+		cfg := DefaultConfig()
+		cfg.Directories = []string{filepath.Join(dir, "src")}
+		cfg.ListFile = filepath.Join(dir, "list.txt")
+		cfg.OutputPath = dir
+		cfg.OutputName = "out.zip"
+		cfg.Force = true
+		cfg.FollowSymlinks = test.follow
+		cfg.Output = io.Discard
+
+		result, err := Run(cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		entries := readZip(t, result.OutputPath)
+		if len(entries) != len(test.want) {
+			t.Errorf("following %v: archive holds %v, want %v", test.follow, entries, test.want)
+		}
+		for name, content := range test.want {
+			if entries[name] != content {
+				t.Errorf("following %v: entry %s = %q, want %q", test.follow, name, entries[name], content)
+			}
+		}
+	}
+}
+
+func TestOutputThroughSymlinkIsExcluded(t *testing.T) {
+	dir := t.TempDir()
+	out := filepath.Join(dir, "out")
+	writeFile(t, filepath.Join(dir, "src", "a.txt"), "alpha")
+	writeFile(t, filepath.Join(out, "keep.txt"), "keep")
+	// An archive from an earlier run, about to be replaced
+	writeFile(t, filepath.Join(out, "backup.zip"), "old archive")
+	if err := os.Symlink(out, filepath.Join(dir, "src", "link")); err != nil {
+		t.Skip("symlinks are not supported:", err)
+	}
+	writeFile(t, filepath.Join(dir, "list.txt"), "[files]\n*\n")
+
+	var skipped []string
+	cfg := DefaultConfig()
+	cfg.Directories = []string{filepath.Join(dir, "src")}
+	cfg.ListFile = filepath.Join(dir, "list.txt")
+	cfg.OutputPath = out
+	cfg.OutputName = "backup.zip"
+	cfg.Force = true
+	cfg.FollowSymlinks = true
+	cfg.Workers = 1
+	cfg.OnSkip = func(path, reason string) {
+		if reason == "output archive" {
+			skipped = append(skipped, filepath.Base(path))
+		}
+	}
+	cfg.Output = io.Discard
+
+	result, err := Run(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries := readZip(t, result.OutputPath)
+	if len(entries) != 2 || entries["a.txt"] != "alpha" || entries["link/keep.txt"] != "keep" {
+		t.Errorf("archive holds %v, want a.txt and link/keep.txt", entries)
+	}
+	// Both the archive being written, under its temporary name, and the one
+	// it replaces are found through the link
+	slices.Sort(skipped)
+	if len(skipped) != 2 || !strings.HasPrefix(skipped[0], ".backup.zip.tmp-") || skipped[1] != "backup.zip" {
+		t.Errorf("skipped %q as the output archive, want its temporary file and backup.zip", skipped)
+	}
+}
+
+func TestPreserveSymlinks(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "src", "real.txt"), "alpha")
+	writeFile(t, filepath.Join(dir, "elsewhere", "x.txt"), "x-ray")
+	if err := os.Symlink("real.txt", filepath.Join(dir, "src", "link.txt")); err != nil {
+		t.Skip("symlinks are not supported:", err)
+	}
+	if err := os.Symlink(filepath.Join("..", "elsewhere"), filepath.Join(dir, "src", "dirlink")); err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, filepath.Join(dir, "list.txt"), "[files]\n*\n")
+
+	run := func(format string, follow bool) string {
+		t.Helper()
+		cfg := DefaultConfig()
+		cfg.Directories = []string{filepath.Join(dir, "src")}
+		cfg.ListFile = filepath.Join(dir, "list.txt")
+		cfg.OutputPath = dir
+		cfg.OutputName = "out." + format
+		cfg.Format = format
+		cfg.Force = true
+		cfg.PreserveSymlinks = true
+		cfg.FollowSymlinks = follow
+		cfg.Output = io.Discard
+		result, err := Run(cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return result.OutputPath
+	}
+
+	// Links keep their target, relative or not, as their content
+	wantLinks := map[string]string{"link.txt": "real.txt", "dirlink": filepath.Join("..", "elsewhere")}
+	reader, err := zip.OpenReader(run("zip", false))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+	if len(reader.File) != 3 {
+		t.Errorf("zip holds %d entries, want real.txt and two links", len(reader.File))
+	}
+	for _, file := range reader.File {
+		target, isLink := wantLinks[file.Name]
+		if got := file.Mode()&fs.ModeSymlink != 0; got != isLink {
+			t.Errorf("zip entry %s is a link: %v, want %v", file.Name, got, isLink)
+		}
+		rc, err := file.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		content, err := io.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if isLink && string(content) != target {
+			t.Errorf("zip link %s points to %q, want %q", file.Name, content, target)
+		}
+	}
+
+	_, headers := readTgz(t, run("tgz", false))
+	for name, target := range wantLinks {
+		header := headers[name]
+		if header == nil || header.Typeflag != tar.TypeSymlink || header.Linkname != target {
+			t.Errorf("tar entry %s = %+v, want a link to %q", name, header, target)
+		}
+	}
+
+	// Following links wins, so the targets are archived instead
+	entries := readZip(t, run("zip", true))
+	if entries["link.txt"] != "alpha" || entries["dirlink/x.txt"] != "x-ray" {
+		t.Errorf("following links: archive holds %v, want the targets' content", entries)
+	}
+}
@@ -0,0 +1,233 @@
+package pathfinder
+
+import (
+	"archive/tar"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+// tarFS is a read-only fs.FS over the entries of a tar archive. Only the
+// headers and the offsets of the entries are held in memory; their content
+// is read from the archive when they are opened. Directories missing from
+// the archive are filled in from the file names.
+type tarFS struct {
+	entries map[string]*tarEntry
+	archive io.ReaderAt
+}
+
+// tarSource is a tar archive that is read through once to index it, and
+// then at random to read the entries.
+type tarSource interface {
+	io.ReadSeeker
+	io.ReaderAt
+}
+
+// tarEntry is a file or directory of a tarFS.
+type tarEntry struct {
+	info fs.FileInfo
+	// offset and size locate the content in the archive. Sparse files are
+	// not stored in one piece, so their content is kept in data instead.
+	offset int64
+	size   int64
+	data   []byte
+	// children holds the names of a directory's entries, sorted.
+	children []string
+}
+
+// readTarFS indexes the tar archive r. Regular files, directories and
+// symlinks are kept; hard links get the content of their target.
+func readTarFS(r tarSource) (*tarFS, error) {
+	fsys := &tarFS{
+		entries: map[string]*tarEntry{".": {info: syntheticDirInfo{name: "."}}},
+		archive: r,
+	}
+
+	// The reader does not buffer, so after each header the position in r is
+	// where the entry's content starts
+	reader := tar.NewReader(r)
+	for {
+		header, err := reader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		name := path.Clean(strings.TrimPrefix(header.Name, "/"))
+		if name == "." || !fs.ValidPath(name) {
+			continue
+		}
+
+		switch header.Typeflag {
+		case tar.TypeDir:
+			fsys.addDir(name, header.FileInfo())
+		case tar.TypeSymlink:
+			fsys.add(name, &tarEntry{info: header.FileInfo()})
+		case tar.TypeReg, tar.TypeGNUSparse:
+			entry := &tarEntry{info: header.FileInfo(), size: header.Size}
+			if isSparse(header) {
+				if entry.data, err = io.ReadAll(reader); err != nil {
+					return nil, fmt.Errorf("failed to read %s: %w", header.Name, err)
+				}
+			} else if entry.offset, err = r.Seek(0, io.SeekCurrent); err != nil {
+				return nil, err
+			}
+			fsys.add(name, entry)
+		case tar.TypeLink:
+			target, ok := fsys.entries[path.Clean(header.Linkname)]
+			if !ok {
+				continue
+			}
+			linked := *header
+			linked.Typeflag = tar.TypeReg
+			linked.Size = target.size
+			fsys.add(name, &tarEntry{info: linked.FileInfo(), offset: target.offset, size: target.size, data: target.data})
+		}
+	}
+
+	for _, entry := range fsys.entries {
+		sort.Strings(entry.children)
+	}
+	return fsys, nil
+}
+
+// isSparse reports whether header describes a sparse file, in the GNU or
+// the PAX format.
+func isSparse(header *tar.Header) bool {
+	if header.Typeflag == tar.TypeGNUSparse {
+		return true
+	}
+	for key := range header.PAXRecords {
+		if strings.HasPrefix(key, "GNU.sparse.") {
+			return true
+		}
+	}
+	return false
+}
+
+// add stores entry under name, creating its parent directories.
+func (t *tarFS) add(name string, entry *tarEntry) {
+	if _, exists := t.entries[name]; !exists {
+		parent := t.addDir(path.Dir(name), nil)
+		parent.children = append(parent.children, path.Base(name))
+	}
+	t.entries[name] = entry
+}
+
+// addDir returns the directory name, creating it and its parents if needed.
+// info replaces the directory's info when not nil.
+func (t *tarFS) addDir(name string, info fs.FileInfo) *tarEntry {
+	dir, ok := t.entries[name]
+	if !ok {
+		dir = &tarEntry{info: syntheticDirInfo{name: path.Base(name)}}
+		parent := t.addDir(path.Dir(name), nil)
+		parent.children = append(parent.children, path.Base(name))
+		t.entries[name] = dir
+	}
+	if info != nil {
+		dir.info = info
+	}
+	return dir
+}
+
+func (t *tarFS) Open(name string) (fs.File, error) {
+	entry, err := t.lookup("open", name)
+	if err != nil {
+		return nil, err
+	}
+	reader := io.NewSectionReader(t.archive, entry.offset, entry.size)
+	if entry.data != nil {
+		reader = io.NewSectionReader(bytes.NewReader(entry.data), 0, int64(len(entry.data)))
+	}
+	return &tarFile{fsys: t, name: name, entry: entry, reader: reader}, nil
+}
+
+func (t *tarFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	entry, err := t.lookup("readdir", name)
+	if err != nil {
+		return nil, err
+	}
+	if !entry.info.IsDir() {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: errors.New("not a directory")}
+	}
+	return t.dirEntries(name, entry.children), nil
+}
+
+func (t *tarFS) Stat(name string) (fs.FileInfo, error) {
+	entry, err := t.lookup("stat", name)
+	if err != nil {
+		return nil, err
+	}
+	return entry.info, nil
+}
+
+func (t *tarFS) lookup(op, name string) (*tarEntry, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	}
+	entry, ok := t.entries[name]
+	if !ok {
+		return nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrNotExist}
+	}
+	return entry, nil
+}
+
+// dirEntries returns the entries of the directory dir with the given
+// children.
+func (t *tarFS) dirEntries(dir string, children []string) []fs.DirEntry {
+	entries := make([]fs.DirEntry, len(children))
+	for i, child := range children {
+		entries[i] = fs.FileInfoToDirEntry(t.entries[path.Join(dir, child)].info)
+	}
+	return entries
+}
+
+// tarFile is an open file or directory of a tarFS.
+type tarFile struct {
+	fsys   *tarFS
+	name   string
+	entry  *tarEntry
+	reader *io.SectionReader
+	// read counts the directory entries returned by ReadDir so far.
+	read int
+}
+
+func (f *tarFile) Stat() (fs.FileInfo, error) { return f.entry.info, nil }
+func (f *tarFile) Read(p []byte) (int, error) { return f.reader.Read(p) }
+func (f *tarFile) Close() error               { return nil }
+
+func (f *tarFile) ReadDir(n int) ([]fs.DirEntry, error) {
+	if !f.entry.info.IsDir() {
+		return nil, &fs.PathError{Op: "readdir", Path: f.name, Err: errors.New("not a directory")}
+	}
+	children := f.entry.children[f.read:]
+	if n > 0 && len(children) > n {
+		children = children[:n]
+	}
+	f.read += len(children)
+	if n > 0 && len(children) == 0 {
+		return nil, io.EOF
+	}
+	return f.fsys.dirEntries(f.name, children), nil
+}
+
+// syntheticDirInfo describes a directory that has no entry of its own in
+// the archive.
+type syntheticDirInfo struct {
+	name string
+}
+
+func (i syntheticDirInfo) Name() string       { return i.name }
+func (i syntheticDirInfo) Size() int64        { return 0 }
+func (i syntheticDirInfo) Mode() fs.FileMode  { return fs.ModeDir | 0o755 }
+func (i syntheticDirInfo) ModTime() time.Time { return time.Time{} }
+func (i syntheticDirInfo) IsDir() bool        { return true }
+func (i syntheticDirInfo) Sys() any           { return nil }
@@ -0,0 +1,66 @@
+package pathfinder
+
+import (
+	"os"
+	"os/user"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// countPlaceholder is the output template placeholder for the number of
+// archived files, which is only known once the files have been written.
+const countPlaceholder = "{count}"
+
+// expandOutputTemplate fills in the placeholders of an output name template:
+// {date} and {time} for the current local date and time, {host} for the
+// host name, {user} for the current user and {count} for the number of
+// archived files. A negative count leaves {count} in place. The archive
+// extension is appended unless the template already ends in it.
+func expandOutputTemplate(template, format string, now time.Time, count int) string {
+	replacements := []string{
+		"{date}", now.Format("2006-01-02"),
+		"{time}", now.Format("15-04-05"),
+		"{host}", sanitizeNamePart(hostName()),
+		"{user}", sanitizeNamePart(userName()),
+	}
+	if count >= 0 {
+		replacements = append(replacements, countPlaceholder, strconv.Itoa(count))
+	}
+	name := strings.NewReplacer(replacements...).Replace(template)
+
+	if ext := archiveExtension(format); !strings.HasSuffix(name, ext) {
+		name += ext
+	}
+	return name
+}
+
+// hostName returns the host name, or "unknown" when it cannot be determined.
+func hostName() string {
+	host, err := os.Hostname()
+	if err != nil {
+		return "unknown"
+	}
+	return host
+}
+
+// userName returns the name of the current user, or "unknown" when it cannot
+// be determined.
+func userName() string {
+	if current, err := user.Current(); err == nil {
+		return current.Username
+	}
+	return "unknown"
+}
+
+// sanitizeNamePart replaces the characters of s that cannot appear in a file
+// name, such as the "\" of a Windows DOMAIN\user name.
+func sanitizeNamePart(s string) string {
+	return strings.Map(func(r rune) rune {
+		switch r {
+		case '/', '\\', ':', '*', '?', '"', '<', '>', '|':
+			return '_'
+		}
+		return r
+	}, s)
+}
@@ -0,0 +1,74 @@
+package pathfinder
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestExpandOutputTemplate(t *testing.T) {
+	host, err := os.Hostname()
+	if err != nil {
+		t.Skip("host name unavailable:", err)
+	}
+	now := time.Date(2024, time.March, 5, 6, 7, 8, 0, time.Local)
+
+	tests := []struct {
+		template, format string
+		count            int
+		want             string
+	}{
+		{"backup-{host}-{date}", "zip", -1, "backup-" + sanitizeNamePart(host) + "-2024-03-05.zip"},
+		{"{date}_{time}", "zip", -1, "2024-03-05_06-07-08.zip"},
+		{"{user}.zip", "zip", -1, sanitizeNamePart(userName()) + ".zip"},
+		{"files-{count}", "tgz", 12, "files-12.tar.gz"},
+		// The count is not known yet
+		{"files-{count}", "zip", -1, "files-{count}.zip"},
+		{"plain", "zip", 3, "plain.zip"},
+	}
+	for _, test := range tests {
+		if got := expandOutputTemplate(test.template, test.format, now, test.count); got != test.want {
+			t.Errorf("expandOutputTemplate(%q, %q, %d) = %q, want %q", test.template, test.format, test.count, got, test.want)
+		}
+	}
+}
+
+func TestSanitizeNamePart(t *testing.T) {
+	if got, want := sanitizeNamePart(`DOMAIN\user:a/b`), "DOMAIN_user_a_b"; got != want {
+		t.Errorf("sanitizeNamePart = %q, want %q", got, want)
+	}
+}
+
+func TestOutputTemplateCount(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "src", "a.txt"), "alpha")
+	writeFile(t, filepath.Join(dir, "src", "b.txt"), "bravo")
+	writeFile(t, filepath.Join(dir, "list.txt"), "[files]\n*.txt\n")
+
+	cfg := DefaultConfig()
+	cfg.Directories = []string{filepath.Join(dir, "src")}
+	cfg.ListFile = filepath.Join(dir, "list.txt")
+	cfg.OutputPath = dir
+	cfg.OutputTemplate = "backup-{count}"
+	cfg.Output = io.Discard
+
+	result, err := Run(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := filepath.Join(dir, "backup-2.zip"); result.OutputPath != want {
+		t.Errorf("archive written to %s, want %s", result.OutputPath, want)
+	}
+	if got := readZip(t, filepath.Join(dir, "backup-2.zip")); len(got) != 2 {
+		t.Errorf("archive holds %d entries, want 2", len(got))
+	}
+
+	// The name must be known up front to append to it
+	cfg.Append = true
+	if _, err := Run(cfg); err == nil || !strings.Contains(err.Error(), "{count}") {
+		t.Errorf("appending with {count} in the template: error %v, want one naming {count}", err)
+	}
+}
@@ -0,0 +1,158 @@
+package pathfinder
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/flate"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// ErrVerifyFailed is returned by Run when Verify found problems with the
+// written archive. Result.VerifyProblems describes them.
+var ErrVerifyFailed = errors.New("archive verification failed")
+
+// verifyArchive reopens the written archive, or each of its volumes, reads
+// every entry in full and checks that every [files] entry is present.
+// It returns the problems found.
+func (f *finder) verifyArchive(paths []string) []string {
+	var problems []string
+	var names []string
+	for _, archivePath := range paths {
+		var volumeNames, volumeProblems []string
+		if f.cfg.Format == "zip" {
+			volumeNames, volumeProblems = verifyZip(archivePath)
+		} else {
+			volumeNames, volumeProblems = verifyTar(archivePath, f.cfg.Format == "tgz")
+		}
+		names = append(names, volumeNames...)
+		problems = append(problems, volumeProblems...)
+	}
+
+	// Every requested name has to appear as the base name of an entry
+	for _, pattern := range f.fileNames {
+		if strings.HasPrefix(pattern, "!") {
+			continue
+		}
+		found := false
+		for _, name := range names {
+			if strings.HasSuffix(name, "/") {
+				continue
+			}
+			if matched, _ := filepath.Match(f.fold(pattern), f.fold(path.Base(name))); matched {
+				found = true
+				break
+			}
+		}
+		if !found {
+			problems = append(problems, fmt.Sprintf("requested file %s is not in the archive", pattern))
+		}
+	}
+	return problems
+}
+
+// verifyZip recomputes the CRC-32 of every entry of the zip archive at
+// archivePath and returns the entry names and the entries that could not be
+// read or whose content does not match the stored checksum. Encrypted
+// entries are only checked for presence.
+func verifyZip(archivePath string) (names, problems []string) {
+	reader, err := zip.OpenReader(archivePath)
+	if err != nil {
+		return nil, []string{fmt.Sprintf("%s: %v", archivePath, err)}
+	}
+	defer reader.Close()
+
+	for _, file := range reader.File {
+		names = append(names, file.Name)
+		if file.Method == aesMethod {
+			continue
+		}
+		if err := checkEntry(file); err != nil {
+			problems = append(problems, fmt.Sprintf("%s: %v", file.Name, err))
+		}
+	}
+	return names, problems
+}
+
+// checkEntry decompresses a zip entry and compares the CRC-32 and size of
+// its content with the ones stored in the archive.
+func checkEntry(file *zip.File) error {
+	raw, err := file.OpenRaw()
+	if err != nil {
+		return err
+	}
+
+	var r io.Reader
+	switch file.Method {
+	case zip.Store:
+		r = raw
+	case zip.Deflate:
+		decompressor := flate.NewReader(raw)
+		defer decompressor.Close()
+		r = decompressor
+	default:
+		return fmt.Errorf("unsupported compression method %d", file.Method)
+	}
+
+	hash := crc32.NewIEEE()
+	size, err := io.Copy(hash, r)
+	if err != nil {
+		return err
+	}
+	if crc := hash.Sum32(); crc != file.CRC32 {
+		return fmt.Errorf("CRC-32 mismatch: stored %08x, computed %08x", file.CRC32, crc)
+	}
+	if uint64(size) != file.UncompressedSize64 {
+		return fmt.Errorf("size mismatch: stored %d bytes, read %d", file.UncompressedSize64, size)
+	}
+	return nil
+}
+
+// verifyTar reads the tar archive at archivePath to its end, which checks
+// the gzip checksum of compressed archives, and returns the entry names.
+// Tar has no checksum of its own for file contents, and a damaged archive
+// cannot be read past the damage, so the first problem ends the check.
+func verifyTar(archivePath string, compressed bool) (names, problems []string) {
+	file, err := os.Open(archivePath)
+	if err != nil {
+		return nil, []string{fmt.Sprintf("%s: %v", archivePath, err)}
+	}
+	defer file.Close()
+
+	var r io.Reader = file
+	if compressed {
+		gzipReader, err := gzip.NewReader(file)
+		if err != nil {
+			return nil, []string{fmt.Sprintf("%s: %v", archivePath, err)}
+		}
+		defer gzipReader.Close()
+		r = gzipReader
+	}
+
+	reader := tar.NewReader(r)
+	for {
+		header, err := reader.Next()
+		if err == io.EOF {
+			// Read on past the end of the tar stream, so that gzip
+			// checks its trailer
+			if _, err := io.Copy(io.Discard, r); err != nil {
+				return names, []string{fmt.Sprintf("%s: %v", archivePath, err)}
+			}
+			return names, nil
+		}
+		if err != nil {
+			return names, []string{fmt.Sprintf("%s: %v", archivePath, err)}
+		}
+		names = append(names, header.Name)
+		if _, err := io.Copy(io.Discard, reader); err != nil {
+			return names, []string{fmt.Sprintf("%s: %v", header.Name, err)}
+		}
+	}
+}
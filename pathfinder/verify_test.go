@@ -0,0 +1,95 @@
+package pathfinder
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestVerifyZipReportsCorruptEntry(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "src", "a.txt"), "alpha alpha alpha")
+	writeFile(t, filepath.Join(dir, "src", "b.txt"), "bravo bravo bravo")
+	writeFile(t, filepath.Join(dir, "list.txt"), "[files]\n*.txt\n")
+
+	cfg := DefaultConfig()
+	cfg.Directories = []string{filepath.Join(dir, "src")}
+	cfg.ListFile = filepath.Join(dir, "list.txt")
+	cfg.OutputPath = dir
+	cfg.OutputName = "out.zip"
+	cfg.Level = 0
+	cfg.Workers = 1
+	cfg.Output = io.Discard
+
+	result, err := Run(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	names, problems := verifyZip(result.OutputPath)
+	sort.Strings(names)
+	if want := []string{"a.txt", "b.txt"}; !slices.Equal(names, want) {
+		t.Errorf("verified entries %v, want %v", names, want)
+	}
+	if len(problems) > 0 {
+		t.Fatalf("intact archive has problems: %v", problems)
+	}
+
+	// Stored entries hold their content as is, so it can be found and
+	// damaged without touching the headers
+	data, err := os.ReadFile(result.OutputPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	offset := bytes.Index(data, []byte("bravo bravo bravo"))
+	if offset < 0 {
+		t.Fatal("content of b.txt not found in the archive")
+	}
+	data[offset] ^= 0xff
+	if err := os.WriteFile(result.OutputPath, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	_, problems = verifyZip(result.OutputPath)
+	if len(problems) != 1 || !strings.HasPrefix(problems[0], "b.txt: ") || !strings.Contains(problems[0], "CRC-32 mismatch") {
+		t.Errorf("problems %q, want a CRC-32 mismatch of b.txt", problems)
+	}
+}
+
+func TestVerifyReportsMissingRequestedFile(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "src", "a.txt"), "alpha")
+	writeFile(t, filepath.Join(dir, "src", "sub", "b.log"), "bravo")
+
+	for _, format := range []string{"zip", "tgz"} {
+		writeFile(t, filepath.Join(dir, "list.txt"), "[files]\na.txt\n*.log\n!*.tmp\n")
+		cfg := DefaultConfig()
+		cfg.Directories = []string{filepath.Join(dir, "src")}
+		cfg.ListFile = filepath.Join(dir, "list.txt")
+		cfg.OutputPath = dir
+		cfg.OutputName = "complete." + format
+		cfg.Format = format
+		cfg.Verify = true
+		cfg.Output = io.Discard
+
+		result, err := Run(cfg)
+		if err != nil || len(result.VerifyProblems) > 0 {
+			t.Errorf("%s: complete archive failed verification: %v, %q", format, err, result.VerifyProblems)
+		}
+
+		writeFile(t, filepath.Join(dir, "list.txt"), "[files]\na.txt\ngone.txt\n")
+		cfg.OutputName = "incomplete." + format
+		result, err = Run(cfg)
+		if !errors.Is(err, ErrVerifyFailed) {
+			t.Errorf("%s: Run returned %v, want %v", format, err, ErrVerifyFailed)
+		}
+		if want := []string{"requested file gone.txt is not in the archive"}; !slices.Equal(result.VerifyProblems, want) {
+			t.Errorf("%s: problems %q, want %q", format, result.VerifyProblems, want)
+		}
+	}
+}
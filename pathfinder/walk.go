@@ -0,0 +1,127 @@
+package pathfinder
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// walk calls fn for every file and directory under root like
+// filepath.WalkDir, so entries are only stat'ed when their info is needed.
+// Symlinked files are reported with their target's info, or as they are
+// with PreserveSymlinks. Symlinked directories are skipped unless
+// FollowSymlinks is set, in which case they are descended into under the
+// link's path. Every directory, identified by its device and inode where the
+// platform provides them, is entered at most once per walk, so symlink cycles
+// terminate. Devices, sockets and named pipes are skipped, as reading them
+// may block or never end. File system sources are walked with walkFS
+// instead.
+func (f *finder) walk(root string, fn fs.WalkDirFunc) error {
+	if f.fsys != nil {
+		return f.walkFS(root, fn)
+	}
+	return f.walkTree(root, make(map[string]struct{}), fn)
+}
+
+func (f *finder) walkTree(root string, visited map[string]struct{}, fn fs.WalkDirFunc) error {
+	return filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return fn(path, d, err)
+		}
+
+		if d.Type()&fs.ModeSymlink != 0 {
+			return f.walkSymlink(path, d, visited, fn)
+		}
+		if f.special(path, d.Type()) {
+			return nil
+		}
+
+		if d.IsDir() && f.cfg.FollowSymlinks {
+			info, err := d.Info()
+			if err != nil {
+				return fn(path, d, err)
+			}
+			key, err := dirKey(path, info)
+			if err != nil {
+				return fn(path, d, err)
+			}
+			if _, ok := visited[key]; ok {
+				if f.cfg.Verbose {
+					fmt.Fprintf(f.cfg.Output, "Skipping already visited directory: %s\n", path)
+				}
+				return filepath.SkipDir
+			}
+			visited[key] = struct{}{}
+		}
+
+		return fn(path, d, nil)
+	})
+}
+
+// walkSymlink handles a symlink found during a walk.
+func (f *finder) walkSymlink(path string, d fs.DirEntry, visited map[string]struct{}, fn fs.WalkDirFunc) error {
+	if f.cfg.PreserveSymlinks && !f.cfg.FollowSymlinks {
+		return fn(path, d, nil)
+	}
+
+	// os.Stat follows the link but keeps the link's name
+	target, err := os.Stat(path)
+	if err != nil {
+		if !f.cfg.FollowSymlinks {
+			// A broken link only matters when links are followed
+			if f.cfg.Verbose {
+				fmt.Fprintf(f.cfg.Output, "Skipping broken symlink: %s\n", path)
+			}
+			return nil
+		}
+		return fn(path, d, err)
+	}
+	if !target.IsDir() {
+		if f.special(path, target.Mode()) {
+			return nil
+		}
+		return fn(path, fs.FileInfoToDirEntry(target), nil)
+	}
+	if !f.cfg.FollowSymlinks {
+		if f.cfg.Verbose {
+			fmt.Fprintf(f.cfg.Output, "Skipping symlinked directory: %s\n", path)
+		}
+		return nil
+	}
+
+	key, err := dirKey(path, target)
+	if err != nil {
+		return fn(path, d, err)
+	}
+	if _, ok := visited[key]; ok {
+		if f.cfg.Verbose {
+			fmt.Fprintf(f.cfg.Output, "Skipping symlink to already visited directory: %s\n", path)
+		}
+		return nil
+	}
+
+	realPath, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return fn(path, d, err)
+	}
+
+	// Walk the link target, reporting its entries under the link's path
+	return f.walkTree(realPath, visited, func(subPath string, subEntry fs.DirEntry, subErr error) error {
+		return fn(path+strings.TrimPrefix(subPath, realPath), subEntry, subErr)
+	})
+}
+
+// special reports whether mode describes a file other than a regular file,
+// directory or symlink, such as a device, socket or named pipe, noting it
+// when verbose.
+func (f *finder) special(path string, mode fs.FileMode) bool {
+	if mode.IsRegular() || mode.IsDir() || mode&fs.ModeSymlink != 0 {
+		return false
+	}
+	if f.cfg.Verbose {
+		fmt.Fprintf(f.cfg.Output, "Skipping special file: %s\n", path)
+	}
+	return true
+}
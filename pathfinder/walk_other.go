@@ -0,0 +1,14 @@
+//go:build !unix
+
+package pathfinder
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// dirKey identifies the directory at path by its resolved real path, since
+// device and inode numbers are not available on this platform.
+func dirKey(path string, info os.FileInfo) (string, error) {
+	return filepath.EvalSymlinks(path)
+}
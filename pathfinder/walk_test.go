@@ -0,0 +1,225 @@
+package pathfinder
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+// walkPaths returns the paths f.walk reports under root, checking that the
+// info of each matches what os.Stat, or os.Lstat for preserved links, says.
+func walkPaths(t *testing.T, f *finder, root string) []string {
+	t.Helper()
+	var paths []string
+	err := f.walk(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		stat := os.Stat
+		if f.cfg.PreserveSymlinks {
+			stat = os.Lstat
+		}
+		want, err := stat(path)
+		if err != nil {
+			return err
+		}
+		if info.Mode() != want.Mode() || (!info.IsDir() && info.Size() != want.Size()) {
+			t.Errorf("%s: info %v %d, want %v %d", path, info.Mode(), info.Size(), want.Mode(), want.Size())
+		}
+		paths = append(paths, path)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return paths
+}
+
+func TestWalkMatchesFilepathWalk(t *testing.T) {
+	root := t.TempDir()
+	writeFile(t, filepath.Join(root, "a.txt"), "alpha")
+	writeFile(t, filepath.Join(root, "sub", "b.txt"), "bravo")
+	writeFile(t, filepath.Join(root, "sub", "deep", "c.txt"), "charlie")
+	writeFile(t, filepath.Join(root, "other", "d.txt"), "delta")
+	if err := os.Symlink(filepath.Join(root, "a.txt"), filepath.Join(root, "file-link")); err != nil {
+		t.Skip("symlinks are not supported:", err)
+	}
+	if err := os.Symlink(filepath.Join(root, "other"), filepath.Join(root, "sub", "dir-link")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(root, filepath.Join(root, "other", "cycle")); err != nil {
+		t.Fatal(err)
+	}
+
+	// The reference listing stats every entry as the walk used to. Links to
+	// files are reported like the files, links to directories are skipped.
+	var all, fileLinks []string
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		all = append(all, path)
+		if target, err := os.Stat(path); err == nil && !(info.Mode()&fs.ModeSymlink != 0 && target.IsDir()) {
+			fileLinks = append(fileLinks, path)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := DefaultConfig()
+	if got := walkPaths(t, &finder{ctx: context.Background(), cfg: cfg}, root); !slices.Equal(got, fileLinks) {
+		t.Errorf("walk not following symlinks = %v, want %v", got, fileLinks)
+	}
+
+	cfg.PreserveSymlinks = true
+	if got := walkPaths(t, &finder{ctx: context.Background(), cfg: cfg}, root); !slices.Equal(got, all) {
+		t.Errorf("walk preserving symlinks = %v, want %v", got, all)
+	}
+
+	// Followed links are reported under their own path; the cycle back to
+	// the root and the second way into "other" are not entered again
+	cfg.PreserveSymlinks = false
+	cfg.FollowSymlinks = true
+	want := []string{
+		root,
+		filepath.Join(root, "a.txt"),
+		filepath.Join(root, "file-link"),
+		filepath.Join(root, "other"),
+		filepath.Join(root, "other", "d.txt"),
+		filepath.Join(root, "sub"),
+		filepath.Join(root, "sub", "b.txt"),
+		filepath.Join(root, "sub", "deep"),
+		filepath.Join(root, "sub", "deep", "c.txt"),
+	}
+	if got := walkPaths(t, &finder{ctx: context.Background(), cfg: cfg}, root); !slices.Equal(got, want) {
+		t.Errorf("walk following symlinks = %v, want %v", got, want)
+	}
+}
+
+func BenchmarkWalk(b *testing.B) {
+	root := b.TempDir()
+	for i := 0; i < 1000; i++ {
+		path := filepath.Join(root, fmt.Sprintf("d%02d", i%20), fmt.Sprintf("f%03d.txt", i))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			b.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte("content"), 0o644); err != nil {
+			b.Fatal(err)
+		}
+	}
+	visit := func(string, fs.DirEntry, error) error { return nil }
+
+	b.Run("filepath.Walk", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			if err := filepath.Walk(root, func(string, os.FileInfo, error) error { return nil }); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("walk", func(b *testing.B) {
+		f := &finder{ctx: context.Background(), cfg: DefaultConfig()}
+		for i := 0; i < b.N; i++ {
+			if err := f.walk(root, visit); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	// A size filter stats every file again, as the old walk did up front
+	b.Run("walk+stat", func(b *testing.B) {
+		f := &finder{ctx: context.Background(), cfg: DefaultConfig()}
+		f.cfg.MinSize = 1
+		for i := 0; i < b.N; i++ {
+			err := f.walk(root, func(path string, d fs.DirEntry, err error) error {
+				if err == nil && !d.IsDir() {
+					f.passesFilters(d)
+				}
+				return err
+			})
+			if err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+func TestSymlinkLoopTerminates(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "src")
+	writeFile(t, filepath.Join(src, "a", "x.txt"), "x-ray")
+	writeFile(t, filepath.Join(src, "a", "b", "y.txt"), "yankee")
+	if err := os.Symlink(filepath.Join(src, "a"), filepath.Join(src, "a", "b", "up")); err != nil {
+		t.Skip("symlinks are not supported:", err)
+	}
+	if err := os.Symlink(".", filepath.Join(src, "a", "self")); err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, filepath.Join(dir, "list.txt"), "[files]\n*.txt\n")
+
+	var output bytes.Buffer
+	cfg := DefaultConfig()
+	cfg.Directories = []string{src}
+	cfg.ListFile = filepath.Join(dir, "list.txt")
+	cfg.FollowSymlinks = true
+	cfg.Verbose = true
+	cfg.Output = &output
+
+	// Each file is found once, under its real path
+	if got, want := matchNames(t, cfg, src), []string{"a/b/y.txt", "a/x.txt"}; !slices.Equal(got, want) {
+		t.Errorf("matched %v, want %v", got, want)
+	}
+	if n := strings.Count(output.String(), "Skipping symlink to already visited directory"); n != 2 {
+		t.Errorf("%d loops reported, want 2:\n%s", n, &output)
+	}
+}
+
+func TestMatchInMemoryFS(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.FS = fstest.MapFS{
+		"a.txt":              {Data: []byte("alpha")},
+		"conf/b.ini":         {Data: []byte("bravo")},
+		"conf/c.ini":         {Data: []byte("charlie")},
+		"logs/2024/d.log":    {Data: []byte("delta")},
+		"logs/2024/skip.tmp": {Data: []byte("scratch")},
+		"docs/a.txt":         {Data: []byte("another alpha")},
+		"other.md":           {Data: []byte("other")},
+	}
+	cfg.Directories = []string{"."}
+	cfg.ListFile = "-"
+	cfg.Output = io.Discard
+
+	var got []string
+	sizes := make(map[string]int64)
+	withStdin(t, "[files]\na.txt\n[paths]\nconf/b.ini\n[directories]\nlogs\n[exclude]\n*.tmp\n", func() {
+		results, errs := Matches(context.Background(), cfg)
+		for file := range results {
+			got = append(got, file.Path+" "+file.Rule)
+			sizes[file.Path] = file.Info.Size()
+		}
+		if err := <-errs; err != nil {
+			t.Fatal(err)
+		}
+	})
+	slices.Sort(got)
+
+	want := []string{"a.txt name", "conf/b.ini path", "docs/a.txt name", "logs/2024/d.log directory"}
+	if !slices.Equal(got, want) {
+		t.Errorf("matched %q, want %q", got, want)
+	}
+	if sizes["docs/a.txt"] != 13 {
+		t.Errorf("docs/a.txt has size %d, want 13", sizes["docs/a.txt"])
+	}
+}
@@ -0,0 +1,18 @@
+//go:build unix
+
+package pathfinder
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+)
+
+// dirKey identifies the directory described by info by its device and inode.
+func dirKey(path string, info os.FileInfo) (string, error) {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return "", fmt.Errorf("no device and inode available for %s", path)
+	}
+	return fmt.Sprintf("%d:%d", stat.Dev, stat.Ino), nil
+}
@@ -0,0 +1,65 @@
+//go:build unix
+
+package pathfinder
+
+import (
+	"bytes"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestSpecialFilesAreSkipped(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "src")
+	writeFile(t, filepath.Join(src, "a.txt"), "alpha")
+	if err := syscall.Mkfifo(filepath.Join(src, "pipe"), 0o644); err != nil {
+		t.Skip("named pipes are not supported:", err)
+	}
+	if err := os.Symlink(filepath.Join(src, "pipe"), filepath.Join(src, "pipe-link")); err != nil {
+		t.Fatal(err)
+	}
+	special := []string{"pipe", "pipe-link"}
+	if listener, err := net.Listen("unix", filepath.Join(src, "sock")); err == nil {
+		defer listener.Close()
+		special = append(special, "sock")
+	}
+	writeFile(t, filepath.Join(dir, "list.txt"), "[files]\n*\n")
+
+	var out bytes.Buffer
+	cfg := DefaultConfig()
+	cfg.Directories = []string{src}
+	cfg.ListFile = filepath.Join(dir, "list.txt")
+	cfg.OutputPath = dir
+	cfg.OutputName = "out.zip"
+	cfg.Verbose = true
+	cfg.Output = &out
+
+	// Reading the pipe would block forever
+	errc := make(chan error, 1)
+	go func() {
+		_, err := Run(cfg)
+		errc <- err
+	}()
+	select {
+	case err := <-errc:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("the run did not finish")
+	}
+
+	if entries := readZip(t, filepath.Join(dir, "out.zip")); len(entries) != 1 || entries["a.txt"] != "alpha" {
+		t.Errorf("archive holds %v, want only a.txt", entries)
+	}
+	for _, name := range special {
+		if !strings.Contains(out.String(), "Skipping special file: "+filepath.Join(src, name)+"\n") {
+			t.Errorf("verbose output lacks a note about %s:\n%s", name, out.String())
+		}
+	}
+}
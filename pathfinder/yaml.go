@@ -0,0 +1,184 @@
+package pathfinder
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// isYAMLList reports whether filename names a YAML list file.
+func isYAMLList(filename string) bool {
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".yaml", ".yml":
+		return true
+	}
+	return false
+}
+
+// parseYAMLList reads a YAML list file into list. Only the subset needed for
+// list files is understood: top-level "files", "paths", "directories",
+// "exclude" and "regex" keys, each holding a sequence of strings written
+// either as a block ("- item" lines) or in flow style ("[a, b]"). Unknown
+// keys are recorded and ignored like unknown sections in the text format.
+// As in YAML, values starting with an indicator character must be quoted,
+// so globs and negations are written '*.log' and '!*.tmp'; see yamlScalar.
+func parseYAMLList(list *sections, r io.Reader) error {
+	var target *[]string
+	scanner := bufio.NewScanner(r)
+	lineNumber := 0
+
+	for scanner.Scan() {
+		lineNumber++
+		raw := strings.TrimRight(scanner.Text(), " \t\r")
+		line := strings.TrimSpace(stripYAMLComment(raw))
+		if line == "" || line == "---" {
+			continue
+		}
+
+		// Sequence items belong to the most recent key
+		if item, ok := strings.CutPrefix(line, "-"); ok && (item == "" || item[0] == ' ') {
+			if target == nil {
+				continue
+			}
+			value, err := yamlScalar(strings.TrimSpace(item))
+			if err != nil {
+				return fmt.Errorf("error reading YAML list line %d: %w", lineNumber, err)
+			}
+			if value != "" {
+				*target = append(*target, value)
+			}
+			continue
+		}
+
+		// Top-level keys select the slice that following items go to
+		if raw[0] == ' ' || raw[0] == '\t' {
+			return fmt.Errorf("error reading YAML list line %d: unexpected nested value", lineNumber)
+		}
+		key, rest, ok := strings.Cut(line, ":")
+		if !ok {
+			return fmt.Errorf("error reading YAML list line %d: expected a key", lineNumber)
+		}
+		key = strings.TrimSpace(key)
+		list.noteSection(key)
+		switch key {
+		case "files":
+			target = &list.fileNames
+		case "paths":
+			target = &list.filePaths
+		case "directories":
+			target = &list.directories
+		case "exclude":
+			target = &list.excludes
+		case "regex":
+			target = &list.regexes
+		default:
+			target = nil
+		}
+
+		rest = strings.TrimSpace(rest)
+		if rest == "" || target == nil {
+			continue
+		}
+		if !strings.HasPrefix(rest, "[") || !strings.HasSuffix(rest, "]") {
+			return fmt.Errorf("error reading YAML list line %d: %s must be a list", lineNumber, key)
+		}
+		for _, item := range splitYAMLFlow(rest[1 : len(rest)-1]) {
+			value, err := yamlScalar(strings.TrimSpace(item))
+			if err != nil {
+				return fmt.Errorf("error reading YAML list line %d: %w", lineNumber, err)
+			}
+			if value != "" {
+				*target = append(*target, value)
+			}
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("error reading YAML list: %w", err)
+	}
+	return nil
+}
+
+// stripYAMLComment removes a trailing comment, which starts at a "#" that is
+// outside quotes and at the start of the line or after whitespace.
+func stripYAMLComment(line string) string {
+	var quote byte
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		switch {
+		case quote != 0:
+			if c == '\\' && quote == '"' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '#' && (i == 0 || line[i-1] == ' ' || line[i-1] == '\t'):
+			return line[:i]
+		}
+	}
+	return line
+}
+
+// splitYAMLFlow splits the inside of a flow sequence at commas outside quotes.
+func splitYAMLFlow(s string) []string {
+	var items []string
+	var quote byte
+	start := 0
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case quote != 0:
+			if c == '\\' && quote == '"' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == ',':
+			items = append(items, s[start:i])
+			start = i + 1
+		}
+	}
+	return append(items, s[start:])
+}
+
+// yamlIndicators are the characters that cannot start a plain YAML scalar,
+// as they introduce aliases, anchors, tags, block scalars, directives,
+// flow collections and reserved syntax. "-", "?" and ":" only do so when a
+// space or the end of the value follows.
+const yamlIndicators = "*&!|>%@`{}[],"
+
+// yamlScalar unquotes a single- or double-quoted YAML scalar and returns
+// plain scalars unchanged. A quote must close at the end of the value. A
+// plain scalar that a YAML parser would read as something other than a
+// string, such as the alias *.log, is rejected rather than taken literally.
+func yamlScalar(s string) (string, error) {
+	if s == "" {
+		return s, nil
+	}
+	if strings.IndexByte(yamlIndicators, s[0]) >= 0 ||
+		(strings.IndexByte("-?:", s[0]) >= 0 && (len(s) == 1 || s[1] == ' ' || s[1] == '\t')) {
+		return "", fmt.Errorf("value %s must be quoted, as YAML reserves its leading %q", s, s[0])
+	}
+	if s[0] != '"' && s[0] != '\'' {
+		return s, nil
+	}
+	if s[0] == '"' {
+		value, err := strconv.Unquote(s)
+		if err != nil {
+			return "", fmt.Errorf("invalid quoted value %s", s)
+		}
+		return value, nil
+	}
+	inner, ok := strings.CutSuffix(s[1:], "'")
+	if !ok || strings.Contains(strings.ReplaceAll(inner, "''", ""), "'") {
+		return "", fmt.Errorf("invalid quoted value %s", s)
+	}
+	return strings.ReplaceAll(inner, "''", "'"), nil
+}
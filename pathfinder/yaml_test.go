@@ -0,0 +1,121 @@
+package pathfinder
+
+import (
+	"context"
+	"io"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestYAMLListMatchesTextList(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "src")
+	writeFile(t, filepath.Join(src, "a.txt"), "alpha")
+	writeFile(t, filepath.Join(src, "b.log"), "bravo")
+	writeFile(t, filepath.Join(src, "it's.md"), "charlie")
+	writeFile(t, filepath.Join(src, "docs", "c.md"), "delta")
+	writeFile(t, filepath.Join(src, "docs", "d.tmp"), "echo")
+	writeFile(t, filepath.Join(src, "e.csv"), "foxtrot")
+
+	writeFile(t, filepath.Join(dir, "list.txt"), "[files]\n*.txt\nit's.md\n"+
+		"[directories]\n"+filepath.Join(src, "docs")+"\n"+
+		"[exclude]\n*.tmp\n"+
+		"[regex]\n^e\\.csv$\n")
+	writeFile(t, filepath.Join(dir, "list.yaml"), "---\n"+
+		"# the same list as list.txt\n"+
+		"files:\n  - '*.txt'   # quoted, as * starts an alias\n  - 'it''s.md'\n"+
+		"directories: [\""+filepath.Join(src, "docs")+"\"]\n"+
+		"exclude: ['*.tmp']\n"+
+		"regex:\n  - \"^e\\\\.csv$\"\n")
+
+	lists := make(map[string]sections)
+	matched := make(map[string][]string)
+	for _, name := range []string{"list.txt", "list.yaml"} {
+		list, err := readTextFile([]string{filepath.Join(dir, name)}, false, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		lists[name] = list
+
+		cfg := DefaultConfig()
+		cfg.Directories = []string{src}
+		cfg.ListFile = filepath.Join(dir, name)
+		cfg.Output = io.Discard
+		results, errs := Matches(context.Background(), cfg)
+		for file := range results {
+			matched[name] = append(matched[name], filepath.Base(file.Path))
+		}
+		if err := <-errs; err != nil {
+			t.Fatal(err)
+		}
+		sort.Strings(matched[name])
+	}
+
+	// The origins name the list file, so only the sections are compared
+	yaml, text := lists["list.yaml"], lists["list.txt"]
+	for name, entries := range map[string][2][]string{
+		"files":       {yaml.fileNames, text.fileNames},
+		"paths":       {yaml.filePaths, text.filePaths},
+		"directories": {yaml.directories, text.directories},
+		"exclude":     {yaml.excludes, text.excludes},
+		"regex":       {yaml.regexes, text.regexes},
+	} {
+		if !slices.Equal(entries[0], entries[1]) {
+			t.Errorf("YAML [%s] = %q, want %q", name, entries[0], entries[1])
+		}
+	}
+	if want := []string{"a.txt", "c.md", "e.csv", "it's.md"}; !slices.Equal(matched["list.txt"], want) {
+		t.Errorf("text list matched %v, want %v", matched["list.txt"], want)
+	}
+	if !slices.Equal(matched["list.yaml"], matched["list.txt"]) {
+		t.Errorf("YAML list matched %v, text list %v", matched["list.yaml"], matched["list.txt"])
+	}
+}
+
+func TestYAMLPlainScalars(t *testing.T) {
+	var list sections
+	content := "files:\n  - -a.txt\n  - a*.txt\n  - 'x:y'\n  - \"*.log\"\nexclude: ['!*.tmp', b!.txt]\n"
+	if err := parseYAMLList(&list, strings.NewReader(content)); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"-a.txt", "a*.txt", "x:y", "*.log"}; !slices.Equal(list.fileNames, want) {
+		t.Errorf("files = %q, want %q", list.fileNames, want)
+	}
+	if want := []string{"!*.tmp", "b!.txt"}; !slices.Equal(list.excludes, want) {
+		t.Errorf("exclude = %q, want %q", list.excludes, want)
+	}
+}
+
+func TestYAMLListErrors(t *testing.T) {
+	tests := []struct {
+		content, err string
+	}{
+		{"files:\n  nested:\n    - a.txt\n", "line 2: unexpected nested value"},
+		{"files:\n  - a.txt\n  extra: b.txt\n", "line 3: unexpected nested value"},
+		{"files\n", "line 1: expected a key"},
+		{"files: a.txt\n", "line 1: files must be a list"},
+		{"files:\n  - \"a.txt\n", "line 2: invalid quoted value"},
+		{"files:\n  - 'a.txt\n", "line 2: invalid quoted value"},
+		{"files:\n  - 'a'b.txt'\n", "line 2: invalid quoted value"},
+		{"files:\n  - \"a\\q.txt\"\n", "line 2: invalid quoted value"},
+		{"files: ['a.txt, b.txt]\n", "line 1: invalid quoted value"},
+		{"files:\n  - *.log\n", "line 2: value *.log must be quoted"},
+		{"exclude:\n  - !*.tmp\n", "line 2: value !*.tmp must be quoted"},
+		{"files: [&a a.txt]\n", "line 1: value &a a.txt must be quoted"},
+		{"files:\n  - - a.txt\n", "line 2: value - a.txt must be quoted"},
+		{"files:\n  - |\n", "line 2: value | must be quoted"},
+		{"files: [[a.txt]]\n", "line 1: value [a.txt] must be quoted"},
+	}
+	for _, test := range tests {
+		var list sections
+		err := parseYAMLList(&list, strings.NewReader(test.content))
+		if err == nil {
+			t.Errorf("%q parsed as %v, want an error", test.content, list.fileNames)
+		} else if !strings.Contains(err.Error(), test.err) {
+			t.Errorf("%q: error %q, want %q", test.content, err, test.err)
+		}
+	}
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"fmt"
+	"runtime/debug"
+)
+
+// Build information, set at build time with
+//
+//	go build -ldflags "-X main.Version=1.2.0 -X main.Commit=$(git rev-parse --short HEAD) -X main.Date=$(date -u +%Y-%m-%dT%H:%M:%SZ)"
+var (
+	Version = "dev"
+	Commit  = ""
+	Date    = ""
+)
+
+// readBuildInfo returns the build information embedded in the binary. Tests
+// replace it.
+var readBuildInfo = debug.ReadBuildInfo
+
+// versionString describes the build. Commit and date fall back to the
+// version control information Go embeds when they were not set.
+func versionString() string {
+	commit, date := Commit, Date
+	if info, ok := readBuildInfo(); ok {
+		for _, setting := range info.Settings {
+			switch {
+			case setting.Key == "vcs.revision" && commit == "":
+				commit = setting.Value
+				if len(commit) > 12 {
+					commit = commit[:12]
+				}
+			case setting.Key == "vcs.time" && date == "":
+				date = setting.Value
+			}
+		}
+	}
+	if commit == "" {
+		commit = "unknown"
+	}
+	if date == "" {
+		date = "unknown"
+	}
+	return fmt.Sprintf("pathfinder %s (commit %s, built %s)", Version, commit, date)
+}